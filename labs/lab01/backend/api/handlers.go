@@ -0,0 +1,295 @@
+// Package api exposes a TaskManager over HTTP as JSON.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lab01/taskmanager"
+)
+
+// maxBodyBytes limits the size of request bodies
+const maxBodyBytes = 1 << 20
+
+// Handler serves the /tasks endpoints
+type Handler struct {
+	tm *taskmanager.TaskManager
+}
+
+// NewHandler creates a handler backed by tm
+func NewHandler(tm *taskmanager.TaskManager) *Handler {
+	return &Handler{tm: tm}
+}
+
+// TaskRequest is the body of POST, PUT and PATCH /tasks requests.
+// PATCH leaves absent fields unchanged; PUT resets them to their zero values.
+type TaskRequest struct {
+	Version         int                     `json:"version,omitempty"` // Expected current version, 0 skips the check
+	Title           *string                 `json:"title,omitempty"`
+	Description     *string                 `json:"description,omitempty"`
+	Done            *bool                   `json:"done,omitempty"`
+	DueDate         *time.Time              `json:"due_date,omitempty"`
+	ClearDueDate    bool                    `json:"clear_due_date,omitempty"`
+	Priority        *taskmanager.Priority   `json:"priority,omitempty"`
+	Tags            []string                `json:"tags,omitempty"`
+	Assignee        *string                 `json:"assignee,omitempty"`
+	ParentID        *int                    `json:"parent_id,omitempty"`
+	Recurrence      *taskmanager.Recurrence `json:"recurrence,omitempty"`
+	ClearRecurrence bool                    `json:"clear_recurrence,omitempty"`
+}
+
+// ErrorResponse is the body of every non-2xx response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// SetupRoutes registers the task endpoints on a new mux
+func (h *Handler) SetupRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", h.ListTasks)
+	mux.HandleFunc("POST /tasks", h.CreateTask)
+	mux.HandleFunc("GET /tasks/{id}", h.GetTask)
+	mux.HandleFunc("PUT /tasks/{id}", h.ReplaceTask)
+	mux.HandleFunc("PATCH /tasks/{id}", h.PatchTask)
+	mux.HandleFunc("DELETE /tasks/{id}", h.DeleteTask)
+	return mux
+}
+
+// ListTasks handles GET /tasks. Query parameters are the keys of taskmanager.TaskFilter.Set,
+// e.g. /tasks?tag=work&done=false&sort=-due&limit=20.
+func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
+	var filter taskmanager.TaskFilter
+	for key, values := range r.URL.Query() {
+		for _, value := range values {
+			if err := filter.Set(key, value); err != nil {
+				h.writeError(w, err)
+				return
+			}
+		}
+	}
+	tasks, err := h.tm.ListTasks(filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, tasks)
+}
+
+// CreateTask handles POST /tasks
+func (h *Handler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	var req TaskRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var draft taskmanager.Task
+	applyReplace(&draft, req)
+	task, err := h.manager(r).CreateTask(draft)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/tasks/%d", task.ID))
+	h.writeJSON(w, http.StatusCreated, task)
+}
+
+// GetTask handles GET /tasks/{id}
+func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	task, err := h.tm.GetTask(id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, task)
+}
+
+// ReplaceTask handles PUT /tasks/{id}
+func (h *Handler) ReplaceTask(w http.ResponseWriter, r *http.Request) {
+	h.updateTask(w, r, func(req TaskRequest) taskmanager.TaskPatch {
+		var task taskmanager.Task
+		applyReplace(&task, req)
+		tags := task.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		return taskmanager.TaskPatch{
+			Version:         req.Version,
+			Title:           &task.Title,
+			Description:     &task.Description,
+			Done:            &task.Done,
+			DueDate:         task.DueDate,
+			ClearDueDate:    task.DueDate == nil,
+			Priority:        &task.Priority,
+			Tags:            tags,
+			Assignee:        &task.Assignee,
+			ParentID:        &task.ParentID,
+			Recurrence:      task.Recurrence,
+			ClearRecurrence: task.Recurrence == nil,
+		}
+	})
+}
+
+// PatchTask handles PATCH /tasks/{id}
+func (h *Handler) PatchTask(w http.ResponseWriter, r *http.Request) {
+	h.updateTask(w, r, func(req TaskRequest) taskmanager.TaskPatch {
+		return taskmanager.TaskPatch{
+			Version:         req.Version,
+			Title:           req.Title,
+			Description:     req.Description,
+			Done:            req.Done,
+			DueDate:         req.DueDate,
+			ClearDueDate:    req.ClearDueDate,
+			Priority:        req.Priority,
+			Tags:            req.Tags, // "tags": [] clears them
+			Assignee:        req.Assignee,
+			ParentID:        req.ParentID,
+			Recurrence:      req.Recurrence,
+			ClearRecurrence: req.ClearRecurrence,
+		}
+	})
+}
+
+// DeleteTask handles DELETE /tasks/{id}
+func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	id, err := taskID(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.manager(r).DeleteTask(id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateTask decodes the request body and applies the patch built from it
+func (h *Handler) updateTask(w http.ResponseWriter, r *http.Request, toPatch func(TaskRequest) taskmanager.TaskPatch) {
+	id, err := taskID(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var req TaskRequest
+	if err := h.parseJSON(w, r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	task, err := h.manager(r).PatchTask(id, toPatch(req))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, task)
+}
+
+// manager returns the task manager acting on behalf of the X-Actor header, if present
+func (h *Handler) manager(r *http.Request) *taskmanager.TaskManager {
+	if actor := r.Header.Get("X-Actor"); actor != "" {
+		return h.tm.WithActor(actor)
+	}
+	return h.tm
+}
+
+// applyReplace copies every request field onto task, leaving absent ones at their zero value
+func applyReplace(task *taskmanager.Task, req TaskRequest) {
+	if req.Title != nil {
+		task.Title = *req.Title
+	}
+	if req.Description != nil {
+		task.Description = *req.Description
+	}
+	if req.Done != nil {
+		task.Done = *req.Done
+	}
+	if req.Priority != nil {
+		task.Priority = *req.Priority
+	}
+	if req.Assignee != nil {
+		task.Assignee = *req.Assignee
+	}
+	if req.ParentID != nil {
+		task.ParentID = *req.ParentID
+	}
+	task.DueDate = req.DueDate
+	task.Tags = req.Tags
+	task.Recurrence = req.Recurrence
+}
+
+// errBadRequest marks errors caused by a malformed request
+var errBadRequest = errors.New("bad request")
+
+func taskID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid task id %q", errBadRequest, r.PathValue("id"))
+	}
+	return id, nil
+}
+
+// statusCode maps taskmanager errors onto HTTP status codes
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, taskmanager.ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, taskmanager.ErrEmptyTitle),
+		errors.Is(err, taskmanager.ErrInvalidPriority),
+		errors.Is(err, taskmanager.ErrInvalidRecurrence),
+		errors.Is(err, taskmanager.ErrInvalidParent):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, taskmanager.ErrConflict),
+		errors.Is(err, taskmanager.ErrHasSubtasks),
+		errors.Is(err, taskmanager.ErrIncompleteSubtasks):
+		return http.StatusConflict
+	case errors.Is(err, taskmanager.ErrInvalidFilter), errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes data as a JSON response with the given status
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("api: encode response: %v", err)
+	}
+}
+
+// writeError writes err as an ErrorResponse; internal errors are logged and not exposed
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	status := statusCode(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Printf("api: %v", err)
+		message = http.StatusText(status)
+	}
+	h.writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+// parseJSON decodes the request body into dst, rejecting unknown fields
+func (h *Handler) parseJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		if statusCode(err) != http.StatusInternalServerError {
+			return err // invalid priority or recurrence, or an oversized body
+		}
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	return nil
+}
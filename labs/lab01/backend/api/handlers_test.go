@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lab01/taskmanager"
+)
+
+func setupTestHandler(t *testing.T) (*taskmanager.TaskManager, http.Handler) {
+	t.Helper()
+	tm := taskmanager.NewTaskManager()
+	return tm, NewHandler(tm).SetupRoutes()
+}
+
+// do sends a request to handler and returns the recorded response
+func do(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func decode[T any](t *testing.T, rr *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rr.Body).Decode(&v); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	return v
+}
+
+func TestCreateAndGetTask(t *testing.T) {
+	_, handler := setupTestHandler(t)
+
+	rr := do(t, handler, "POST", "/tasks", `{"title":"Write report","priority":"high","tags":["Work"],"due_date":"2025-06-10T00:00:00Z"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/tasks/1" {
+		t.Errorf("Expected Location /tasks/1, got %q", loc)
+	}
+	created := decode[taskmanager.Task](t, rr)
+	if created.Title != "Write report" || created.Priority != taskmanager.PriorityHigh || created.DueDate == nil {
+		t.Errorf("Unexpected task %+v", created)
+	}
+
+	rr = do(t, handler, "GET", "/tasks/1", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if got := decode[taskmanager.Task](t, rr); got.ID != 1 || len(got.Tags) != 1 || got.Tags[0] != "work" {
+		t.Errorf("Unexpected task %+v", got)
+	}
+}
+
+func TestListTasksQuery(t *testing.T) {
+	tm, handler := setupTestHandler(t)
+	drafts := []taskmanager.Task{
+		{Title: "Buy milk", Tags: []string{"home"}, Priority: taskmanager.PriorityLow},
+		{Title: "Write report", Tags: []string{"work"}, Priority: taskmanager.PriorityHigh},
+		{Title: "Fix bug", Tags: []string{"work"}, Priority: taskmanager.PriorityMedium, Done: true},
+	}
+	for _, d := range drafts {
+		if _, err := tm.CreateTask(d); err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"", []int{1, 2, 3}},
+		{"?tag=work", []int{2, 3}},
+		{"?tag=work&done=false", []int{2}},
+		{"?sort=-priority", []int{2, 3, 1}},
+		{"?text=MILK", []int{1}},
+		{"?limit=1&offset=1", []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rr := do(t, handler, "GET", "/tasks"+tt.query, "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+			tasks := decode[[]taskmanager.Task](t, rr)
+			if len(tasks) != len(tt.expected) {
+				t.Fatalf("Expected %d tasks, got %d", len(tt.expected), len(tasks))
+			}
+			for i, id := range tt.expected {
+				if tasks[i].ID != id {
+					t.Errorf("tasks[%d].ID = %d, want %d", i, tasks[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateTask(t *testing.T) {
+	tm, handler := setupTestHandler(t)
+	tm.CreateTask(taskmanager.Task{Title: "Task", Description: "Details", Tags: []string{"work"}})
+
+	rr := do(t, handler, "PATCH", "/tasks/1", `{"done":true,"version":1}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PATCH: expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	patched := decode[taskmanager.Task](t, rr)
+	if !patched.Done || patched.Description != "Details" || len(patched.Tags) != 1 {
+		t.Errorf("PATCH should only change done, got %+v", patched)
+	}
+
+	rr = do(t, handler, "PATCH", "/tasks/1", `{"title":"Stale","version":1}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Stale PATCH: expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr = do(t, handler, "PUT", "/tasks/1", `{"title":"Replaced"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	replaced := decode[taskmanager.Task](t, rr)
+	if replaced.Title != "Replaced" || replaced.Description != "" || replaced.Done || len(replaced.Tags) != 0 {
+		t.Errorf("PUT should reset absent fields, got %+v", replaced)
+	}
+}
+
+func TestDeleteTask(t *testing.T) {
+	tm, handler := setupTestHandler(t)
+	tm.AddTask("Task", "")
+
+	if rr := do(t, handler, "DELETE", "/tasks/1", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(t, handler, "DELETE", "/tasks/1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestErrorStatusCodes(t *testing.T) {
+	tm, handler := setupTestHandler(t)
+	tm.AddTask("Parent", "")
+	tm.CreateTask(taskmanager.Task{Title: "Child", ParentID: 1})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"missing task", "GET", "/tasks/42", "", http.StatusNotFound},
+		{"patch missing task", "PATCH", "/tasks/42", `{"done":true}`, http.StatusNotFound},
+		{"invalid id", "GET", "/tasks/abc", "", http.StatusBadRequest},
+		{"empty title", "POST", "/tasks", `{"title":""}`, http.StatusUnprocessableEntity},
+		{"missing title", "POST", "/tasks", `{}`, http.StatusUnprocessableEntity},
+		{"clear title", "PATCH", "/tasks/1", `{"title":""}`, http.StatusUnprocessableEntity},
+		{"invalid priority", "POST", "/tasks", `{"title":"T","priority":"urgent"}`, http.StatusUnprocessableEntity},
+		{"unknown parent", "POST", "/tasks", `{"title":"T","parent_id":42}`, http.StatusUnprocessableEntity},
+		{"malformed JSON", "POST", "/tasks", `{"title":`, http.StatusBadRequest},
+		{"unknown field", "POST", "/tasks", `{"name":"T"}`, http.StatusBadRequest},
+		{"invalid filter", "GET", "/tasks?done=maybe", "", http.StatusBadRequest},
+		{"unknown filter", "GET", "/tasks?colour=red", "", http.StatusBadRequest},
+		{"has subtasks", "DELETE", "/tasks/1", "", http.StatusConflict},
+		{"incomplete subtasks", "PATCH", "/tasks/1", `{"done":true}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(t, handler, tt.method, tt.target, tt.body)
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body)
+			}
+			if resp := decode[ErrorResponse](t, rr); resp.Error == "" {
+				t.Error("Expected an error message")
+			}
+		})
+	}
+}
+
+func TestActorHeader(t *testing.T) {
+	tm, handler := setupTestHandler(t)
+	req := httptest.NewRequest("POST", "/tasks", strings.NewReader(`{"title":"Task"}`))
+	req.Header.Set("X-Actor", "alice")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	events, err := tm.History(1)
+	if err != nil || len(events) != 1 || events[0].Actor != "alice" {
+		t.Errorf("Expected one event by alice, got %+v (%v)", events, err)
+	}
+}
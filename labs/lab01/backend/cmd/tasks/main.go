@@ -0,0 +1,383 @@
+// Command tasks manages a task list from the terminal and serves it over HTTP.
+//
+//	tasks [-store tasks.json] <command> [flags] [args]
+//
+// Commands:
+//
+//	add   [-d desc] [-due date] [-p priority] [-t tags] [-a assignee] [-parent id] [-r rule] title...
+//	done  id...
+//	ls    [-filter expr] [-json]
+//	rm    id...
+//	edit  [-title t] [-d desc] [-due date|none] [-p priority] [-t tags] [-a assignee] [-r rule|none] id
+//	serve [-addr :8080]
+//
+// The store is a JSON file, or an SQLite database when the path ends in .db or .sqlite.
+// Its default is $TASKS_STORE, falling back to tasks.json in the current directory.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"lab01/api"
+	"lab01/taskmanager"
+)
+
+// errUsage is returned for invalid command lines; the usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+const usage = `usage: tasks [-store path] <command> [flags] [args]
+
+commands:
+  add    add a task
+  done   mark tasks done
+  ls     list tasks, e.g. ls -filter "tag:work done:false sort:due"
+  rm     delete tasks
+  edit   change a task
+  serve  serve the /tasks HTTP API
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "tasks:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args, writing results to stdout and diagnostics to stderr
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("tasks", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	defaultStore := os.Getenv("TASKS_STORE")
+	if defaultStore == "" {
+		defaultStore = "tasks.json"
+	}
+	storePath := fs.String("store", defaultStore, "task file (.json) or database (.db, .sqlite)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	commands := map[string]func(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error{
+		"add":   cmdAdd,
+		"done":  cmdDone,
+		"ls":    cmdList,
+		"rm":    cmdRemove,
+		"edit":  cmdEdit,
+		"serve": cmdServe,
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+
+	store, err := openStore(*storePath)
+	if err != nil {
+		return err
+	}
+	tm := taskmanager.NewTaskManagerWithStore(store)
+	defer tm.Close()
+	return cmd(tm, fs.Args()[1:], stdout, stderr)
+}
+
+// openStore picks the backend from the file extension
+func openStore(path string) (taskmanager.Store, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return taskmanager.NewSQLiteStore(path)
+	}
+	return taskmanager.NewFileStore(path)
+}
+
+// newFlagSet creates the flag set of a subcommand
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: tasks %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// taskFlags are the task fields shared by add and edit
+type taskFlags struct {
+	description, due, priority, tags, assignee, recurrence string
+}
+
+func (f *taskFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.description, "d", "", "description")
+	fs.StringVar(&f.due, "due", "", "due date, YYYY-MM-DD or RFC 3339 (\"none\" clears it)")
+	fs.StringVar(&f.priority, "p", "", "priority: low, medium or high")
+	fs.StringVar(&f.tags, "t", "", "comma-separated tags")
+	fs.StringVar(&f.assignee, "a", "", "assignee")
+	fs.StringVar(&f.recurrence, "r", "", "recurrence rule, e.g. FREQ=WEEKLY;BYDAY=MO (\"none\" clears it)")
+}
+
+func cmdAdd(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("add", "title...", stderr)
+	var f taskFlags
+	f.register(fs)
+	parent := fs.Int("parent", 0, "ID of the parent task")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	draft := taskmanager.Task{
+		Title:       strings.Join(fs.Args(), " "),
+		Description: f.description,
+		Tags:        splitTags(f.tags),
+		Assignee:    f.assignee,
+		ParentID:    *parent,
+	}
+	var err error
+	if draft.DueDate, err = parseDate(f.due); err != nil {
+		return err
+	}
+	if draft.Priority, err = taskmanager.ParsePriority(f.priority); err != nil {
+		return err
+	}
+	if f.recurrence != "" {
+		if draft.Recurrence, err = taskmanager.ParseRecurrence(f.recurrence); err != nil {
+			return err
+		}
+	}
+
+	task, err := tm.CreateTask(draft)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "added task %d\n", task.ID)
+	return nil
+}
+
+func cmdDone(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	ids, err := parseIDs("done", args, stderr)
+	if err != nil {
+		return err
+	}
+	done := true
+	for _, id := range ids {
+		if _, err := tm.PatchTask(id, taskmanager.TaskPatch{Done: &done}); err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		fmt.Fprintf(stdout, "completed task %d\n", id)
+	}
+	return nil
+}
+
+func cmdRemove(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	ids, err := parseIDs("rm", args, stderr)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := tm.DeleteTask(id); err != nil {
+			return fmt.Errorf("task %d: %w", id, err)
+		}
+		fmt.Fprintf(stdout, "deleted task %d\n", id)
+	}
+	return nil
+}
+
+func cmdList(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("ls", "", stderr)
+	expr := fs.String("filter", "", `filter expression, e.g. "tag:work done:false priority:high sort:-due limit:10"`)
+	asJSON := fs.Bool("json", false, "print tasks as JSON")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	filter, err := taskmanager.ParseFilter(strings.Join(append([]string{*expr}, fs.Args()...), " "))
+	if err != nil {
+		return err
+	}
+	tasks, err := tm.ListTasks(filter)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tasks)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDONE\tPRIORITY\tDUE\tTITLE\tTAGS")
+	for _, task := range tasks {
+		done, due := " ", "-"
+		if task.Done {
+			done = "x"
+		}
+		if task.DueDate != nil {
+			due = task.DueDate.Format(time.DateOnly)
+		}
+		fmt.Fprintf(tw, "%d\t[%s]\t%s\t%s\t%s\t%s\n",
+			task.ID, done, task.Priority, due, task.Title, strings.Join(task.Tags, ","))
+	}
+	return tw.Flush()
+}
+
+func cmdEdit(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("edit", "id", stderr)
+	var f taskFlags
+	f.register(fs)
+	title := fs.String("title", "", "title")
+	parent := fs.Int("parent", 0, "ID of the parent task, 0 for top-level")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	id, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid task id %q", fs.Arg(0))
+	}
+
+	// Only flags given on the command line change the task
+	var patch taskmanager.TaskPatch
+	fs.Visit(func(fl *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch fl.Name {
+		case "title":
+			patch.Title = title
+		case "d":
+			patch.Description = &f.description
+		case "due":
+			if f.due == "none" {
+				patch.ClearDueDate = true
+			} else if patch.DueDate, err = parseDate(f.due); err == nil && patch.DueDate == nil {
+				patch.ClearDueDate = true
+			}
+		case "p":
+			var p taskmanager.Priority
+			if p, err = taskmanager.ParsePriority(f.priority); err == nil {
+				patch.Priority = &p
+			}
+		case "t":
+			patch.Tags = splitTags(f.tags)
+			if patch.Tags == nil {
+				patch.Tags = []string{}
+			}
+		case "a":
+			patch.Assignee = &f.assignee
+		case "parent":
+			patch.ParentID = parent
+		case "r":
+			if f.recurrence == "none" || f.recurrence == "" {
+				patch.ClearRecurrence = true
+			} else {
+				patch.Recurrence, err = taskmanager.ParseRecurrence(f.recurrence)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := tm.PatchTask(id, patch); err != nil {
+		return fmt.Errorf("task %d: %w", id, err)
+	}
+	fmt.Fprintf(stdout, "updated task %d\n", id)
+	return nil
+}
+
+func cmdServe(tm *taskmanager.TaskManager, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("serve", "", stderr)
+	addr := fs.String("addr", ":8080", "listen address")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      api.NewHandler(tm).SetupRoutes(),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving tasks on %s", *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// parseIDs parses the task ID arguments of done and rm
+func parseIDs(name string, args []string, stderr io.Writer) ([]int, error) {
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, "usage: tasks %s id...\n", name)
+		return nil, errUsage
+	}
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid task id %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseDate accepts YYYY-MM-DD (midnight local time) or RFC 3339; an empty string means no date
+func parseDate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, want YYYY-MM-DD or RFC 3339", s)
+	}
+	return &t, nil
+}
+
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
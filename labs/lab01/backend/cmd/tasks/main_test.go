@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lab01/taskmanager"
+)
+
+// runTasks runs the CLI against store and returns its standard output
+func runTasks(t *testing.T, store string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-store", store}, args...), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestCLI(t *testing.T) {
+	for _, name := range []string{"tasks.json", "tasks.db"} {
+		t.Run(name, func(t *testing.T) {
+			store := filepath.Join(t.TempDir(), name)
+			steps := [][]string{
+				{"add", "-p", "high", "-t", "work,report", "-due", "2025-06-10", "Write", "report"},
+				{"add", "-t", "home", "Buy milk"},
+				{"add", "-parent", "1", "Collect numbers"},
+				{"done", "3"},
+				{"edit", "-title", "Buy oat milk", "-p", "low", "2"},
+				{"rm", "3"},
+			}
+			for _, args := range steps {
+				if _, err := runTasks(t, store, args...); err != nil {
+					t.Fatalf("tasks %s: %v", strings.Join(args, " "), err)
+				}
+			}
+
+			out, err := runTasks(t, store, "ls", "-filter", "sort:priority")
+			if err != nil {
+				t.Fatalf("tasks ls: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("Expected header and 2 tasks, got:\n%s", out)
+			}
+			for i, want := range []string{"Buy oat milk", "Write report"} {
+				if !strings.Contains(lines[i+1], want) {
+					t.Errorf("Line %d: expected %q, got %q", i+1, want, lines[i+1])
+				}
+			}
+			if !strings.Contains(lines[2], "2025-06-10") || !strings.Contains(lines[2], "work,report") {
+				t.Errorf("Expected due date and tags in %q", lines[2])
+			}
+
+			out, err = runTasks(t, store, "ls", "-filter", "tag:work", "-json")
+			if err != nil {
+				t.Fatalf("tasks ls -json: %v", err)
+			}
+			if !strings.Contains(out, `"title": "Write report"`) || strings.Contains(out, "oat milk") {
+				t.Errorf("Unexpected JSON output:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "tasks.json")
+	if _, err := runTasks(t, store, "add", "Task"); err != nil {
+		t.Fatalf("tasks add: %v", err)
+	}
+
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{[]string{}, errUsage},
+		{[]string{"frobnicate"}, errUsage},
+		{[]string{"add"}, errUsage},
+		{[]string{"done"}, errUsage},
+		{[]string{"done", "42"}, taskmanager.ErrTaskNotFound},
+		{[]string{"rm", "42"}, taskmanager.ErrTaskNotFound},
+		{[]string{"edit", "-title", "", "1"}, taskmanager.ErrEmptyTitle},
+		{[]string{"add", "-p", "urgent", "Task"}, taskmanager.ErrInvalidPriority},
+		{[]string{"ls", "-filter", "done:maybe"}, taskmanager.ErrInvalidFilter},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if _, err := runTasks(t, store, tt.args...); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
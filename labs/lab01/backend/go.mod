@@ -1,3 +1,15 @@
 module lab01
 
 go 1.24
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	shared v0.0.0
+)
+
+require (
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+)
+
+replace shared => ../../shared
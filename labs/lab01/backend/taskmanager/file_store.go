@@ -0,0 +1,128 @@
+package taskmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"shared/fsutil"
+)
+
+// FileStore keeps tasks in memory and rewrites a JSON file after every change.
+// Writes go to a temporary file that is fsynced and renamed over the target,
+// so a crash never leaves a half-written file behind.
+type FileStore struct {
+	path string
+	mem  *MemoryStore
+}
+
+// fileData is the on-disk layout of a FileStore
+type fileData struct {
+	NextID int    `json:"next_id"`
+	Tasks  []Task `json:"tasks"`
+}
+
+// NewFileStore opens the JSON file at path, creating an empty store if it does not exist
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, mem: NewMemoryStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read task file: %w", err)
+	}
+
+	var fd fileData
+	if err := json.Unmarshal(data, &fd); err != nil {
+		return nil, fmt.Errorf("decode task file: %w", err)
+	}
+	for _, task := range fd.Tasks {
+		if task.Version == 0 { // written before tasks were versioned
+			task.Version = 1
+		}
+		s.mem.tasks[task.ID] = task
+		if task.ID >= fd.NextID {
+			fd.NextID = task.ID + 1
+		}
+	}
+	if fd.NextID > 0 {
+		s.mem.nextID = fd.NextID
+	}
+	return s, nil
+}
+
+// Create stores a new task and persists the file
+func (s *FileStore) Create(task Task) (Task, error) {
+	var created Task
+	err := s.mutate(func(m *MemoryStore) error {
+		var err error
+		created, err = m.Create(task)
+		return err
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	return created, nil
+}
+
+// Update replaces an existing task and persists the file
+func (s *FileStore) Update(task Task) error {
+	return s.mutate(func(m *MemoryStore) error { return m.Update(task) })
+}
+
+// Put inserts or replaces a task under its own ID and persists the file
+func (s *FileStore) Put(task Task) error {
+	return s.mutate(func(m *MemoryStore) error { return m.Put(task) })
+}
+
+// Delete removes a task and persists the file
+func (s *FileStore) Delete(id int) error {
+	return s.mutate(func(m *MemoryStore) error { return m.Delete(id) })
+}
+
+// Get retrieves a task by ID, returns an error if the task is not found
+func (s *FileStore) Get(id int) (Task, error) {
+	return s.mem.Get(id)
+}
+
+// List returns all tasks ordered by ID
+func (s *FileStore) List() ([]Task, error) {
+	return s.mem.List()
+}
+
+// Close is a no-op: every change is already on disk
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// mutate applies fn to the in-memory state and writes it out,
+// rolling the in-memory state back if the write fails
+func (s *FileStore) mutate(fn func(m *MemoryStore) error) error {
+	backup := s.mem.clone()
+	if err := fn(s.mem); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.mem = backup
+		return err
+	}
+	return nil
+}
+
+// save writes the current state to disk
+func (s *FileStore) save() error {
+	tasks, err := s.mem.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fileData{NextID: s.mem.nextID, Tasks: tasks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode task file: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("write task file: %w", err)
+	}
+	return nil
+}
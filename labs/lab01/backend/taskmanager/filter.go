@@ -0,0 +1,261 @@
+package taskmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is returned for filter expressions that cannot be parsed
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// SortField selects the order of ListTasks results
+type SortField int
+
+// Sort fields; ties are always broken by ID
+const (
+	SortByID SortField = iota
+	SortByCreated
+	SortByUpdated
+	SortByDueDate // tasks without a due date come last
+	SortByPriority
+	SortByTitle
+)
+
+// sortFieldNames are the names accepted by ParseSortField, indexed by SortField
+var sortFieldNames = []string{"id", "created", "updated", "due", "priority", "title"}
+
+// String returns the sort field name, e.g. "due"
+func (f SortField) String() string {
+	if f < 0 || int(f) >= len(sortFieldNames) {
+		return strconv.Itoa(int(f))
+	}
+	return sortFieldNames[f]
+}
+
+// ParseSortField converts a sort field name (case-insensitive) into a SortField; an empty string means SortByID
+func ParseSortField(s string) (SortField, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return SortByID, nil
+	}
+	for i, name := range sortFieldNames {
+		if s == name {
+			return SortField(i), nil
+		}
+	}
+	return SortByID, fmt.Errorf("%w: unknown sort field %q", ErrInvalidFilter, s)
+}
+
+// TaskFilter selects, orders and paginates tasks for ListTasks.
+// The zero value returns every task ordered by ID.
+type TaskFilter struct {
+	Done     *bool     // Only tasks with this done status
+	Tags     []string  // Only tasks carrying all of these tags
+	Overdue  bool      // Only tasks that are overdue
+	Priority *Priority // Only tasks with this priority
+	Assignee string    // Only tasks assigned to this user
+	Text     string    // Case-insensitive substring of the title or description
+	ParentID *int      // Only subtasks of this task, 0 for top-level tasks
+
+	SortBy SortField
+	Desc   bool // Reverse the sort order
+
+	Offset int // Number of matching tasks to skip
+	Limit  int // Maximum number of tasks to return, 0 means no limit
+}
+
+// ParseFilter parses a filter expression of space-separated key:value terms, e.g.
+// "tag:work done:false sort:due". Words without a known key are joined into the text search.
+// See TaskFilter.Set for the supported keys.
+func ParseFilter(expr string) (TaskFilter, error) {
+	var f TaskFilter
+	var text []string
+	for _, term := range strings.Fields(expr) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || !isFilterKey(key) {
+			text = append(text, term)
+			continue
+		}
+		if err := f.Set(key, value); err != nil {
+			return TaskFilter{}, err
+		}
+	}
+	if len(text) > 0 {
+		f.Text = strings.TrimSpace(f.Text + " " + strings.Join(text, " "))
+	}
+	return f, nil
+}
+
+// filterKeys are the keys accepted by TaskFilter.Set
+var filterKeys = []string{
+	"done", "tag", "overdue", "priority", "assignee", "text", "parent", "sort", "desc", "offset", "limit",
+}
+
+func isFilterKey(key string) bool {
+	for _, k := range filterKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Set applies one filter criterion by name. Keys are done, tag (may be repeated or
+// comma-separated), overdue, priority, assignee, text, parent, sort, desc, offset and limit.
+func (f *TaskFilter) Set(key, value string) error {
+	var err error
+	switch key {
+	case "done":
+		var done bool
+		if done, err = strconv.ParseBool(value); err == nil {
+			f.Done = &done
+		}
+	case "tag":
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				f.Tags = append(f.Tags, tag)
+			}
+		}
+	case "overdue":
+		f.Overdue, err = strconv.ParseBool(value)
+	case "priority":
+		var p Priority
+		if p, err = ParsePriority(value); err == nil {
+			f.Priority = &p
+		}
+	case "assignee":
+		f.Assignee = value
+	case "text":
+		f.Text = value
+	case "parent":
+		var parent int
+		if parent, err = strconv.Atoi(value); err == nil {
+			f.ParentID = &parent
+		}
+	case "sort":
+		field, desc := strings.CutPrefix(value, "-")
+		if f.SortBy, err = ParseSortField(field); err == nil && desc {
+			f.Desc = true
+		}
+	case "desc":
+		f.Desc, err = strconv.ParseBool(value)
+	case "offset":
+		f.Offset, err = parseNonNegative(value)
+	case "limit":
+		f.Limit, err = parseNonNegative(value)
+	default:
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidFilter, key)
+	}
+	if err != nil && !errors.Is(err, ErrInvalidFilter) {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFilter, key, err)
+	}
+	return err
+}
+
+func parseNonNegative(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative integer", s)
+	}
+	return n, nil
+}
+
+// Match reports whether task satisfies the filter criteria, with now used for the overdue check
+func (f TaskFilter) Match(task Task, now time.Time) bool {
+	if f.Done != nil && task.Done != *f.Done {
+		return false
+	}
+	if f.Overdue && !task.IsOverdue(now) {
+		return false
+	}
+	if f.Priority != nil && task.Priority != *f.Priority {
+		return false
+	}
+	if f.Assignee != "" && task.Assignee != f.Assignee {
+		return false
+	}
+	if f.ParentID != nil && task.ParentID != *f.ParentID {
+		return false
+	}
+	for _, want := range normalizeTags(f.Tags) {
+		if !hasTag(task, want) {
+			return false
+		}
+	}
+	if f.Text != "" {
+		text := strings.ToLower(f.Text)
+		if !strings.Contains(strings.ToLower(task.Title), text) &&
+			!strings.Contains(strings.ToLower(task.Description), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply filters, sorts and paginates tasks, always returning a non-nil slice
+func (f TaskFilter) apply(tasks []Task, now time.Time) []Task {
+	result := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		if f.Match(task, now) {
+			result = append(result, task)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if f.SortBy == SortByDueDate && (a.DueDate == nil) != (b.DueDate == nil) {
+			return b.DueDate == nil // undated tasks stay last in both directions
+		}
+		if f.Desc {
+			a, b = b, a
+		}
+		if c := compareTasks(a, b, f.SortBy); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	})
+
+	if f.Offset > 0 {
+		if f.Offset >= len(result) {
+			return []Task{}
+		}
+		result = result[f.Offset:]
+	}
+	if f.Limit > 0 && f.Limit < len(result) {
+		result = result[:f.Limit]
+	}
+	return result
+}
+
+// compareTasks orders a and b by field, returning a negative, zero or positive number
+func compareTasks(a, b Task, field SortField) int {
+	switch field {
+	case SortByCreated:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case SortByUpdated:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case SortByDueDate:
+		if a.DueDate == nil || b.DueDate == nil {
+			return 0
+		}
+		return a.DueDate.Compare(*b.DueDate)
+	case SortByPriority:
+		return int(a.Priority) - int(b.Priority)
+	case SortByTitle:
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	}
+	return a.ID - b.ID
+}
+
+func hasTag(task Task, tag string) bool {
+	for _, t := range task.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package taskmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newFilterFixture creates tasks with a fixed clock so overdue checks are deterministic
+func newFilterFixture(t *testing.T) (*TaskManager, time.Time) {
+	t.Helper()
+	now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	tm := NewTaskManager()
+	tm.now = func() time.Time { return now }
+
+	yesterday := now.Add(-24 * time.Hour)
+	tomorrow := now.Add(24 * time.Hour)
+	drafts := []Task{
+		{Title: "Buy milk", Tags: []string{"Home", "shopping"}, Priority: PriorityLow, DueDate: &yesterday},
+		{Title: "Write report", Description: "Quarterly numbers", Tags: []string{"work"}, Priority: PriorityHigh, Assignee: "alice", DueDate: &tomorrow},
+		{Title: "Clean kitchen", Tags: []string{"home"}, Priority: PriorityMedium, Assignee: "bob"},
+		{Title: "Pay rent", Tags: []string{"home"}, Priority: PriorityHigh, DueDate: &yesterday, Done: true},
+	}
+	for _, d := range drafts {
+		if _, err := tm.CreateTask(d); err != nil {
+			t.Fatalf("CreateTask failed: %v", err)
+		}
+	}
+	return tm, now
+}
+
+func TestListTasksFilter(t *testing.T) {
+	tm, _ := newFilterFixture(t)
+	high := PriorityHigh
+	pending := false
+	topLevel := 0
+
+	tests := []struct {
+		name     string
+		filter   TaskFilter
+		expected []int
+	}{
+		{"no filter", TaskFilter{}, []int{1, 2, 3, 4}},
+		{"pending", TaskFilter{Done: &pending}, []int{1, 2, 3}},
+		{"single tag, case-insensitive", TaskFilter{Tags: []string{"HOME"}}, []int{1, 3, 4}},
+		{"all tags required", TaskFilter{Tags: []string{"home", "shopping"}}, []int{1}},
+		{"overdue excludes done tasks", TaskFilter{Overdue: true}, []int{1}},
+		{"priority", TaskFilter{Priority: &high}, []int{2, 4}},
+		{"assignee", TaskFilter{Assignee: "bob"}, []int{3}},
+		{"text in title", TaskFilter{Text: "KITCHEN"}, []int{3}},
+		{"text in description", TaskFilter{Text: "quarterly"}, []int{2}},
+		{"top-level tasks", TaskFilter{ParentID: &topLevel}, []int{1, 2, 3, 4}},
+		{"combined", TaskFilter{Tags: []string{"home"}, Priority: &high}, []int{4}},
+		{"no match", TaskFilter{Assignee: "carol"}, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := tm.ListTasks(tt.filter)
+			if err != nil {
+				t.Fatalf("ListTasks failed: %v", err)
+			}
+			assertTaskIDs(t, tasks, tt.expected)
+		})
+	}
+}
+
+func TestListTasksSortAndPaginate(t *testing.T) {
+	tm, _ := newFilterFixture(t)
+
+	tests := []struct {
+		name     string
+		filter   TaskFilter
+		expected []int
+	}{
+		{"by ID descending", TaskFilter{Desc: true}, []int{4, 3, 2, 1}},
+		{"by priority, ties by ID", TaskFilter{SortBy: SortByPriority}, []int{1, 3, 2, 4}},
+		{"by priority descending", TaskFilter{SortBy: SortByPriority, Desc: true}, []int{4, 2, 3, 1}},
+		{"by title", TaskFilter{SortBy: SortByTitle}, []int{1, 3, 4, 2}},
+		{"by due date, undated last", TaskFilter{SortBy: SortByDueDate}, []int{1, 4, 2, 3}},
+		{"by due date descending, undated last", TaskFilter{SortBy: SortByDueDate, Desc: true}, []int{2, 4, 1, 3}},
+		{"limit", TaskFilter{Limit: 2}, []int{1, 2}},
+		{"offset and limit", TaskFilter{Offset: 1, Limit: 2}, []int{2, 3}},
+		{"offset past end", TaskFilter{Offset: 10}, []int{}},
+		{"sorted page", TaskFilter{SortBy: SortByTitle, Offset: 2, Limit: 5}, []int{4, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := tm.ListTasks(tt.filter)
+			if err != nil {
+				t.Fatalf("ListTasks failed: %v", err)
+			}
+			assertTaskIDs(t, tasks, tt.expected)
+		})
+	}
+}
+
+func assertTaskIDs(t *testing.T, tasks []Task, expected []int) {
+	t.Helper()
+	if tasks == nil {
+		t.Fatal("ListTasks returned nil slice")
+	}
+	if len(tasks) != len(expected) {
+		t.Fatalf("Expected tasks %v, got %d tasks", expected, len(tasks))
+	}
+	for i, task := range tasks {
+		if task.ID != expected[i] {
+			t.Errorf("tasks[%d].ID = %d, want %d", i, task.ID, expected[i])
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tm, _ := newFilterFixture(t)
+
+	tests := []struct {
+		expr     string
+		expected []int
+	}{
+		{"", []int{1, 2, 3, 4}},
+		{"done:false", []int{1, 2, 3}},
+		{"tag:home,shopping", []int{1}},
+		{"tag:home priority:high", []int{4}},
+		{"overdue:true", []int{1}},
+		{"assignee:alice", []int{2}},
+		{"kitchen", []int{3}},
+		{"quarterly numbers", []int{2}},
+		{"sort:-priority limit:2", []int{4, 2}},
+		{"sort:due", []int{1, 4, 2, 3}},
+		{"tag:home sort:title desc:true offset:1", []int{3, 1}},
+		{"parent:0 done:true", []int{4}},
+		{"see http://example.com", []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseFilter failed: %v", err)
+			}
+			tasks, err := tm.ListTasks(filter)
+			if err != nil {
+				t.Fatalf("ListTasks failed: %v", err)
+			}
+			assertTaskIDs(t, tasks, tt.expected)
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{"done:maybe", "priority:urgent", "sort:color", "limit:-1", "parent:x"} {
+		if _, err := ParseFilter(expr); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q): expected ErrInvalidFilter, got %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package taskmanager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// History errors
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// DefaultUndoLimit is the number of operations Undo can step back by default
+const DefaultUndoLimit = 100
+
+// EventType is the kind of change an Event records
+type EventType string
+
+// Event types
+const (
+	EventAdd      EventType = "add"
+	EventUpdate   EventType = "update"
+	EventComplete EventType = "complete"
+	EventDelete   EventType = "delete"
+)
+
+// Event records a single change to a task. Before is nil for additions and After is nil for
+// deletions, so replaying After (or deleting when it is nil) rebuilds the state.
+type Event struct {
+	Seq    int       `json:"seq"`
+	Op     int       `json:"op"` // Events recorded by the same call share an Op and are undone together
+	Type   EventType `json:"type"`
+	TaskID int       `json:"task_id"`
+	Actor  string    `json:"actor,omitempty"`
+	Time   time.Time `json:"time"`
+	Before *Task     `json:"before,omitempty"`
+	After  *Task     `json:"after,omitempty"`
+	UndoOf int       `json:"undo_of,omitempty"` // Op reverted by this event
+	RedoOf int       `json:"redo_of,omitempty"` // Op re-applied by this event
+}
+
+// EventLog is an append-only record of task events
+type EventLog interface {
+	Append(events ...Event) error
+	Events() ([]Event, error)
+}
+
+// MemoryEventLog keeps events in a slice
+type MemoryEventLog struct {
+	mutex  sync.RWMutex
+	events []Event
+}
+
+// NewMemoryEventLog creates an empty in-memory event log
+func NewMemoryEventLog() *MemoryEventLog {
+	return &MemoryEventLog{}
+}
+
+// Append adds events to the end of the log
+func (l *MemoryEventLog) Append(events ...Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.events = append(l.events, events...)
+	return nil
+}
+
+// Events returns a copy of all events in order
+func (l *MemoryEventLog) Events() ([]Event, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return append([]Event(nil), l.events...), nil
+}
+
+// FileEventLog appends events to a JSON-lines file, syncing after every append
+type FileEventLog struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// NewFileEventLog opens the event log at path; the file is created on the first append
+func NewFileEventLog(path string) *FileEventLog {
+	return &FileEventLog{path: path}
+}
+
+// Append writes events to the end of the file
+func (l *FileEventLog) Append(events ...Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("write event log: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write event log: %w", err)
+	}
+	return f.Sync()
+}
+
+// Events reads all events from the file
+func (l *FileEventLog) Events() ([]Event, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			return nil, fmt.Errorf("decode event log: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// history is the undo/redo state shared by a TaskManager and its actor views
+type history struct {
+	log     EventLog
+	nextSeq int
+	nextOp  int
+	undo    [][]Event // Most recent operation last
+	redo    [][]Event
+	limit   int
+}
+
+func newHistory(log EventLog) *history {
+	return &history{log: log, nextSeq: 1, nextOp: 1, limit: DefaultUndoLimit}
+}
+
+// NewTaskManagerFromLog rebuilds a manager by replaying every event of log into store,
+// then keeps recording new events to the same log. Replaying is idempotent, so store may
+// already contain the state the log describes.
+func NewTaskManagerFromLog(store Store, log EventLog) (*TaskManager, error) {
+	events, err := log.Events()
+	if err != nil {
+		return nil, err
+	}
+	if err := Replay(store, events); err != nil {
+		return nil, err
+	}
+
+	tm := NewTaskManagerWithStore(store)
+	tm.history = newHistory(log)
+	if n := len(events); n > 0 {
+		tm.history.nextSeq = events[n-1].Seq + 1
+		tm.history.nextOp = events[n-1].Op + 1
+	}
+	return tm, nil
+}
+
+// Replay applies events to store in order
+func Replay(store Store, events []Event) error {
+	for _, event := range events {
+		if event.After != nil {
+			if err := store.Put(*event.After); err != nil {
+				return fmt.Errorf("replay event %d: %w", event.Seq, err)
+			}
+			continue
+		}
+		if err := store.Delete(event.TaskID); err != nil && !errors.Is(err, ErrTaskNotFound) {
+			return fmt.Errorf("replay event %d: %w", event.Seq, err)
+		}
+	}
+	return nil
+}
+
+// SetUndoLimit changes how many operations Undo can step back, dropping older ones
+func (tm *TaskManager) SetUndoLimit(limit int) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.history.limit = limit
+	tm.history.trim()
+}
+
+// History returns every recorded event for the task with the given ID, oldest first
+func (tm *TaskManager) History(id int) ([]Event, error) {
+	events, err := tm.history.log.Events()
+	if err != nil {
+		return nil, err
+	}
+	result := []Event{}
+	for _, event := range events {
+		if event.TaskID == id {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+// Undo reverts the most recent operation that has not been undone yet.
+// Undo and redo are shared by all actors of the manager.
+func (tm *TaskManager) Undo() error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	h := tm.history
+	if len(h.undo) == 0 {
+		return ErrNothingToUndo
+	}
+	op := h.undo[len(h.undo)-1]
+
+	changes := make([]change, 0, len(op))
+	for i := len(op) - 1; i >= 0; i-- {
+		changes = append(changes, change{id: op[i].TaskID, expected: op[i].After, target: op[i].Before})
+	}
+	events, err := tm.restoreAll(changes)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].UndoOf = op[len(op)-1-i].Op
+	}
+	if err := tm.appendEvents(events); err != nil {
+		return err
+	}
+	h.undo = h.undo[:len(h.undo)-1]
+	h.redo = append(h.redo, op)
+	return nil
+}
+
+// Redo re-applies the most recently undone operation
+func (tm *TaskManager) Redo() error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	h := tm.history
+	if len(h.redo) == 0 {
+		return ErrNothingToRedo
+	}
+	op := h.redo[len(h.redo)-1]
+
+	changes := make([]change, 0, len(op))
+	for _, original := range op {
+		changes = append(changes, change{id: original.TaskID, expected: original.Before, target: original.After, anyContent: true})
+	}
+	events, err := tm.restoreAll(changes)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].RedoOf = op[i].Op
+	}
+	if err := tm.appendEvents(events); err != nil {
+		return err
+	}
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, events)
+	h.trim()
+	return nil
+}
+
+// change moves a task from the expected state to target, nil meaning deleted
+type change struct {
+	id               int
+	expected, target *Task
+	anyContent       bool // Only whether the task exists must match expected
+}
+
+// restoreAll applies the changes of one undo or redo as a unit. Every change is checked
+// against the store before anything is written, so a conflict leaves the store untouched,
+// and if a write fails the changes already written are rolled back.
+// Versions and update times are ignored when comparing with expected, as earlier
+// undos and redos bump them.
+func (tm *TaskManager) restoreAll(changes []change) ([]Event, error) {
+	// The state each task will be in once the changes before it are applied
+	pending := make(map[int]*Task)
+	for _, c := range changes {
+		current, ok := pending[c.id]
+		if !ok {
+			task, err := tm.store.Get(c.id)
+			if err != nil && !errors.Is(err, ErrTaskNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				current = &task
+			}
+		}
+		if (current != nil) != (c.expected != nil) ||
+			current != nil && !c.anyContent && !sameContent(*current, *c.expected) {
+			return nil, ErrConflict
+		}
+		pending[c.id] = c.target
+	}
+
+	events := make([]Event, 0, len(changes))
+	for _, c := range changes {
+		event, err := tm.restore(c.id, c.target)
+		if err != nil {
+			tm.rollback(events)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// restore moves task id to target, bumping the version so optimistic updates based
+// on the old state fail
+func (tm *TaskManager) restore(id int, target *Task) (Event, error) {
+	current, err := tm.store.Get(id)
+	exists := err == nil
+	if err != nil && !errors.Is(err, ErrTaskNotFound) {
+		return Event{}, err
+	}
+
+	event := Event{TaskID: id}
+	if exists {
+		event.Before = &current
+	}
+	if target == nil {
+		event.Type = EventDelete
+		return event, tm.store.Delete(id)
+	}
+
+	restored := target.clone()
+	restored.UpdatedAt = tm.now()
+	restored.Version = 1
+	if exists {
+		restored.Version = current.Version + 1
+	} else if target.Version > 0 {
+		restored.Version = target.Version + 1
+	}
+	if err := tm.store.Put(restored); err != nil {
+		return Event{}, err
+	}
+	event.After = &restored
+	event.Type = EventUpdate
+	if !exists {
+		event.Type = EventAdd
+	}
+	return event, nil
+}
+
+// rollback reverts the writes described by events, newest first, after a later write of
+// the same operation, or appending its events to the log, failed. It is best effort: the write that failed has already left
+// the store in doubt.
+func (tm *TaskManager) rollback(events []Event) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if before := events[i].Before; before != nil {
+			tm.store.Put(*before)
+		} else {
+			tm.store.Delete(events[i].TaskID)
+		}
+	}
+}
+
+// record stores the events of one operation and makes it the next one to undo.
+// Callers must hold tm.mutex.
+func (tm *TaskManager) record(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := tm.appendEvents(events); err != nil {
+		return err
+	}
+	h := tm.history
+	h.undo = append(h.undo, events)
+	h.redo = nil
+	h.trim()
+	return nil
+}
+
+// appendEvents stamps events with sequence numbers, a shared op, the actor and the time,
+// and appends them to the log. The events have already been written to the store, so if
+// the log rejects them they are rolled back and the store keeps matching the log.
+func (tm *TaskManager) appendEvents(events []Event) error {
+	h := tm.history
+	now := tm.now()
+	for i := range events {
+		events[i].Seq = h.nextSeq + i
+		events[i].Op = h.nextOp
+		events[i].Actor = tm.actor
+		events[i].Time = now
+	}
+	if err := h.log.Append(events...); err != nil {
+		tm.rollback(events)
+		return err
+	}
+	h.nextSeq += len(events)
+	h.nextOp++
+	return nil
+}
+
+// sameContent reports whether a and b are equal apart from their version, update time
+// and the time zone their times are stored in
+func sameContent(a, b Task) bool {
+	ja, errA := json.Marshal(comparableTask(a))
+	jb, errB := json.Marshal(comparableTask(b))
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// comparableTask normalizes the fields sameContent ignores
+func comparableTask(task Task) Task {
+	task = task.clone()
+	task.Version = 0
+	task.UpdatedAt = time.Time{}
+	task.CreatedAt = task.CreatedAt.UTC()
+	for _, t := range []*time.Time{task.DueDate, task.CompletedAt} {
+		if t != nil {
+			*t = t.UTC()
+		}
+	}
+	if task.Recurrence != nil && task.Recurrence.Until != nil {
+		*task.Recurrence.Until = task.Recurrence.Until.UTC()
+	}
+	return task
+}
+
+func (h *history) trim() {
+	if h.limit >= 0 && len(h.undo) > h.limit {
+		h.undo = append([][]Event(nil), h.undo[len(h.undo)-h.limit:]...)
+	}
+}
+
+// taskEvent builds the event for a change of one task from before to after
+func taskEvent(typ EventType, before, after *Task) Event {
+	event := Event{Type: typ}
+	if before != nil {
+		b := before.clone()
+		event.Before = &b
+		event.TaskID = b.ID
+	}
+	if after != nil {
+		a := after.clone()
+		event.After = &a
+		event.TaskID = a.ID
+	}
+	return event
+}
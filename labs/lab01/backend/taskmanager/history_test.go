@@ -0,0 +1,436 @@
+package taskmanager
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	tm := NewTaskManager()
+	alice := tm.WithActor("alice")
+	bob := tm.WithActor("bob")
+
+	task, err := alice.AddTask("Write report", "")
+	if err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+	title := "Write final report"
+	if _, err := bob.PatchTask(task.ID, TaskPatch{Title: &title}); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+	if err := alice.UpdateTask(task.ID, title, "", true); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if err := bob.DeleteTask(task.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if _, err := tm.AddTask("Unrelated", ""); err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+
+	events, err := tm.History(task.ID)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	expected := []struct {
+		typ   EventType
+		actor string
+	}{
+		{EventAdd, "alice"},
+		{EventUpdate, "bob"},
+		{EventComplete, "alice"},
+		{EventDelete, "bob"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+	for i, want := range expected {
+		if events[i].Type != want.typ || events[i].Actor != want.actor {
+			t.Errorf("Event %d: expected %s by %s, got %s by %s", i, want.typ, want.actor, events[i].Type, events[i].Actor)
+		}
+	}
+	if events[1].Before.Title != "Write report" || events[1].After.Title != title {
+		t.Errorf("Expected update from %q to %q, got %q to %q", "Write report", title, events[1].Before.Title, events[1].After.Title)
+	}
+	if events[3].After != nil {
+		t.Error("Expected delete event without an after state")
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	tm := NewTaskManager()
+	if err := tm.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+	if err := tm.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+
+	task, _ := tm.AddTask("Task", "")
+	if err := tm.UpdateTask(task.ID, "Renamed", "", false); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if err := tm.DeleteTask(task.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+
+	// Undo the delete, then the rename, then the add
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo delete: %v", err)
+	}
+	got, err := tm.GetTask(task.ID)
+	if err != nil || got.Title != "Renamed" {
+		t.Fatalf("Expected restored task %q, got %+v (%v)", "Renamed", got, err)
+	}
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo update: %v", err)
+	}
+	if got, _ := tm.GetTask(task.ID); got.Title != "Task" {
+		t.Errorf("Expected title %q, got %q", "Task", got.Title)
+	}
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo add: %v", err)
+	}
+	if _, err := tm.GetTask(task.ID); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected ErrTaskNotFound, got %v", err)
+	}
+
+	// Redo everything back
+	for i := 0; i < 3; i++ {
+		if err := tm.Redo(); err != nil {
+			t.Fatalf("Redo %d: %v", i, err)
+		}
+	}
+	if _, err := tm.GetTask(task.ID); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected task deleted again, got %v", err)
+	}
+	if err := tm.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+}
+
+func TestUndoBumpsVersion(t *testing.T) {
+	tm := NewTaskManager()
+	task, _ := tm.AddTask("Task", "")
+	title := "Renamed"
+	updated, _ := tm.PatchTask(task.ID, TaskPatch{Title: &title})
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+
+	// An update based on the undone state must not silently overwrite the restored one
+	if err := tm.UpdateTaskIfVersion(task.ID, updated.Version, "Stale", "", false); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+	got, _ := tm.GetTask(task.ID)
+	if got.Version <= updated.Version {
+		t.Errorf("Expected version above %d, got %d", updated.Version, got.Version)
+	}
+}
+
+func TestNewOperationClearsRedo(t *testing.T) {
+	tm := NewTaskManager()
+	tm.AddTask("First", "")
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	tm.AddTask("Second", "")
+	if err := tm.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Expected ErrNothingToRedo, got %v", err)
+	}
+}
+
+func TestUndoCascadeAsOneOperation(t *testing.T) {
+	tm := NewTaskManager()
+	tm.SetCompletionPolicy(CascadeCompletion)
+	parent, _ := tm.AddTask("Parent", "")
+	parentID := parent.ID
+	child, _ := tm.CreateTask(Task{Title: "Child", ParentID: parentID})
+
+	done := true
+	if _, err := tm.PatchTask(parentID, TaskPatch{Done: &done}); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	for _, id := range []int{parentID, child.ID} {
+		if got, _ := tm.GetTask(id); got.Done || got.CompletedAt != nil {
+			t.Errorf("Expected task %d pending after undo, got %+v", id, got)
+		}
+	}
+}
+
+func TestUndoConflictChangesNothing(t *testing.T) {
+	due := time.Date(2025, 6, 2, 18, 0, 0, 0, time.UTC)
+	tm := NewTaskManager()
+	rule, _ := ParseRecurrence("FREQ=WEEKLY")
+	chore, _ := tm.CreateTask(Task{Title: "Take out trash", DueDate: &due, Recurrence: rule})
+	if err := tm.UpdateTask(chore.ID, chore.Title, "", true); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+
+	// Change the completed task behind the manager's back
+	edited, _ := tm.store.Get(chore.ID)
+	edited.Title = "Take out recycling"
+	tm.store.Update(edited)
+
+	for i := 0; i < 2; i++ {
+		if err := tm.Undo(); !errors.Is(err, ErrConflict) {
+			t.Fatalf("Expected ErrConflict, got %v", err)
+		}
+	}
+	if tasks, _ := tm.ListTasks(TaskFilter{}); len(tasks) != 2 {
+		t.Errorf("Expected the spawned occurrence to survive the failed undo, got %+v", tasks)
+	}
+
+	// Once the conflicting edit is reverted the operation can still be undone
+	edited.Title = chore.Title
+	tm.store.Update(edited)
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if tasks, _ := tm.ListTasks(TaskFilter{}); len(tasks) != 1 || tasks[0].Done {
+		t.Errorf("Expected only the pending original task, got %+v", tasks)
+	}
+}
+
+// failingStore fails the write (Create, Update or Put) after the next n, once
+type failingStore struct {
+	*MemoryStore
+	n int
+}
+
+func (s *failingStore) fail() error {
+	s.n--
+	if s.n == -1 {
+		return errors.New("disk full")
+	}
+	return nil
+}
+
+func (s *failingStore) Create(task Task) (Task, error) {
+	if err := s.fail(); err != nil {
+		return Task{}, err
+	}
+	return s.MemoryStore.Create(task)
+}
+
+func (s *failingStore) Update(task Task) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Update(task)
+}
+
+func (s *failingStore) Put(task Task) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Put(task)
+}
+
+func TestUndoRollsBackFailedWrite(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), n: -1}
+	tm := NewTaskManagerWithStore(store)
+	tm.SetCompletionPolicy(CascadeCompletion)
+	parent, _ := tm.AddTask("Parent", "")
+	tm.CreateTask(Task{Title: "Child", ParentID: parent.ID})
+	done := true
+	if _, err := tm.PatchTask(parent.ID, TaskPatch{Done: &done}); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+
+	store.n = 1
+	if err := tm.Undo(); err == nil {
+		t.Fatal("Expected the failed write to fail Undo")
+	}
+	tasks, _ := tm.ListTasks(TaskFilter{})
+	for _, task := range tasks {
+		if !task.Done {
+			t.Errorf("Expected task %d still done after the rollback, got %+v", task.ID, task)
+		}
+	}
+}
+
+// failingLog rejects every append while fail is set
+type failingLog struct {
+	*MemoryEventLog
+	fail bool
+}
+
+func (l *failingLog) Append(events ...Event) error {
+	if l.fail {
+		return errors.New("disk full")
+	}
+	return l.MemoryEventLog.Append(events...)
+}
+
+func TestFailedAppendRevertsStore(t *testing.T) {
+	log := &failingLog{MemoryEventLog: NewMemoryEventLog()}
+	tm, err := NewTaskManagerFromLog(NewMemoryStore(), log)
+	if err != nil {
+		t.Fatalf("NewTaskManagerFromLog: %v", err)
+	}
+	kept, _ := tm.AddTask("Kept", "")
+	removed, _ := tm.AddTask("Removed", "")
+	tm.DeleteTask(removed.ID)
+	want, _ := tm.ListTasks(TaskFilter{})
+
+	log.fail = true
+	done := true
+	operations := map[string]func() error{
+		"add":    func() error { _, err := tm.AddTask("New", ""); return err },
+		"patch":  func() error { _, err := tm.PatchTask(kept.ID, TaskPatch{Done: &done}); return err },
+		"delete": func() error { return tm.DeleteTask(kept.ID) },
+		"undo":   tm.Undo,
+	}
+	for name, op := range operations {
+		if err := op(); err == nil {
+			t.Errorf("%s: expected the failed append to fail the operation", name)
+		}
+		got, _ := tm.ListTasks(TaskFilter{})
+		if len(got) != len(want) || got[0].Done || got[0].Version != want[0].Version {
+			t.Errorf("%s: expected the store reverted to %+v, got %+v", name, want, got)
+		}
+	}
+
+	// The log still describes the store
+	rebuilt, err := NewTaskManagerFromLog(NewMemoryStore(), log)
+	if err != nil {
+		t.Fatalf("NewTaskManagerFromLog: %v", err)
+	}
+	got, _ := rebuilt.ListTasks(TaskFilter{})
+	if len(got) != 1 || !sameContent(got[0], want[0]) {
+		t.Errorf("Expected the log to rebuild %+v, got %+v", want, got)
+	}
+}
+
+func TestUndoImport(t *testing.T) {
+	source := newTransferFixture(t)
+	var buf bytes.Buffer
+	if err := source.Export(&buf, FormatJSON); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	tm := NewTaskManager()
+	report, err := tm.Import(&buf, FormatJSON, ImportOptions{})
+	if err != nil || report.Imported == 0 {
+		t.Fatalf("Import: %+v, %v", report, err)
+	}
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	tasks, _ := tm.ListTasks(TaskFilter{})
+	if len(tasks) != 0 {
+		t.Errorf("Expected undo to remove all %d imported tasks, %d left", report.Imported, len(tasks))
+	}
+}
+
+func TestUndoLimit(t *testing.T) {
+	tm := NewTaskManager()
+	tm.SetUndoLimit(2)
+	for _, title := range []string{"One", "Two", "Three"} {
+		tm.AddTask(title, "")
+	}
+	for i := 0; i < 2; i++ {
+		if err := tm.Undo(); err != nil {
+			t.Fatalf("Undo %d: %v", i, err)
+		}
+	}
+	if err := tm.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected ErrNothingToUndo, got %v", err)
+	}
+	tasks, _ := tm.ListTasks(TaskFilter{})
+	if len(tasks) != 1 || tasks[0].Title != "One" {
+		t.Errorf("Expected only %q left, got %+v", "One", tasks)
+	}
+}
+
+func TestNewTaskManagerFromLog(t *testing.T) {
+	logs := map[string]func(t *testing.T) EventLog{
+		"memory": func(t *testing.T) EventLog { return NewMemoryEventLog() },
+		"file": func(t *testing.T) EventLog {
+			return NewFileEventLog(filepath.Join(t.TempDir(), "events.jsonl"))
+		},
+	}
+	for name, open := range logs {
+		t.Run(name, func(t *testing.T) {
+			log := open(t)
+			tm, err := NewTaskManagerFromLog(NewMemoryStore(), log)
+			if err != nil {
+				t.Fatalf("NewTaskManagerFromLog: %v", err)
+			}
+			first, _ := tm.AddTask("First", "")
+			second, _ := tm.AddTask("Second", "")
+			tm.UpdateTask(first.ID, "First, renamed", "", true)
+			tm.DeleteTask(second.ID)
+			tm.AddTask("Third", "")
+			tm.Undo()
+			expected, _ := tm.ListTasks(TaskFilter{})
+
+			rebuilt, err := NewTaskManagerFromLog(NewMemoryStore(), log)
+			if err != nil {
+				t.Fatalf("NewTaskManagerFromLog: %v", err)
+			}
+			got, _ := rebuilt.ListTasks(TaskFilter{})
+			if len(got) != len(expected) {
+				t.Fatalf("Expected %d tasks, got %d", len(expected), len(got))
+			}
+			for i := range expected {
+				if got[i].ID != expected[i].ID || got[i].Title != expected[i].Title ||
+					got[i].Done != expected[i].Done || got[i].Version != expected[i].Version {
+					t.Errorf("Expected %+v, got %+v", expected[i], got[i])
+				}
+			}
+
+			// New tasks continue after the replayed IDs and events after the replayed sequence
+			fourth, _ := rebuilt.AddTask("Fourth", "")
+			if fourth.ID <= second.ID {
+				t.Errorf("Expected new ID above %d, got %d", second.ID, fourth.ID)
+			}
+			events, _ := log.Events()
+			for i := 1; i < len(events); i++ {
+				if events[i].Seq != events[i-1].Seq+1 {
+					t.Fatalf("Expected consecutive sequence numbers, got %d after %d", events[i].Seq, events[i-1].Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoRedoWithSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+	tm := NewTaskManagerWithStore(store)
+
+	// The store returns times in UTC, which must not look like a concurrent change
+	due := time.Now().In(time.FixedZone("UTC+3", 3*60*60)).Add(time.Hour)
+	task, err := tm.CreateTask(Task{Title: "Task", DueDate: &due, Tags: []string{"work"}})
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	title := "Renamed"
+	if _, err := tm.PatchTask(task.ID, TaskPatch{Title: &title}); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+	if err := tm.DeleteTask(task.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := tm.Undo(); err != nil {
+			t.Fatalf("Undo %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := tm.Redo(); err != nil {
+			t.Fatalf("Redo %d: %v", i, err)
+		}
+	}
+}
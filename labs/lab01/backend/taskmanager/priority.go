@@ -0,0 +1,69 @@
+package taskmanager
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPriority is returned for priorities outside the known levels
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// Priority is the urgency of a task; higher values are more urgent
+type Priority int
+
+// Priority levels
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityNames = [...]string{"none", "low", "medium", "high"}
+
+// String returns the lowercase name of the priority
+func (p Priority) String() string {
+	if p < PriorityNone || p > PriorityHigh {
+		return "invalid"
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority converts a priority name (case-insensitive) into a Priority; an empty string means PriorityNone
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return PriorityNone, nil
+	}
+	for i, name := range priorityNames {
+		if s == name {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNone, ErrInvalidPriority
+}
+
+// MarshalText encodes the priority by name so it reads well in JSON
+func (p Priority) MarshalText() ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority name
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+func (p Priority) validate() error {
+	if p < PriorityNone || p > PriorityHigh {
+		return ErrInvalidPriority
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package taskmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  Priority
+		expectErr bool
+	}{
+		{"", PriorityNone, false},
+		{"none", PriorityNone, false},
+		{"low", PriorityLow, false},
+		{"Medium", PriorityMedium, false},
+		{" HIGH ", PriorityHigh, false},
+		{"urgent", PriorityNone, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePriority(tt.input)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidPriority) {
+					t.Errorf("Expected ErrInvalidPriority, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("ParsePriority(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPriorityJSON(t *testing.T) {
+	data, err := json.Marshal(struct{ P Priority }{PriorityMedium})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"P":"medium"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+
+	var decoded struct{ P Priority }
+	if err := json.Unmarshal([]byte(`{"P":"high"}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.P != PriorityHigh {
+		t.Errorf("Expected PriorityHigh, got %v", decoded.P)
+	}
+	if err := json.Unmarshal([]byte(`{"P":"bogus"}`), &decoded); err == nil {
+		t.Error("Expected error for unknown priority")
+	}
+	if _, err := json.Marshal(Priority(42)); err == nil {
+		t.Error("Expected error marshalling out-of-range priority")
+	}
+}
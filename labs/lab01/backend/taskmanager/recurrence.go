@@ -0,0 +1,338 @@
+package taskmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRecurrence is returned for recurrence rules outside the supported RRULE subset
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+// Frequency is the base period of a recurrence rule
+type Frequency int
+
+// Supported frequencies
+const (
+	Daily Frequency = iota + 1
+	Weekly
+	Monthly
+)
+
+var frequencyNames = map[Frequency]string{Daily: "DAILY", Weekly: "WEEKLY", Monthly: "MONTHLY"}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// untilLayouts are the RFC 5545 DATE-TIME (UTC) and DATE forms accepted for UNTIL
+var untilLayouts = []string{"20060102T150405Z", "20060102"}
+
+// maxPeriods bounds the search for the next occurrence of rules that rarely or never match
+const maxPeriods = 100000
+
+// Recurrence is a subset of an RFC 5545 RRULE: FREQ (DAILY, WEEKLY, MONTHLY),
+// INTERVAL, BYDAY (plain weekdays), BYMONTHDAY, COUNT and UNTIL.
+// Occurrences are generated from a start time, normally the task's due date.
+type Recurrence struct {
+	Freq       Frequency
+	Interval   int            // Number of periods between occurrences, 0 means 1
+	ByDay      []time.Weekday // Restrict DAILY and WEEKLY rules to these weekdays
+	ByMonthDay []int          // MONTHLY: days of the month, negative values count from the end
+	Count      int            // Occurrences left including the current one, 0 means unlimited
+	Until      *time.Time     // No occurrences after this instant
+}
+
+// ParseRecurrence parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH",
+// with or without the "RRULE:" prefix
+func ParseRecurrence(s string) (*Recurrence, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalidRecurrence)
+	}
+
+	r := &Recurrence{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRecurrence, part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq, err = parseFrequency(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(value)
+		case "COUNT":
+			r.Count, err = parsePositive(value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseWeekdays(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseMonthDays(value)
+		default:
+			err = fmt.Errorf("unsupported part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+		}
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// String formats the rule as an RRULE value without the "RRULE:" prefix
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + frequencyNames[r.Freq]}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = weekdayNames[d]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayouts[0]))
+	}
+	return strings.Join(parts, ";")
+}
+
+// MarshalText encodes the rule as an RRULE value
+func (r *Recurrence) MarshalText() ([]byte, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes an RRULE value
+func (r *Recurrence) UnmarshalText(text []byte) error {
+	parsed, err := ParseRecurrence(string(text))
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+// Next returns the first occurrence of a series starting at start that falls strictly after after.
+// It returns false when the series has ended.
+func (r *Recurrence) Next(start, after time.Time) (time.Time, bool) {
+	interval := max(r.Interval, 1)
+	for period := 0; period < maxPeriods; period++ {
+		for _, c := range r.candidates(start, period*interval) {
+			if !c.After(start) || !c.After(after) {
+				continue
+			}
+			if r.Until != nil && c.After(*r.Until) {
+				return time.Time{}, false
+			}
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// candidates returns the occurrences in the period offset periods after the one containing start,
+// in ascending order
+func (r *Recurrence) candidates(start time.Time, offset int) []time.Time {
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, offset)
+		if len(r.ByDay) > 0 && !containsWeekday(r.ByDay, day.Weekday()) {
+			return nil
+		}
+		return []time.Time{day}
+
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{start.AddDate(0, 0, 7*offset)}
+		}
+		monday := start.AddDate(0, 0, -mondayIndex(start.Weekday())+7*offset)
+		days := make([]time.Time, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			days = append(days, monday.AddDate(0, 0, mondayIndex(wd)))
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+		return days
+
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(offset), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		last := first.AddDate(0, 1, -1).Day()
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{start.Day()}
+		}
+		days := make([]time.Time, 0, len(monthDays))
+		for _, d := range monthDays {
+			if d < 0 {
+				d = last + 1 + d
+			}
+			if d < 1 || d > last { // e.g. the 31st in a 30-day month is skipped, as RFC 5545 requires
+				continue
+			}
+			days = append(days, first.AddDate(0, 0, d-1))
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+		return days
+	}
+	return nil
+}
+
+// nextOccurrence returns the copy of a recurring task that should follow it once completed,
+// or false if the series has ended. Missed occurrences before now are skipped.
+func (t Task) nextOccurrence(now time.Time) (Task, bool) {
+	r := t.Recurrence
+	if r == nil || r.Count == 1 {
+		return Task{}, false
+	}
+	start := now
+	if t.DueDate != nil {
+		start = *t.DueDate
+	}
+	after := start
+	if now.After(after) {
+		after = now
+	}
+	due, ok := r.Next(start, after)
+	if !ok {
+		return Task{}, false
+	}
+
+	next := t.clone()
+	next.ID = 0
+	next.Done = false
+	next.DueDate = &due
+	next.CompletedAt = nil
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	next.Version = 1
+	if next.Recurrence.Count > 0 {
+		next.Recurrence.Count--
+	}
+	return next, true
+}
+
+func (r *Recurrence) validate() error {
+	if _, ok := frequencyNames[r.Freq]; !ok {
+		return fmt.Errorf("%w: FREQ must be DAILY, WEEKLY or MONTHLY", ErrInvalidRecurrence)
+	}
+	if r.Interval < 0 || r.Count < 0 {
+		return fmt.Errorf("%w: INTERVAL and COUNT must be positive", ErrInvalidRecurrence)
+	}
+	if r.Count > 0 && r.Until != nil {
+		return fmt.Errorf("%w: COUNT and UNTIL are mutually exclusive", ErrInvalidRecurrence)
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return fmt.Errorf("%w: BYMONTHDAY requires FREQ=MONTHLY", ErrInvalidRecurrence)
+	}
+	if len(r.ByDay) > 0 && r.Freq == Monthly {
+		return fmt.Errorf("%w: BYDAY is not supported with FREQ=MONTHLY", ErrInvalidRecurrence)
+	}
+	for _, d := range r.ByMonthDay {
+		if d == 0 || d < -31 || d > 31 {
+			return fmt.Errorf("%w: BYMONTHDAY out of range", ErrInvalidRecurrence)
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of the rule that shares no slices or pointers with it
+func (r *Recurrence) clone() *Recurrence {
+	c := *r
+	c.ByDay = append([]time.Weekday(nil), r.ByDay...)
+	c.ByMonthDay = append([]int(nil), r.ByMonthDay...)
+	if r.Until != nil {
+		until := *r.Until
+		c.Until = &until
+	}
+	return &c
+}
+
+func parseFrequency(s string) (Frequency, error) {
+	for f, name := range frequencyNames {
+		if strings.EqualFold(s, name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported FREQ %s", s)
+}
+
+func parsePositive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive integer", s)
+	}
+	return n, nil
+}
+
+func parseUntil(s string) (*time.Time, error) {
+	for _, layout := range untilLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("UNTIL %q is not a DATE or UTC DATE-TIME", s)
+}
+
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for i, wd := range weekdayNames {
+			if strings.EqualFold(name, wd) {
+				days = append(days, time.Weekday(i))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unsupported BYDAY value %q", name)
+		}
+	}
+	return days, nil
+}
+
+func parseMonthDays(s string) ([]int, error) {
+	var days []int
+	for _, v := range strings.Split(s, ",") {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("BYMONTHDAY %q is not an integer", v)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func containsWeekday(days []time.Weekday, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// mondayIndex numbers weekdays from Monday (0) to Sunday (6), the RFC 5545 default week start
+func mondayIndex(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
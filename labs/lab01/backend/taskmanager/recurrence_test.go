@@ -0,0 +1,151 @@
+package taskmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		expectErr bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", false},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", false},
+		{"freq=monthly;bymonthday=1,-1;count=6", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=6", false},
+		{"FREQ=DAILY;UNTIL=20250701", "FREQ=DAILY;UNTIL=20250701T000000Z", false},
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", false},
+		{"", "", true},
+		{"FREQ=YEARLY", "", true},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20250701", "", true},
+		{"FREQ=WEEKLY;BYDAY=1MO", "", true},
+		{"FREQ=WEEKLY;BYMONTHDAY=3", "", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", "", true},
+		{"FREQ=DAILY;INTERVAL=0", "", true},
+		{"FREQ=DAILY;BYHOUR=9", "", true},
+		{"INTERVAL=2", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.input)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidRecurrence) {
+					t.Errorf("Expected ErrInvalidRecurrence, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := r.String(); got != tt.expected {
+				t.Errorf("String() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	// Monday 2 June 2025, 09:00
+	start := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	day := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 9, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		after    time.Time
+		expected []time.Time // successive occurrences, each used as the next start
+	}{
+		{"daily", "FREQ=DAILY", start, start, []time.Time{day(6, 3), day(6, 4)}},
+		{"every third day", "FREQ=DAILY;INTERVAL=3", start, start, []time.Time{day(6, 5), day(6, 8)}},
+		{"weekdays only", "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR", day(6, 6), day(6, 6), []time.Time{day(6, 9), day(6, 10)}},
+		{"weekly", "FREQ=WEEKLY", start, start, []time.Time{day(6, 9), day(6, 16)}},
+		{"weekly on days", "FREQ=WEEKLY;BYDAY=TH,MO", start, start, []time.Time{day(6, 5), day(6, 9), day(6, 12)}},
+		{"fortnightly on days", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", start, start, []time.Time{day(6, 4), day(6, 16), day(6, 18)}},
+		{"monthly", "FREQ=MONTHLY", start, start, []time.Time{day(7, 2), day(8, 2)}},
+		{"monthly on the 31st skips short months", "FREQ=MONTHLY", day(5, 31), day(5, 31), []time.Time{day(7, 31), day(8, 31), day(10, 31)}},
+		{"last day of month", "FREQ=MONTHLY;BYMONTHDAY=-1", start, start, []time.Time{day(6, 30), day(7, 31), day(8, 31), day(9, 30)}},
+		{"skips missed occurrences", "FREQ=WEEKLY", start, day(6, 20), []time.Time{day(6, 23)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence failed: %v", err)
+			}
+			current, after := tt.start, tt.after
+			for i, want := range tt.expected {
+				got, ok := r.Next(current, after)
+				if !ok {
+					t.Fatalf("occurrence %d: series ended early", i)
+				}
+				if !got.Equal(want) {
+					t.Fatalf("occurrence %d: got %v, want %v", i, got, want)
+				}
+				current, after = got, got
+			}
+		})
+	}
+
+	t.Run("until", func(t *testing.T) {
+		r, _ := ParseRecurrence("FREQ=DAILY;UNTIL=20250603T090000Z")
+		if got, ok := r.Next(start, start); !ok || !got.Equal(day(6, 3)) {
+			t.Fatalf("Expected %v, got %v (%v)", day(6, 3), got, ok)
+		}
+		if _, ok := r.Next(day(6, 3), day(6, 3)); ok {
+			t.Error("Expected series to end after UNTIL")
+		}
+	})
+}
+
+func TestRecurringTaskSpawnsNextOccurrence(t *testing.T) {
+	now := time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	due := time.Date(2025, 6, 2, 18, 0, 0, 0, time.UTC)
+	tm := NewTaskManager()
+	tm.now = func() time.Time { return now }
+
+	rule, _ := ParseRecurrence("FREQ=WEEKLY;COUNT=2")
+	chore, err := tm.CreateTask(Task{Title: "Take out trash", Tags: []string{"home"}, DueDate: &due, Recurrence: rule})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+
+	if err := tm.UpdateTask(chore.ID, chore.Title, "", true); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	pending := false
+	tasks, _ := tm.ListTasks(TaskFilter{Done: &pending})
+	if len(tasks) != 1 {
+		t.Fatalf("Expected one spawned occurrence, got %+v", tasks)
+	}
+	next := tasks[0]
+	wantDue := due.AddDate(0, 0, 7)
+	if next.ID == chore.ID || next.Title != chore.Title || next.Tags[0] != "home" {
+		t.Errorf("Unexpected spawned task %+v", next)
+	}
+	if next.DueDate == nil || !next.DueDate.Equal(wantDue) {
+		t.Errorf("Expected due date %v, got %v", wantDue, next.DueDate)
+	}
+	if next.Recurrence == nil || next.Recurrence.Count != 1 {
+		t.Errorf("Expected remaining count 1, got %+v", next.Recurrence)
+	}
+
+	// The last occurrence of the series does not spawn another one
+	if err := tm.UpdateTask(next.ID, next.Title, "", true); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	tasks, _ = tm.ListTasks(TaskFilter{Done: &pending})
+	if len(tasks) != 0 {
+		t.Errorf("Expected series to end, got %+v", tasks)
+	}
+
+	// The original task keeps its own rule untouched
+	original, _ := tm.GetTask(chore.ID)
+	if original.Recurrence.Count != 2 {
+		t.Errorf("Original rule was modified: %+v", original.Recurrence)
+	}
+}
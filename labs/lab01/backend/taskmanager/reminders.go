@@ -0,0 +1,96 @@
+package taskmanager
+
+import (
+	"context"
+	"time"
+)
+
+// Reminder is emitted once for every pending task that becomes due soon
+type Reminder struct {
+	Task  Task
+	DueIn time.Duration // Negative if the task was already overdue when first noticed
+}
+
+// ReminderScheduler periodically checks a TaskManager and emits a Reminder
+// when a pending task is due within the lead time
+type ReminderScheduler struct {
+	tm       *TaskManager
+	clock    Clock
+	lead     time.Duration // How long before the due date to remind
+	interval time.Duration // How often to check
+	events   chan Reminder
+	sent     map[int]time.Time // taskID -> due date already reminded about
+}
+
+// NewReminderScheduler creates a scheduler that checks tm every interval and reminds lead before due dates
+func NewReminderScheduler(tm *TaskManager, clock Clock, lead, interval time.Duration) *ReminderScheduler {
+	return &ReminderScheduler{
+		tm:       tm,
+		clock:    clock,
+		lead:     lead,
+		interval: interval,
+		events:   make(chan Reminder, 16),
+		sent:     make(map[int]time.Time),
+	}
+}
+
+// Events returns the channel reminders are delivered on; it is closed when Run returns
+func (s *ReminderScheduler) Events() <-chan Reminder {
+	return s.events
+}
+
+// Run checks for due tasks immediately and then every interval until ctx is cancelled
+func (s *ReminderScheduler) Run(ctx context.Context) error {
+	defer close(s.events)
+	for {
+		if err := s.check(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(s.interval):
+		}
+	}
+}
+
+// check emits reminders for pending tasks due within the lead time that were not reminded about yet.
+// Moving a task's due date makes it eligible for a new reminder.
+func (s *ReminderScheduler) check(ctx context.Context) error {
+	pending := false
+	tasks, err := s.tm.ListTasks(TaskFilter{Done: &pending, SortBy: SortByDueDate})
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	seen := make(map[int]bool, len(tasks))
+	for _, task := range tasks {
+		if task.DueDate == nil {
+			continue
+		}
+		seen[task.ID] = true
+		dueIn := task.DueDate.Sub(now)
+		if dueIn > s.lead {
+			continue
+		}
+		if reminded, ok := s.sent[task.ID]; ok && reminded.Equal(*task.DueDate) {
+			continue
+		}
+
+		select {
+		case s.events <- Reminder{Task: task, DueIn: dueIn}:
+			s.sent[task.ID] = *task.DueDate
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Forget tasks that were completed or deleted
+	for id := range s.sent {
+		if !seen[id] {
+			delete(s.sent, id)
+		}
+	}
+	return nil
+}
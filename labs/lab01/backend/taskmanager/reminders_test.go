@@ -0,0 +1,147 @@
+package taskmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	changed chan struct{} // Signalled whenever a waiter is added
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, changed: make(chan struct{}, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Advance moves the clock forward and fires every waiter whose deadline has passed
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = remaining
+}
+
+// waitForWaiter blocks until some goroutine is sleeping on the clock
+func (c *fakeClock) waitForWaiter(t *testing.T) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		c.mutex.Lock()
+		n := len(c.waiters)
+		c.mutex.Unlock()
+		if n > 0 {
+			return
+		}
+		select {
+		case <-c.changed:
+		case <-deadline:
+			t.Fatal("Scheduler never waited on the clock")
+		}
+	}
+}
+
+func TestReminderScheduler(t *testing.T) {
+	start := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	tm := NewTaskManager()
+	tm.SetClock(clock)
+
+	dueSoon := start.Add(30 * time.Minute)
+	dueLater := start.Add(3 * time.Hour)
+	overdue := start.Add(-time.Hour)
+	soon, _ := tm.CreateTask(Task{Title: "Soon", DueDate: &dueSoon})
+	later, _ := tm.CreateTask(Task{Title: "Later", DueDate: &dueLater})
+	tm.CreateTask(Task{Title: "Overdue but done", DueDate: &overdue, Done: true})
+	tm.AddTask("No due date", "")
+
+	scheduler := NewReminderScheduler(tm, clock, time.Hour, 15*time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- scheduler.Run(ctx) }()
+
+	expectReminder := func(want Task, dueIn time.Duration) {
+		t.Helper()
+		select {
+		case r := <-scheduler.Events():
+			if r.Task.ID != want.ID || r.DueIn != dueIn {
+				t.Errorf("Expected reminder for %q due in %v, got %q due in %v", want.Title, dueIn, r.Task.Title, r.DueIn)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No reminder for %q", want.Title)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		clock.waitForWaiter(t)
+		select {
+		case r := <-scheduler.Events():
+			t.Errorf("Unexpected reminder for %q", r.Task.Title)
+		default:
+		}
+	}
+
+	expectReminder(soon, 30*time.Minute)
+	expectNone()
+
+	// Two hours later the second task enters the lead window; the first is not repeated
+	for i := 0; i < 8; i++ {
+		clock.waitForWaiter(t)
+		clock.Advance(15 * time.Minute)
+	}
+	expectReminder(later, time.Hour)
+	expectNone()
+
+	// Moving the due date makes the task eligible again
+	newDue := clock.Now().Add(10 * time.Minute)
+	tm.PatchTask(soon.ID, TaskPatch{DueDate: &newDue})
+	clock.Advance(15 * time.Minute)
+	expectReminder(soon, -5*time.Minute)
+	expectNone()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if _, ok := <-scheduler.Events(); ok {
+		t.Error("Events channel should be closed after Run returns")
+	}
+}
@@ -0,0 +1,311 @@
+package taskmanager
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const createTasksTable = `
+CREATE TABLE IF NOT EXISTS tasks (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	title        TEXT    NOT NULL,
+	description  TEXT    NOT NULL DEFAULT '',
+	done         INTEGER NOT NULL DEFAULT 0,
+	created_at   TEXT    NOT NULL,
+	version      INTEGER NOT NULL DEFAULT 1,
+	due_date     TEXT,
+	priority     INTEGER NOT NULL DEFAULT 0,
+	tags         TEXT    NOT NULL DEFAULT '[]',
+	assignee     TEXT    NOT NULL DEFAULT '',
+	parent_id    INTEGER NOT NULL DEFAULT 0,
+	updated_at   TEXT    NOT NULL DEFAULT '',
+	completed_at TEXT,
+	recurrence   TEXT    NOT NULL DEFAULT ''
+)`
+
+// taskColumns are added to tasks tables created by older versions of the store
+var taskColumns = []struct{ name, definition string }{
+	{"version", "INTEGER NOT NULL DEFAULT 1"},
+	{"due_date", "TEXT"},
+	{"priority", "INTEGER NOT NULL DEFAULT 0"},
+	{"tags", "TEXT NOT NULL DEFAULT '[]'"},
+	{"assignee", "TEXT NOT NULL DEFAULT ''"},
+	{"parent_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"updated_at", "TEXT NOT NULL DEFAULT ''"},
+	{"completed_at", "TEXT"},
+	{"recurrence", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// selectTasks lists the columns in the order scanTask expects them
+const selectTasks = `SELECT id, title, description, done, created_at, version,
+	due_date, priority, tags, assignee, parent_id, updated_at, completed_at, recurrence FROM tasks`
+
+// SQLiteStore keeps tasks in a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at path and prepares the tasks table
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open task database: %w", err)
+	}
+	if _, err := db.Exec(createTasksTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create tasks table: %w", err)
+	}
+	if err := migrateTasksTable(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate tasks table: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// migrateTasksTable adds any column from taskColumns that the existing table lacks
+func migrateTasksTable(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('tasks')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range taskColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE tasks ADD COLUMN ` + col.name + ` ` + col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create inserts a new task; AUTOINCREMENT guarantees IDs are never reused
+func (s *SQLiteStore) Create(task Task) (Task, error) {
+	args, err := taskArgs(task)
+	if err != nil {
+		return Task{}, err
+	}
+	res, err := s.db.Exec(
+		`INSERT INTO tasks (title, description, done, created_at, version,
+			due_date, priority, tags, assignee, parent_id, updated_at, completed_at, recurrence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		args...,
+	)
+	if err != nil {
+		return Task{}, fmt.Errorf("insert task: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Task{}, fmt.Errorf("insert task: %w", err)
+	}
+	task.ID = int(id)
+	return task, nil
+}
+
+// Update replaces an existing task, returns an error if the task is not found
+func (s *SQLiteStore) Update(task Task) error {
+	args, err := taskArgs(task)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(
+		`UPDATE tasks SET title = ?, description = ?, done = ?, created_at = ?, version = ?,
+			due_date = ?, priority = ?, tags = ?, assignee = ?, parent_id = ?, updated_at = ?, completed_at = ?,
+			recurrence = ?
+		WHERE id = ?`,
+		append(args, task.ID)...,
+	)
+	if err != nil {
+		return fmt.Errorf("update task: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// Put inserts or replaces a task under its own ID
+func (s *SQLiteStore) Put(task Task) error {
+	args, err := taskArgs(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT OR REPLACE INTO tasks (title, description, done, created_at, version,
+			due_date, priority, tags, assignee, parent_id, updated_at, completed_at, recurrence, id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		append(args, task.ID)...,
+	)
+	if err != nil {
+		return fmt.Errorf("put task: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a task, returns an error if the task is not found
+func (s *SQLiteStore) Delete(id int) error {
+	res, err := s.db.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete task: %w", err)
+	}
+	return checkAffected(res)
+}
+
+// Get retrieves a task by ID, returns an error if the task is not found
+func (s *SQLiteStore) Get(id int) (Task, error) {
+	row := s.db.QueryRow(selectTasks+` WHERE id = ?`, id)
+	task, err := scanTask(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, ErrTaskNotFound
+	}
+	if err != nil {
+		return Task{}, fmt.Errorf("get task: %w", err)
+	}
+	return task, nil
+}
+
+// List returns all tasks ordered by ID
+func (s *SQLiteStore) List() ([]Task, error) {
+	rows, err := s.db.Query(selectTasks + ` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list tasks: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// Close closes the database connection
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(sc scanner) (Task, error) {
+	var (
+		task                 Task
+		createdAt, updatedAt string
+		tags, recurrence     string
+		dueDate, completedAt sql.NullString
+	)
+	err := sc.Scan(&task.ID, &task.Title, &task.Description, &task.Done, &createdAt, &task.Version,
+		&dueDate, &task.Priority, &tags, &task.Assignee, &task.ParentID, &updatedAt, &completedAt, &recurrence)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if task.CreatedAt, err = parseTime(createdAt); err != nil {
+		return Task{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	if updatedAt == "" { // row written before updated_at existed
+		task.UpdatedAt = task.CreatedAt
+	} else if task.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return Task{}, fmt.Errorf("parse updated_at: %w", err)
+	}
+	if task.DueDate, err = parseNullTime(dueDate); err != nil {
+		return Task{}, fmt.Errorf("parse due_date: %w", err)
+	}
+	if task.CompletedAt, err = parseNullTime(completedAt); err != nil {
+		return Task{}, fmt.Errorf("parse completed_at: %w", err)
+	}
+	if err := json.Unmarshal([]byte(tags), &task.Tags); err != nil {
+		return Task{}, fmt.Errorf("parse tags: %w", err)
+	}
+	if len(task.Tags) == 0 {
+		task.Tags = nil
+	}
+	if recurrence != "" {
+		if task.Recurrence, err = ParseRecurrence(recurrence); err != nil {
+			return Task{}, fmt.Errorf("parse recurrence: %w", err)
+		}
+	}
+	return task, nil
+}
+
+// taskArgs returns the column values of task in the order used by Create and Update
+func taskArgs(task Task) ([]any, error) {
+	tags, err := json.Marshal(task.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("encode tags: %w", err)
+	}
+	if task.Tags == nil {
+		tags = []byte("[]")
+	}
+	recurrence := ""
+	if task.Recurrence != nil {
+		recurrence = task.Recurrence.String()
+	}
+	return []any{
+		task.Title, task.Description, task.Done, formatTime(task.CreatedAt), task.Version,
+		formatNullTime(task.DueDate), int(task.Priority), string(tags), task.Assignee, task.ParentID,
+		formatTime(task.UpdatedAt), formatNullTime(task.CompletedAt), recurrence,
+	}, nil
+}
+
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatNullTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: formatTime(*t), Valid: true}
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func parseNullTime(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := parseTime(s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,109 @@
+package taskmanager
+
+import "sort"
+
+// Store persists tasks for a TaskManager.
+// Implementations assign IDs starting at 1 and never reuse them, return
+// ErrTaskNotFound for unknown IDs and list tasks ordered by ID.
+// TaskManager serializes writes, so a store only has to tolerate concurrent reads.
+type Store interface {
+	// Create stores a new task, ignoring task.ID, and returns it with its assigned ID
+	Create(task Task) (Task, error)
+	// Update replaces the stored task with the same ID
+	Update(task Task) error
+	// Put stores task under its own ID, inserting or replacing it; used to restore history
+	Put(task Task) error
+	// Delete removes the task with the given ID
+	Delete(id int) error
+	// Get returns the task with the given ID
+	Get(id int) (Task, error)
+	// List returns all tasks ordered by ID
+	List() ([]Task, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// MemoryStore keeps tasks in a map; everything is lost when the process exits
+type MemoryStore struct {
+	tasks  map[int]Task
+	nextID int
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks:  make(map[int]Task),
+		nextID: 1,
+	}
+}
+
+// Create stores a new task and increments the nextID
+func (s *MemoryStore) Create(task Task) (Task, error) {
+	task.ID = s.nextID
+	s.tasks[task.ID] = task.clone()
+	s.nextID++
+	return task, nil
+}
+
+// Update replaces an existing task, returns an error if the task is not found
+func (s *MemoryStore) Update(task Task) error {
+	if _, ok := s.tasks[task.ID]; !ok {
+		return ErrTaskNotFound
+	}
+	s.tasks[task.ID] = task.clone()
+	return nil
+}
+
+// Put inserts or replaces a task under its own ID, keeping nextID ahead of it
+func (s *MemoryStore) Put(task Task) error {
+	s.tasks[task.ID] = task.clone()
+	if task.ID >= s.nextID {
+		s.nextID = task.ID + 1
+	}
+	return nil
+}
+
+// Delete removes a task, returns an error if the task is not found
+func (s *MemoryStore) Delete(id int) error {
+	if _, ok := s.tasks[id]; !ok {
+		return ErrTaskNotFound
+	}
+	delete(s.tasks, id)
+	return nil
+}
+
+// Get retrieves a task by ID, returns an error if the task is not found
+func (s *MemoryStore) Get(id int) (Task, error) {
+	task, ok := s.tasks[id]
+	if !ok {
+		return Task{}, ErrTaskNotFound
+	}
+	return task.clone(), nil
+}
+
+// List returns all tasks ordered by ID
+func (s *MemoryStore) List() ([]Task, error) {
+	tasks := make([]Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task.clone())
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// clone returns a copy of the store that shares no state with it
+func (s *MemoryStore) clone() *MemoryStore {
+	c := &MemoryStore{
+		tasks:  make(map[int]Task, len(s.tasks)),
+		nextID: s.nextID,
+	}
+	for id, task := range s.tasks {
+		c.tasks[id] = task.clone()
+	}
+	return c
+}
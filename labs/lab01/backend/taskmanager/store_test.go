@@ -0,0 +1,293 @@
+package taskmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// storeFactory opens a store; calling it twice with the same t must return
+// a store over the same data for persistent backends
+type storeFactory func(t *testing.T) Store
+
+func TestMemoryStore(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+func TestFileStore(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) Store {
+		s, err := NewFileStore(filepath.Join(t.TempDir(), "tasks.json"))
+		if err != nil {
+			t.Fatalf("NewFileStore: %v", err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) Store {
+		s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tasks.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteStore: %v", err)
+		}
+		return s
+	})
+}
+
+// runStoreConformance checks that a backend behaves exactly like the in-memory store
+func runStoreConformance(t *testing.T, open storeFactory) {
+	t.Run("create assigns sequential IDs", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		for want := 1; want <= 3; want++ {
+			task, err := s.Create(Task{Title: "task", CreatedAt: time.Now()})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if task.ID != want {
+				t.Errorf("Expected ID %d, got %d", want, task.ID)
+			}
+		}
+	})
+
+	t.Run("IDs are not reused after delete", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		first, _ := s.Create(Task{Title: "first", CreatedAt: time.Now()})
+		if err := s.Delete(first.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		second, err := s.Create(Task{Title: "second", CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if second.ID == first.ID {
+			t.Errorf("ID %d was reused", second.ID)
+		}
+	})
+
+	t.Run("get round-trips all fields", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		created := time.Date(2025, 6, 1, 12, 30, 0, 123456789, time.UTC)
+		due := created.Add(48 * time.Hour)
+		completed := created.Add(time.Hour)
+		parent, _ := s.Create(Task{Title: "Parent", CreatedAt: created})
+		task, _ := s.Create(Task{
+			Title:       "Title",
+			Description: "Desc",
+			Done:        true,
+			DueDate:     &due,
+			Priority:    PriorityHigh,
+			Tags:        []string{"home", "chores"},
+			Assignee:    "alice",
+			ParentID:    parent.ID,
+			CreatedAt:   created,
+			UpdatedAt:   completed,
+			CompletedAt: &completed,
+			Recurrence:  &Recurrence{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday}, Count: 3},
+			Version:     7,
+		})
+		got, err := s.Get(task.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Title != "Title" || got.Description != "Desc" || !got.Done || got.Version != 7 {
+			t.Errorf("Unexpected task %+v", got)
+		}
+		if got.Priority != PriorityHigh || got.Assignee != "alice" || got.ParentID != parent.ID {
+			t.Errorf("Unexpected task %+v", got)
+		}
+		if len(got.Tags) != 2 || got.Tags[0] != "home" || got.Tags[1] != "chores" {
+			t.Errorf("Expected tags [home chores], got %v", got.Tags)
+		}
+		if !got.CreatedAt.Equal(created) || !got.UpdatedAt.Equal(completed) {
+			t.Errorf("Expected CreatedAt %v and UpdatedAt %v, got %v and %v", created, completed, got.CreatedAt, got.UpdatedAt)
+		}
+		if got.DueDate == nil || !got.DueDate.Equal(due) {
+			t.Errorf("Expected DueDate %v, got %v", due, got.DueDate)
+		}
+		if got.CompletedAt == nil || !got.CompletedAt.Equal(completed) {
+			t.Errorf("Expected CompletedAt %v, got %v", completed, got.CompletedAt)
+		}
+		if got.Recurrence == nil || got.Recurrence.String() != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;COUNT=3" {
+			t.Errorf("Unexpected recurrence %v", got.Recurrence)
+		}
+
+		plain, _ := s.Get(parent.ID)
+		if plain.DueDate != nil || plain.CompletedAt != nil || plain.Tags != nil || plain.Recurrence != nil {
+			t.Errorf("Expected empty optional fields, got %+v", plain)
+		}
+	})
+
+	t.Run("unknown IDs return ErrTaskNotFound", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		if _, err := s.Get(999); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("Get: expected ErrTaskNotFound, got %v", err)
+		}
+		if err := s.Update(Task{ID: 999, Title: "x"}); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("Update: expected ErrTaskNotFound, got %v", err)
+		}
+		if err := s.Delete(999); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("Delete: expected ErrTaskNotFound, got %v", err)
+		}
+	})
+
+	t.Run("put inserts and replaces under the given ID", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		first, _ := s.Create(Task{Title: "first", CreatedAt: time.Now()})
+		if err := s.Put(Task{ID: first.ID, Title: "replaced", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := s.Put(Task{ID: 5, Title: "restored", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if got, _ := s.Get(first.ID); got.Title != "replaced" {
+			t.Errorf("Expected replaced task, got %+v", got)
+		}
+		if got, err := s.Get(5); err != nil || got.Title != "restored" {
+			t.Errorf("Expected restored task, got %+v (%v)", got, err)
+		}
+		next, _ := s.Create(Task{Title: "next", CreatedAt: time.Now()})
+		if next.ID != 6 {
+			t.Errorf("Expected ID 6 after putting ID 5, got %d", next.ID)
+		}
+	})
+
+	t.Run("list is ordered by ID", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		tasks, err := s.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(tasks) != 0 {
+			t.Errorf("Expected empty list, got %d tasks", len(tasks))
+		}
+		for i := 0; i < 5; i++ {
+			s.Create(Task{Title: "task", CreatedAt: time.Now()})
+		}
+		s.Delete(3)
+		tasks, _ = s.List()
+		want := []int{1, 2, 4, 5}
+		if len(tasks) != len(want) {
+			t.Fatalf("Expected %d tasks, got %d", len(want), len(tasks))
+		}
+		for i, task := range tasks {
+			if task.ID != want[i] {
+				t.Errorf("tasks[%d].ID = %d, want %d", i, task.ID, want[i])
+			}
+		}
+	})
+
+	t.Run("task manager semantics", func(t *testing.T) {
+		tm := NewTaskManagerWithStore(open(t))
+		defer tm.Close()
+		if _, err := tm.AddTask("", "desc"); !errors.Is(err, ErrEmptyTitle) {
+			t.Errorf("AddTask: expected ErrEmptyTitle, got %v", err)
+		}
+		task, err := tm.AddTask("Title", "desc")
+		if err != nil {
+			t.Fatalf("AddTask: %v", err)
+		}
+		if err := tm.UpdateTask(task.ID, "", "desc", false); !errors.Is(err, ErrEmptyTitle) {
+			t.Errorf("UpdateTask: expected ErrEmptyTitle, got %v", err)
+		}
+		if err := tm.UpdateTask(999, "Title", "desc", false); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("UpdateTask: expected ErrTaskNotFound, got %v", err)
+		}
+		if err := tm.UpdateTask(task.ID, "New", "new desc", true); err != nil {
+			t.Fatalf("UpdateTask: %v", err)
+		}
+		done := true
+		if tasks, _ := tm.ListTasks(TaskFilter{Done: &done}); len(tasks) != 1 || tasks[0].Title != "New" {
+			t.Errorf("Unexpected done tasks %+v", tasks)
+		}
+		if err := tm.DeleteTask(task.ID); err != nil {
+			t.Fatalf("DeleteTask: %v", err)
+		}
+		if _, err := tm.GetTask(task.ID); !errors.Is(err, ErrTaskNotFound) {
+			t.Errorf("GetTask: expected ErrTaskNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPersistentStoresSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	backends := []struct {
+		name string
+		open func() (Store, error)
+	}{
+		{"file", func() (Store, error) { return NewFileStore(filepath.Join(dir, "tasks.json")) }},
+		{"sqlite", func() (Store, error) { return NewSQLiteStore(filepath.Join(dir, "tasks.db")) }},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s, err := b.open()
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			tm := NewTaskManagerWithStore(s)
+			tm.AddTask("Task 1", "")
+			tm.AddTask("Task 2", "")
+			tm.DeleteTask(2)
+			if err := tm.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			s, err = b.open()
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			tm = NewTaskManagerWithStore(s)
+			defer tm.Close()
+			if tasks, _ := tm.ListTasks(TaskFilter{}); len(tasks) != 1 || tasks[0].Title != "Task 1" {
+				t.Errorf("Unexpected tasks after reopen: %+v", tasks)
+			}
+			task, err := tm.AddTask("Task 3", "")
+			if err != nil {
+				t.Fatalf("AddTask: %v", err)
+			}
+			if task.ID != 3 {
+				t.Errorf("Expected ID 3 after reopen, got %d", task.ID)
+			}
+		})
+	}
+}
+
+func TestFileStoreLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(filepath.Join(dir, "tasks.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s.Create(Task{Title: "task", CreatedAt: time.Now()})
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "tasks.json" {
+		t.Errorf("Expected only tasks.json, found %v", entries)
+	}
+}
+
+func TestFileStoreRollsBackOnWriteFailure(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "missing", "tasks.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if _, err := s.Create(Task{Title: "task", CreatedAt: time.Now()}); err == nil {
+		t.Fatal("Expected write error for missing directory")
+	}
+	tasks, _ := s.List()
+	if len(tasks) != 0 {
+		t.Errorf("Expected failed create to be rolled back, got %+v", tasks)
+	}
+}
@@ -2,62 +2,435 @@ package taskmanager
 
 import (
 	"errors"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Predefined errors
 var (
-	ErrTaskNotFound = errors.New("task not found")
-	ErrEmptyTitle   = errors.New("title cannot be empty")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrEmptyTitle         = errors.New("title cannot be empty")
+	ErrConflict           = errors.New("task was modified concurrently")
+	ErrInvalidParent      = errors.New("invalid parent task")
+	ErrIncompleteSubtasks = errors.New("task has incomplete subtasks")
+	ErrHasSubtasks        = errors.New("task has subtasks")
 )
 
 // Task represents a single task
 type Task struct {
-	ID          int
-	Title       string
-	Description string
-	Done        bool
-	CreatedAt   time.Time
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Done        bool        `json:"done"`
+	DueDate     *time.Time  `json:"due_date,omitempty"`
+	Priority    Priority    `json:"priority"`
+	Tags        []string    `json:"tags,omitempty"`
+	Assignee    string      `json:"assignee,omitempty"`
+	ParentID    int         `json:"parent_id,omitempty"` // 0 for top-level tasks
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Recurrence  *Recurrence `json:"recurrence,omitempty"` // Completing the task spawns the next occurrence
+	Version     int         `json:"version"`              // Incremented on every update, starts at 1
 }
 
-// TaskManager manages a collection of tasks
+// IsOverdue reports whether the task is not done and its due date is before now
+func (t Task) IsOverdue(now time.Time) bool {
+	return !t.Done && t.DueDate != nil && t.DueDate.Before(now)
+}
+
+// clone returns a copy of the task that shares no slices or pointers with it
+func (t Task) clone() Task {
+	if t.Tags != nil {
+		t.Tags = append([]string(nil), t.Tags...)
+	}
+	if t.DueDate != nil {
+		due := *t.DueDate
+		t.DueDate = &due
+	}
+	if t.CompletedAt != nil {
+		completed := *t.CompletedAt
+		t.CompletedAt = &completed
+	}
+	if t.Recurrence != nil {
+		t.Recurrence = t.Recurrence.clone()
+	}
+	return t
+}
+
+// TaskPatch describes a partial update of a task; nil fields are left unchanged
+type TaskPatch struct {
+	Version         int // Expected current version, 0 skips the check
+	Title           *string
+	Description     *string
+	Done            *bool
+	DueDate         *time.Time
+	ClearDueDate    bool
+	Priority        *Priority
+	Tags            []string // nil leaves tags unchanged, an empty slice clears them
+	Assignee        *string
+	ParentID        *int // 0 turns a subtask into a top-level task
+	Recurrence      *Recurrence
+	ClearRecurrence bool
+}
+
+// CompletionPolicy decides what happens when a task with incomplete subtasks is marked done
+type CompletionPolicy int
+
+const (
+	// RequireSubtasksDone rejects the update with ErrIncompleteSubtasks
+	RequireSubtasksDone CompletionPolicy = iota
+	// CascadeCompletion marks every incomplete subtask done as well
+	CascadeCompletion
+)
+
+// TaskManager manages a collection of tasks kept in a Store and records every change in an EventLog.
+// It is safe for concurrent use: writes are serialized, reads may run in parallel.
 type TaskManager struct {
-	tasks  map[int]Task
-	nextID int
+	*taskCore
+	actor string // Recorded in events; see WithActor
+}
+
+// taskCore is the state shared by a TaskManager and its actor views
+type taskCore struct {
+	store   Store
+	mutex   sync.RWMutex // Serializes writes to store and history
+	policy  CompletionPolicy
+	now     func() time.Time
+	history *history
 }
 
-// NewTaskManager creates a new task manager
+// NewTaskManager creates a new task manager backed by an in-memory store
 func NewTaskManager() *TaskManager {
-	// TODO: Implement this function
-	return nil
+	return NewTaskManagerWithStore(NewMemoryStore())
+}
+
+// NewTaskManagerWithStore creates a new task manager that keeps its tasks in the given store
+// and its history in memory
+func NewTaskManagerWithStore(store Store) *TaskManager {
+	return &TaskManager{taskCore: &taskCore{
+		store:   store,
+		now:     time.Now,
+		history: newHistory(NewMemoryEventLog()),
+	}}
+}
+
+// WithActor returns a view of the same manager that records actor in the events it causes
+func (tm *TaskManager) WithActor(actor string) *TaskManager {
+	return &TaskManager{taskCore: tm.taskCore, actor: actor}
+}
+
+// SetClock replaces the clock used for timestamps, overdue checks and recurrences
+func (tm *TaskManager) SetClock(clock Clock) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.now = clock.Now
+}
+
+// SetCompletionPolicy changes how completing a task with incomplete subtasks is handled
+func (tm *TaskManager) SetCompletionPolicy(policy CompletionPolicy) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.policy = policy
+}
+
+// Close releases the resources held by the underlying store
+func (tm *TaskManager) Close() error {
+	return tm.store.Close()
 }
 
 // AddTask adds a new task to the manager, returns an error if the title is empty, and increments the nextID
 func (tm *TaskManager) AddTask(title, description string) (Task, error) {
-	// TODO: Implement this function
-	return Task{}, nil
+	return tm.CreateTask(Task{Title: title, Description: description})
+}
+
+// CreateTask adds a new task with all fields taken from draft except the ID, timestamps and version,
+// returns an error if the title is empty, the parent does not exist or the recurrence rule is invalid
+func (tm *TaskManager) CreateTask(draft Task) (Task, error) {
+	if draft.Title == "" {
+		return Task{}, ErrEmptyTitle
+	}
+	priority := draft.Priority
+	if err := priority.validate(); err != nil {
+		return Task{}, err
+	}
+	if draft.Recurrence != nil {
+		if err := draft.Recurrence.validate(); err != nil {
+			return Task{}, err
+		}
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if err := tm.checkParent(0, draft.ParentID); err != nil {
+		return Task{}, err
+	}
+
+	now := tm.now()
+	task := draft.clone()
+	task.ID = 0
+	task.Tags = normalizeTags(task.Tags)
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	task.CompletedAt = nil
+	if task.Done {
+		task.CompletedAt = &now
+	}
+	task.Version = 1
+	created, err := tm.store.Create(task)
+	if err != nil {
+		return Task{}, err
+	}
+	return created, tm.record([]Event{taskEvent(EventAdd, nil, &created)})
 }
 
 // UpdateTask updates an existing task, returns an error if the title is empty or the task is not found
 func (tm *TaskManager) UpdateTask(id int, title, description string, done bool) error {
-	// TODO: Implement this function
-	return nil
+	_, err := tm.PatchTask(id, TaskPatch{Title: &title, Description: &description, Done: &done})
+	return err
+}
+
+// UpdateTaskIfVersion updates an existing task only if its current version equals version,
+// returns ErrConflict if the task has been modified since the caller read it
+func (tm *TaskManager) UpdateTaskIfVersion(id, version int, title, description string, done bool) error {
+	if version < 1 {
+		return ErrConflict
+	}
+	_, err := tm.PatchTask(id, TaskPatch{Version: version, Title: &title, Description: &description, Done: &done})
+	return err
+}
+
+// PatchTask applies a partial update and returns the updated task.
+// Completing a task with incomplete subtasks follows the manager's CompletionPolicy;
+// completing a recurring task adds its next occurrence as a new task.
+// If one of these writes fails, the ones before it are rolled back.
+func (tm *TaskManager) PatchTask(id int, patch TaskPatch) (Task, error) {
+	if patch.Title != nil && *patch.Title == "" {
+		return Task{}, ErrEmptyTitle
+	}
+	if patch.Priority != nil {
+		if err := patch.Priority.validate(); err != nil {
+			return Task{}, err
+		}
+	}
+	if patch.Recurrence != nil {
+		if err := patch.Recurrence.validate(); err != nil {
+			return Task{}, err
+		}
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	task, err := tm.store.Get(id)
+	if err != nil {
+		return Task{}, err
+	}
+	if patch.Version != 0 && task.Version != patch.Version {
+		return Task{}, ErrConflict
+	}
+	before := task.clone()
+
+	if patch.ParentID != nil {
+		if err := tm.checkParent(id, *patch.ParentID); err != nil {
+			return Task{}, err
+		}
+		task.ParentID = *patch.ParentID
+	}
+	if patch.Title != nil {
+		task.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.ClearDueDate {
+		task.DueDate = nil
+	}
+	if patch.DueDate != nil {
+		due := *patch.DueDate
+		task.DueDate = &due
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.Tags != nil {
+		task.Tags = normalizeTags(patch.Tags)
+	}
+	if patch.Assignee != nil {
+		task.Assignee = *patch.Assignee
+	}
+	if patch.ClearRecurrence {
+		task.Recurrence = nil
+	}
+	if patch.Recurrence != nil {
+		task.Recurrence = patch.Recurrence.clone()
+	}
+
+	now := tm.now()
+	var (
+		cascade  []Task
+		spawn    Task
+		spawning bool
+	)
+	if patch.Done != nil && *patch.Done != task.Done {
+		if *patch.Done {
+			pending, err := tm.pendingSubtasks(id)
+			if err != nil {
+				return Task{}, err
+			}
+			if len(pending) > 0 && tm.policy == RequireSubtasksDone {
+				return Task{}, ErrIncompleteSubtasks
+			}
+			cascade = pending
+			spawn, spawning = task.nextOccurrence(now)
+			task.CompletedAt = &now
+		} else {
+			task.CompletedAt = nil
+		}
+		task.Done = *patch.Done
+	}
+	task.UpdatedAt = now
+	task.Version++
+	if err := tm.store.Update(task); err != nil {
+		return Task{}, err
+	}
+	eventType := EventUpdate
+	if task.Done && !before.Done {
+		eventType = EventComplete
+	}
+	events := []Event{taskEvent(eventType, &before, &task)}
+
+	for _, sub := range cascade {
+		subBefore := sub.clone()
+		sub.Done = true
+		sub.CompletedAt = &now
+		sub.UpdatedAt = now
+		sub.Version++
+		if err := tm.store.Update(sub); err != nil {
+			tm.rollback(events)
+			return Task{}, err
+		}
+		events = append(events, taskEvent(EventComplete, &subBefore, &sub))
+	}
+	if spawning {
+		created, err := tm.store.Create(spawn)
+		if err != nil {
+			tm.rollback(events)
+			return Task{}, err
+		}
+		events = append(events, taskEvent(EventAdd, nil, &created))
+	}
+	return task, tm.record(events)
 }
 
 // DeleteTask removes a task from the manager, returns an error if the task is not found
+// or still has subtasks
 func (tm *TaskManager) DeleteTask(id int) error {
-	// TODO: Implement this function
-	return nil
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	all, err := tm.store.List()
+	if err != nil {
+		return err
+	}
+	for _, task := range all {
+		if task.ParentID == id {
+			return ErrHasSubtasks
+		}
+	}
+	task, err := tm.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := tm.store.Delete(id); err != nil {
+		return err
+	}
+	return tm.record([]Event{taskEvent(EventDelete, &task, nil)})
 }
 
 // GetTask retrieves a task by ID, returns an error if the task is not found
 func (tm *TaskManager) GetTask(id int) (Task, error) {
-	// TODO: Implement this function
-	return Task{}, nil
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.store.Get(id)
+}
+
+// ListTasks returns the tasks matching filter, sorted and paginated as the filter requests,
+// returns an empty slice if no tasks are found
+func (tm *TaskManager) ListTasks(filter TaskFilter) ([]Task, error) {
+	tm.mutex.RLock()
+	all, err := tm.store.List()
+	now := tm.now()
+	tm.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(all, now), nil
 }
 
-// ListTasks returns all tasks, optionally filtered by done status, returns an empty slice if no tasks are found
-func (tm *TaskManager) ListTasks(filterDone *bool) []Task {
-	// TODO: Implement this function
+// checkParent verifies that parentID may become the parent of task id (0 for a new task):
+// the parent must exist and must not be the task itself or one of its subtasks
+func (tm *TaskManager) checkParent(id, parentID int) error {
+	for current := parentID; current != 0; {
+		if current == id {
+			return ErrInvalidParent
+		}
+		parent, err := tm.store.Get(current)
+		if errors.Is(err, ErrTaskNotFound) {
+			return ErrInvalidParent
+		}
+		if err != nil {
+			return err
+		}
+		current = parent.ParentID
+	}
 	return nil
 }
+
+// pendingSubtasks returns all direct and indirect subtasks of id that are not done
+func (tm *TaskManager) pendingSubtasks(id int) ([]Task, error) {
+	all, err := tm.store.List()
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]Task)
+	for _, task := range all {
+		if task.ParentID != 0 {
+			children[task.ParentID] = append(children[task.ParentID], task)
+		}
+	}
+
+	var pending []Task
+	queue := []int{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range children[current] {
+			if !child.Done {
+				pending = append(pending, child)
+			}
+			queue = append(queue, child.ID)
+		}
+	}
+	return pending, nil
+}
+
+// normalizeTags trims and lowercases tags, dropping empty ones and duplicates
+func normalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
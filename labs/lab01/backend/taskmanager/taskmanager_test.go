@@ -1,7 +1,11 @@
 package taskmanager
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewTaskManager(t *testing.T) {
@@ -9,11 +13,15 @@ func TestNewTaskManager(t *testing.T) {
 	if tm == nil {
 		t.Error("NewTaskManager() returned nil")
 	}
-	if tm.tasks == nil {
+	store, ok := tm.store.(*MemoryStore)
+	if !ok {
+		t.Fatalf("Expected in-memory store, got %T", tm.store)
+	}
+	if store.tasks == nil {
 		t.Error("tasks map is nil")
 	}
-	if tm.nextID != 1 {
-		t.Errorf("Expected nextID to be 1, got %d", tm.nextID)
+	if store.nextID != 1 {
+		t.Errorf("Expected nextID to be 1, got %d", store.nextID)
 	}
 }
 
@@ -288,7 +296,10 @@ func TestListTasks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tasks := tm.ListTasks(tt.filter)
+			tasks, err := tm.ListTasks(TaskFilter{Done: tt.filter})
+			if err != nil {
+				t.Fatalf("ListTasks() failed: %v", err)
+			}
 			if len(tasks) != tt.expected {
 				t.Errorf("ListTasks() returned %d tasks, want %d", len(tasks), tt.expected)
 			}
@@ -304,3 +315,359 @@ func TestListTasks(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateTaskIfVersion(t *testing.T) {
+	tm := NewTaskManager()
+	task, err := tm.AddTask("Test Task", "Description")
+	if err != nil {
+		t.Fatalf("Failed to add task: %v", err)
+	}
+	if task.Version != 1 {
+		t.Fatalf("Expected new task to have version 1, got %d", task.Version)
+	}
+
+	if err := tm.UpdateTaskIfVersion(task.ID, 1, "Updated", "", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated, _ := tm.GetTask(task.ID)
+	if updated.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", updated.Version)
+	}
+
+	tests := []struct {
+		name      string
+		id        int
+		version   int
+		title     string
+		errorType error
+	}{
+		{"stale version", task.ID, 1, "Stale", ErrConflict},
+		{"future version", task.ID, 5, "Future", ErrConflict},
+		{"zero version", task.ID, 0, "Zero", ErrConflict},
+		{"non-existent task", 999, 1, "Missing", ErrTaskNotFound},
+		{"empty title", task.ID, 2, "", ErrEmptyTitle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tm.UpdateTaskIfVersion(tt.id, tt.version, tt.title, "", true)
+			if !errors.Is(err, tt.errorType) {
+				t.Errorf("Expected %v, got %v", tt.errorType, err)
+			}
+		})
+	}
+
+	got, _ := tm.GetTask(task.ID)
+	if got.Title != "Updated" || got.Version != 2 {
+		t.Errorf("Rejected updates modified the task: %+v", got)
+	}
+}
+
+func TestConcurrentAddTask(t *testing.T) {
+	tm := NewTaskManager()
+	n := 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tm.AddTask("Task", ""); err != nil {
+				t.Errorf("AddTask failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tasks, _ := tm.ListTasks(TaskFilter{})
+	if len(tasks) != n {
+		t.Fatalf("Expected %d tasks, got %d", n, len(tasks))
+	}
+	seen := make(map[int]bool)
+	for _, task := range tasks {
+		if seen[task.ID] {
+			t.Errorf("Duplicate task ID %d", task.ID)
+		}
+		seen[task.ID] = true
+	}
+}
+
+func TestConcurrentUpdateTaskIfVersion(t *testing.T) {
+	tm := NewTaskManager()
+	task, _ := tm.AddTask("Task", "")
+
+	n := 50
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		conflicts int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := tm.UpdateTaskIfVersion(task.ID, task.Version, fmt.Sprintf("Writer %d", i), "", false)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrConflict):
+				conflicts++
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 1 || conflicts != n-1 {
+		t.Errorf("Expected 1 success and %d conflicts, got %d and %d", n-1, succeeded, conflicts)
+	}
+	got, _ := tm.GetTask(task.ID)
+	if got.Version != 2 {
+		t.Errorf("Expected version 2, got %d", got.Version)
+	}
+}
+
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	tm := NewTaskManager()
+	task, _ := tm.AddTask("Task", "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			// Retry until the read-modify-write goes through
+			for {
+				current, err := tm.GetTask(task.ID)
+				if err != nil {
+					t.Errorf("GetTask failed: %v", err)
+					return
+				}
+				err = tm.UpdateTaskIfVersion(current.ID, current.Version, current.Title, current.Description+"x", false)
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, ErrConflict) {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tm.ListTasks(TaskFilter{})
+		}()
+		go func() {
+			defer wg.Done()
+			added, err := tm.AddTask("Other", "")
+			if err == nil {
+				tm.DeleteTask(added.ID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, _ := tm.GetTask(task.ID)
+	if len(got.Description) != 20 || got.Version != 21 {
+		t.Errorf("Lost updates: description %q, version %d", got.Description, got.Version)
+	}
+}
+
+func TestPatchTask(t *testing.T) {
+	tm := NewTaskManager()
+	now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	tm.now = func() time.Time { return now }
+	task, _ := tm.AddTask("Task", "")
+
+	now = now.Add(time.Minute)
+	due := now.Add(24 * time.Hour)
+	priority := PriorityHigh
+	assignee := "alice"
+	patched, err := tm.PatchTask(task.ID, TaskPatch{
+		DueDate:  &due,
+		Priority: &priority,
+		Tags:     []string{" Work ", "work", "urgent"},
+		Assignee: &assignee,
+	})
+	if err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if patched.Title != "Task" {
+		t.Errorf("Title should be unchanged, got %q", patched.Title)
+	}
+	if patched.DueDate == nil || !patched.DueDate.Equal(due) || patched.Priority != PriorityHigh || patched.Assignee != "alice" {
+		t.Errorf("Unexpected patched task %+v", patched)
+	}
+	if len(patched.Tags) != 2 || patched.Tags[0] != "work" || patched.Tags[1] != "urgent" {
+		t.Errorf("Expected normalized tags [work urgent], got %v", patched.Tags)
+	}
+	if !patched.UpdatedAt.Equal(now) || !patched.CreatedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Unexpected timestamps created=%v updated=%v", patched.CreatedAt, patched.UpdatedAt)
+	}
+
+	cleared, err := tm.PatchTask(task.ID, TaskPatch{ClearDueDate: true, Tags: []string{}})
+	if err != nil {
+		t.Fatalf("PatchTask failed: %v", err)
+	}
+	if cleared.DueDate != nil || cleared.Tags != nil {
+		t.Errorf("Expected due date and tags cleared, got %+v", cleared)
+	}
+
+	invalid := Priority(9)
+	if _, err := tm.PatchTask(task.ID, TaskPatch{Priority: &invalid}); !errors.Is(err, ErrInvalidPriority) {
+		t.Errorf("Expected ErrInvalidPriority, got %v", err)
+	}
+	if _, err := tm.PatchTask(task.ID, TaskPatch{Version: 1}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+}
+
+func TestCompletedAt(t *testing.T) {
+	tm := NewTaskManager()
+	now := time.Date(2025, 6, 15, 9, 0, 0, 0, time.UTC)
+	tm.now = func() time.Time { return now }
+	task, _ := tm.AddTask("Task", "")
+
+	now = now.Add(time.Hour)
+	tm.UpdateTask(task.ID, task.Title, "", true)
+	got, _ := tm.GetTask(task.ID)
+	if got.CompletedAt == nil || !got.CompletedAt.Equal(now) {
+		t.Errorf("Expected CompletedAt %v, got %v", now, got.CompletedAt)
+	}
+
+	now = now.Add(time.Hour)
+	tm.UpdateTask(task.ID, "Renamed", "", true)
+	got, _ = tm.GetTask(task.ID)
+	if got.CompletedAt == nil || got.CompletedAt.Equal(now) {
+		t.Errorf("CompletedAt should not move when a done task is edited, got %v", got.CompletedAt)
+	}
+
+	tm.UpdateTask(task.ID, "Renamed", "", false)
+	got, _ = tm.GetTask(task.ID)
+	if got.CompletedAt != nil {
+		t.Errorf("Expected CompletedAt cleared on reopen, got %v", got.CompletedAt)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	tm := NewTaskManager()
+	parent, _ := tm.AddTask("Parent", "")
+	child, err := tm.CreateTask(Task{Title: "Child", ParentID: parent.ID})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	grandchild, _ := tm.CreateTask(Task{Title: "Grandchild", ParentID: child.ID})
+
+	if _, err := tm.CreateTask(Task{Title: "Orphan", ParentID: 999}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected ErrInvalidParent for missing parent, got %v", err)
+	}
+	cycle := grandchild.ID
+	if _, err := tm.PatchTask(parent.ID, TaskPatch{ParentID: &cycle}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected ErrInvalidParent for cycle, got %v", err)
+	}
+	self := parent.ID
+	if _, err := tm.PatchTask(parent.ID, TaskPatch{ParentID: &self}); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("Expected ErrInvalidParent for self-parent, got %v", err)
+	}
+
+	subtasks, _ := tm.ListTasks(TaskFilter{ParentID: &parent.ID})
+	if len(subtasks) != 1 || subtasks[0].ID != child.ID {
+		t.Errorf("Expected only the child as direct subtask, got %+v", subtasks)
+	}
+
+	if err := tm.DeleteTask(parent.ID); !errors.Is(err, ErrHasSubtasks) {
+		t.Errorf("Expected ErrHasSubtasks, got %v", err)
+	}
+}
+
+func TestCompletionPolicy(t *testing.T) {
+	setup := func(policy CompletionPolicy) (*TaskManager, Task, Task, Task) {
+		tm := NewTaskManager()
+		tm.SetCompletionPolicy(policy)
+		parent, _ := tm.AddTask("Parent", "")
+		child, _ := tm.CreateTask(Task{Title: "Child", ParentID: parent.ID})
+		grandchild, _ := tm.CreateTask(Task{Title: "Grandchild", ParentID: child.ID})
+		return tm, parent, child, grandchild
+	}
+
+	t.Run("require subtasks done", func(t *testing.T) {
+		tm, parent, child, grandchild := setup(RequireSubtasksDone)
+		if err := tm.UpdateTask(parent.ID, parent.Title, "", true); !errors.Is(err, ErrIncompleteSubtasks) {
+			t.Fatalf("Expected ErrIncompleteSubtasks, got %v", err)
+		}
+		if err := tm.UpdateTask(grandchild.ID, grandchild.Title, "", true); err != nil {
+			t.Fatalf("Completing a leaf failed: %v", err)
+		}
+		if err := tm.UpdateTask(parent.ID, parent.Title, "", true); !errors.Is(err, ErrIncompleteSubtasks) {
+			t.Fatalf("Expected ErrIncompleteSubtasks while child is pending, got %v", err)
+		}
+		if err := tm.UpdateTask(child.ID, child.Title, "", true); err != nil {
+			t.Fatalf("Completing child failed: %v", err)
+		}
+		if err := tm.UpdateTask(parent.ID, parent.Title, "", true); err != nil {
+			t.Fatalf("Completing parent failed: %v", err)
+		}
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		tm, parent, child, grandchild := setup(CascadeCompletion)
+		if err := tm.UpdateTask(parent.ID, parent.Title, "", true); err != nil {
+			t.Fatalf("Completing parent failed: %v", err)
+		}
+		for _, id := range []int{child.ID, grandchild.ID} {
+			got, _ := tm.GetTask(id)
+			if !got.Done || got.CompletedAt == nil || got.Version != 2 {
+				t.Errorf("Subtask %d was not completed: %+v", id, got)
+			}
+		}
+	})
+}
+
+func TestPatchTaskRollsBackFailedWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(tm *TaskManager) Task
+		n     int // Writes that succeed before the failing one
+	}{
+		{"cascade", func(tm *TaskManager) Task {
+			parent, _ := tm.AddTask("Parent", "")
+			tm.CreateTask(Task{Title: "Child", ParentID: parent.ID})
+			tm.CreateTask(Task{Title: "Other child", ParentID: parent.ID})
+			return parent
+		}, 2},
+		{"next occurrence", func(tm *TaskManager) Task {
+			task, _ := tm.CreateTask(Task{Title: "Gym", Recurrence: &Recurrence{Freq: Daily}})
+			return task
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &failingStore{MemoryStore: NewMemoryStore(), n: -1}
+			tm := NewTaskManagerWithStore(store)
+			tm.SetCompletionPolicy(CascadeCompletion)
+			task := tt.setup(tm)
+			before, _ := tm.ListTasks(TaskFilter{})
+
+			store.n = tt.n
+			done := true
+			if _, err := tm.PatchTask(task.ID, TaskPatch{Done: &done}); err == nil {
+				t.Fatal("Expected the failed write to fail PatchTask")
+			}
+			after, _ := tm.ListTasks(TaskFilter{})
+			if len(after) != len(before) {
+				t.Fatalf("Expected %d tasks after the rollback, got %d", len(before), len(after))
+			}
+			for i := range after {
+				if after[i].Done || after[i].Version != before[i].Version {
+					t.Errorf("Expected task %d unchanged after the rollback, got %+v", after[i].ID, after[i])
+				}
+			}
+			if events, _ := tm.History(task.ID); len(events) != 1 {
+				t.Errorf("Expected only the add event, got %+v", events)
+			}
+		})
+	}
+}
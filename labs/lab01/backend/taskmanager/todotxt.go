@@ -0,0 +1,218 @@
+package taskmanager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// todo.txt (https://github.com/todotxt/todo.txt) stores one task per line:
+//
+//	x 2025-06-03 2025-06-01 Call mom +family @phone due:2025-06-05
+//	(A) 2025-06-01 Write report +work due:2025-06-10 rec:1w
+//
+// Tags become +project words, tags starting with "@" are written as contexts.
+// The id:, parent:, assignee:, rec: and pri: extensions carry the remaining fields;
+// descriptions and times of day are not representable and are dropped on export.
+
+// todoPriorities maps task priorities to todo.txt priority letters
+var todoPriorities = map[Priority]string{PriorityHigh: "A", PriorityMedium: "B", PriorityLow: "C"}
+
+// recurrenceUnits maps the todo.txt rec: units to frequencies
+var recurrenceUnits = map[string]Frequency{"d": Daily, "w": Weekly, "m": Monthly}
+
+func writeTodoTxt(w io.Writer, tasks []Task) error {
+	bw := bufio.NewWriter(w)
+	for _, task := range tasks {
+		if _, err := fmt.Fprintln(bw, formatTodoTxt(task)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func formatTodoTxt(task Task) string {
+	var parts []string
+	if task.Done {
+		completed := task.CreatedAt
+		if task.CompletedAt != nil {
+			completed = *task.CompletedAt
+		}
+		parts = append(parts, "x", completed.Format(time.DateOnly))
+	} else if letter, ok := todoPriorities[task.Priority]; ok {
+		parts = append(parts, "("+letter+")")
+	}
+	parts = append(parts, task.CreatedAt.Format(time.DateOnly))
+	parts = append(parts, strings.Fields(task.Title)...)
+
+	for _, tag := range task.Tags {
+		if strings.HasPrefix(tag, "@") {
+			parts = append(parts, tag)
+		} else {
+			parts = append(parts, "+"+tag)
+		}
+	}
+	if letter, ok := todoPriorities[task.Priority]; ok && task.Done {
+		parts = append(parts, "pri:"+letter)
+	}
+	if task.DueDate != nil {
+		parts = append(parts, "due:"+task.DueDate.Format(time.DateOnly))
+	}
+	if task.Assignee != "" {
+		parts = append(parts, "assignee:"+task.Assignee)
+	}
+	if task.Recurrence != nil {
+		parts = append(parts, "rec:"+formatTodoRecurrence(task.Recurrence))
+	}
+	parts = append(parts, "id:"+strconv.Itoa(task.ID))
+	if task.ParentID != 0 {
+		parts = append(parts, "parent:"+strconv.Itoa(task.ParentID))
+	}
+	return strings.Join(parts, " ")
+}
+
+func readTodoTxt(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		task, err := parseTodoTxt(text)
+		rows = append(rows, importRow{row: line, task: task, err: err})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read todo.txt: %w", err)
+	}
+	return rows, nil
+}
+
+func parseTodoTxt(line string) (Task, error) {
+	var task Task
+	fields := strings.Fields(line)
+
+	// Leading completion marker, priority and dates
+	if len(fields) > 0 && fields[0] == "x" {
+		task.Done = true
+		fields = fields[1:]
+		if d, ok := parseTodoDate(fields); ok {
+			task.CompletedAt = &d
+			fields = fields[1:]
+		}
+	} else if len(fields) > 0 && isTodoPriority(fields[0]) {
+		task.Priority = todoLetterPriority(fields[0][1])
+		fields = fields[1:]
+	}
+	if d, ok := parseTodoDate(fields); ok {
+		task.CreatedAt = d
+		fields = fields[1:]
+	}
+
+	var title []string
+	for _, word := range fields {
+		switch {
+		case len(word) > 1 && word[0] == '+':
+			task.Tags = append(task.Tags, word[1:])
+			continue
+		case len(word) > 1 && word[0] == '@':
+			task.Tags = append(task.Tags, word)
+			continue
+		}
+
+		key, value, ok := strings.Cut(word, ":")
+		if !ok || value == "" {
+			title = append(title, word)
+			continue
+		}
+		var err error
+		switch key {
+		case "due":
+			var due time.Time
+			if due, err = time.Parse(time.DateOnly, value); err == nil {
+				task.DueDate = &due
+			}
+		case "id":
+			task.ID, err = strconv.Atoi(value)
+		case "parent":
+			task.ParentID, err = strconv.Atoi(value)
+		case "assignee":
+			task.Assignee = value
+		case "rec":
+			task.Recurrence, err = parseTodoRecurrence(value)
+		case "pri":
+			if len(value) != 1 || value[0] < 'A' || value[0] > 'Z' {
+				err = ErrInvalidPriority
+			} else {
+				task.Priority = todoLetterPriority(value[0])
+			}
+		default: // not one of our extensions, e.g. a URL
+			title = append(title, word)
+			continue
+		}
+		if err != nil {
+			return task, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	task.Title = strings.Join(title, " ")
+	return task, nil
+}
+
+func parseTodoDate(fields []string) (time.Time, bool) {
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	d, err := time.Parse(time.DateOnly, fields[0])
+	return d, err == nil
+}
+
+func isTodoPriority(s string) bool {
+	return len(s) == 3 && s[0] == '(' && s[2] == ')' && s[1] >= 'A' && s[1] <= 'Z'
+}
+
+// todoLetterPriority maps A to high, B to medium and everything else to low
+func todoLetterPriority(letter byte) Priority {
+	switch letter {
+	case 'A':
+		return PriorityHigh
+	case 'B':
+		return PriorityMedium
+	}
+	return PriorityLow
+}
+
+// formatTodoRecurrence uses the short rec:2w form when it can express the rule, RRULE otherwise
+func formatTodoRecurrence(r *Recurrence) string {
+	if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 || r.Count > 0 || r.Until != nil {
+		return r.String()
+	}
+	for unit, freq := range recurrenceUnits {
+		if freq == r.Freq {
+			return strconv.Itoa(max(r.Interval, 1)) + unit
+		}
+	}
+	return r.String()
+}
+
+// parseTodoRecurrence accepts the short [+]N(d|w|m) form or a full RRULE
+func parseTodoRecurrence(s string) (*Recurrence, error) {
+	if strings.Contains(strings.ToUpper(s), "FREQ=") {
+		return ParseRecurrence(s)
+	}
+	s = strings.TrimPrefix(s, "+") // strict recurrence is treated like the normal one
+	if len(s) < 2 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRecurrence, s)
+	}
+	freq, ok := recurrenceUnits[s[len(s)-1:]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported unit in %q", ErrInvalidRecurrence, s)
+	}
+	interval, err := parsePositive(s[:len(s)-1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+	}
+	return &Recurrence{Freq: freq, Interval: interval}, nil
+}
@@ -0,0 +1,97 @@
+package taskmanager
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoTxt(t *testing.T) {
+	date := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC) }
+
+	t.Run("full pending task", func(t *testing.T) {
+		task, err := parseTodoTxt("(A) 2025-06-01 Call mom +Family @phone due:2025-06-05 see http://example.com rec:+2w")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if task.Title != "Call mom see http://example.com" {
+			t.Errorf("Unexpected title %q", task.Title)
+		}
+		if task.Priority != PriorityHigh || task.Done || !task.CreatedAt.Equal(date(1)) {
+			t.Errorf("Unexpected task %+v", task)
+		}
+		if task.DueDate == nil || !task.DueDate.Equal(date(5)) {
+			t.Errorf("Unexpected due date %v", task.DueDate)
+		}
+		if strings.Join(task.Tags, " ") != "Family @phone" {
+			t.Errorf("Unexpected tags %v", task.Tags)
+		}
+		if task.Recurrence == nil || task.Recurrence.Freq != Weekly || task.Recurrence.Interval != 2 {
+			t.Errorf("Unexpected recurrence %+v", task.Recurrence)
+		}
+	})
+
+	t.Run("completed task", func(t *testing.T) {
+		task, err := parseTodoTxt("x 2025-06-03 2025-06-01 Pay rent pri:C")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !task.Done || task.CompletedAt == nil || !task.CompletedAt.Equal(date(3)) || !task.CreatedAt.Equal(date(1)) {
+			t.Errorf("Unexpected dates %+v", task)
+		}
+		if task.Priority != PriorityLow || task.Title != "Pay rent" {
+			t.Errorf("Unexpected task %+v", task)
+		}
+	})
+
+	t.Run("lowercase x is part of the title", func(t *testing.T) {
+		task, _ := parseTodoTxt("xylophone lessons")
+		if task.Done || task.Title != "xylophone lessons" {
+			t.Errorf("Unexpected task %+v", task)
+		}
+	})
+
+	for _, line := range []string{"Task due:tomorrow", "Task id:abc", "Task rec:1y", "Task pri:AA"} {
+		t.Run("invalid "+line, func(t *testing.T) {
+			if _, err := parseTodoTxt(line); err == nil {
+				t.Errorf("Expected error for %q", line)
+			}
+		})
+	}
+}
+
+func TestFormatTodoTxt(t *testing.T) {
+	created := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	completed := time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC)
+	due := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		task     Task
+		expected string
+	}{
+		{
+			name:     "pending",
+			task:     Task{ID: 1, Title: "Write report", Priority: PriorityMedium, Tags: []string{"work", "@office"}, DueDate: &due, CreatedAt: created},
+			expected: "(B) 2025-06-01 Write report +work @office due:2025-06-10 id:1",
+		},
+		{
+			name:     "done with priority",
+			task:     Task{ID: 2, Title: "Pay rent", Done: true, Priority: PriorityHigh, CreatedAt: created, CompletedAt: &completed, ParentID: 1},
+			expected: "x 2025-06-03 2025-06-01 Pay rent pri:A id:2 parent:1",
+		},
+		{
+			name:     "complex recurrence",
+			task:     Task{ID: 3, Title: "Gym", CreatedAt: created, Assignee: "bob", Recurrence: &Recurrence{Freq: Weekly, ByDay: []time.Weekday{time.Monday, time.Friday}}},
+			expected: "2025-06-01 Gym assignee:bob rec:FREQ=WEEKLY;BYDAY=MO,FR id:3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTodoTxt(tt.task); got != tt.expected {
+				t.Errorf("formatTodoTxt() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package taskmanager
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownFormat is returned for unsupported import/export formats
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Format is a task interchange format
+type Format string
+
+// Supported formats
+const (
+	FormatJSON    Format = "json"
+	FormatCSV     Format = "csv"
+	FormatTodoTxt Format = "todotxt"
+)
+
+// ParseFormat converts a format name such as "csv" or "todo.txt" into a Format
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	case "todotxt", "todo.txt", "todo":
+		return FormatTodoTxt, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownFormat, s)
+}
+
+// csvColumns is the header written by Export; Import matches columns by name and ignores unknown ones
+var csvColumns = []string{
+	"id", "title", "description", "done", "priority", "due_date", "tags", "assignee",
+	"parent_id", "recurrence", "created_at", "updated_at", "completed_at",
+}
+
+// ImportOptions controls how Import applies the tasks it reads
+type ImportOptions struct {
+	DryRun bool // Validate and report without changing the manager
+}
+
+// ImportIssue describes a row that was not imported
+type ImportIssue struct {
+	Row   int // 1-based line (todo.txt, CSV including the header) or array position (JSON)
+	Title string
+	Err   error
+}
+
+// ImportReport summarizes an Import
+type ImportReport struct {
+	Imported int
+	Remapped map[int]int // Source ID -> assigned ID, for every imported task whose ID changed
+	Skipped  []ImportIssue
+}
+
+// importRow is a decoded row before validation
+type importRow struct {
+	row  int
+	task Task
+	err  error // Decoding error, the row is skipped
+}
+
+// Export writes all tasks, ordered by ID, to w in the given format
+func (tm *TaskManager) Export(w io.Writer, format Format) error {
+	tasks, err := tm.ListTasks(TaskFilter{})
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tasks)
+	case FormatCSV:
+		return writeCSV(w, tasks)
+	case FormatTodoTxt:
+		return writeTodoTxt(w, tasks)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// Import reads tasks from r and adds them to the manager as a single undoable operation.
+// A task keeps its source ID unless a stored task already has it; such tasks, and tasks
+// without an ID, get IDs above every stored and imported one, and every changed ID is listed
+// in the report. Parent references follow the changed IDs. Rows that cannot be decoded, have
+// an empty title, an invalid priority or recurrence, a duplicate ID or a parent missing from
+// the input are skipped and reported instead of failing the whole import. If the store fails,
+// the tasks already added are removed again and nothing is recorded.
+func (tm *TaskManager) Import(r io.Reader, format Format, opts ImportOptions) (ImportReport, error) {
+	var (
+		rows []importRow
+		err  error
+	)
+	switch format {
+	case FormatJSON:
+		rows, err = readJSON(r)
+	case FormatCSV:
+		rows, err = readCSV(r)
+	case FormatTodoTxt:
+		rows, err = readTodoTxt(r)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.importRows(rows, opts)
+}
+
+// importRows validates rows and adds the valid ones, parents before their subtasks
+func (tm *TaskManager) importRows(rows []importRow, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{Remapped: make(map[int]int)}
+	skip := func(row importRow, err error) {
+		report.Skipped = append(report.Skipped, ImportIssue{Row: row.row, Title: row.task.Title, Err: err})
+	}
+
+	// Validate rows on their own and index them by source ID
+	bySourceID := make(map[int]importRow)
+	var valid []importRow
+	for _, row := range rows {
+		if err := validateImport(row); err != nil {
+			skip(row, err)
+			continue
+		}
+		if id := row.task.ID; id != 0 {
+			if _, dup := bySourceID[id]; dup {
+				skip(row, fmt.Errorf("duplicate id %d", id))
+				continue
+			}
+			bySourceID[id] = row
+		}
+		valid = append(valid, row)
+	}
+
+	// Keep every source ID that is free; the others are assigned above all stored and
+	// imported IDs so that they never take an ID a later row keeps
+	existing, err := tm.store.List()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	taken := make(map[int]bool, len(existing))
+	nextID := 1
+	for _, task := range existing {
+		taken[task.ID] = true
+		nextID = max(nextID, task.ID+1)
+	}
+	for id := range bySourceID {
+		nextID = max(nextID, id+1)
+	}
+
+	// Add tasks in passes so that every parent exists before its subtasks
+	now := tm.now()
+	var events []Event
+	newIDs := make(map[int]int) // source ID -> assigned ID
+	for len(valid) > 0 {
+		var deferred []importRow
+		for _, row := range valid {
+			task := row.task
+			if task.ParentID != 0 {
+				parentID, ok := newIDs[task.ParentID]
+				if !ok {
+					deferred = append(deferred, row)
+					continue
+				}
+				task.ParentID = parentID
+			}
+			if task.ID == 0 || taken[task.ID] {
+				task.ID = nextID
+				nextID++
+			}
+
+			if !opts.DryRun {
+				created := prepareImport(task, now)
+				if err := tm.store.Put(created); err != nil {
+					tm.rollback(events)
+					return ImportReport{}, err
+				}
+				events = append(events, taskEvent(EventAdd, nil, &created))
+			}
+			if row.task.ID != 0 {
+				newIDs[row.task.ID] = task.ID
+				if task.ID != row.task.ID {
+					report.Remapped[row.task.ID] = task.ID
+				}
+			}
+			report.Imported++
+		}
+
+		if len(deferred) == len(valid) { // no progress: parents are missing or form a cycle
+			for _, row := range deferred {
+				skip(row, ErrInvalidParent)
+			}
+			break
+		}
+		valid = deferred
+	}
+	return report, tm.record(events)
+}
+
+// validateImport applies the same rules as CreateTask to a decoded row
+func validateImport(row importRow) error {
+	if row.err != nil {
+		return row.err
+	}
+	if row.task.Title == "" {
+		return ErrEmptyTitle
+	}
+	if err := row.task.Priority.validate(); err != nil {
+		return err
+	}
+	if row.task.Recurrence != nil {
+		if err := row.task.Recurrence.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareImport keeps the imported timestamps where present and resets the version
+func prepareImport(task Task, now time.Time) Task {
+	task.Tags = normalizeTags(task.Tags)
+	if task.CreatedAt.IsZero() {
+		task.CreatedAt = now
+	}
+	if task.UpdatedAt.IsZero() {
+		task.UpdatedAt = task.CreatedAt
+	}
+	if !task.Done {
+		task.CompletedAt = nil
+	} else if task.CompletedAt == nil {
+		task.CompletedAt = &now
+	}
+	task.Version = 1
+	return task
+}
+
+func readJSON(r io.Reader) ([]importRow, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+	rows := make([]importRow, len(raw))
+	for i, data := range raw {
+		rows[i].row = i + 1
+		rows[i].err = json.Unmarshal(data, &rows[i].task)
+	}
+	return rows, nil
+}
+
+func writeCSV(w io.Writer, tasks []Task) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		recurrence := ""
+		if task.Recurrence != nil {
+			recurrence = task.Recurrence.String()
+		}
+		record := []string{
+			strconv.Itoa(task.ID),
+			task.Title,
+			task.Description,
+			strconv.FormatBool(task.Done),
+			task.Priority.String(),
+			formatOptionalTime(task.DueDate),
+			strings.Join(task.Tags, ","),
+			task.Assignee,
+			strconv.Itoa(task.ParentID),
+			recurrence,
+			formatTime(task.CreatedAt),
+			formatTime(task.UpdatedAt),
+			formatOptionalTime(task.CompletedAt),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV header has no title column")
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row := importRow{row: line}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			row.err = err
+		} else {
+			row.task, row.err = decodeCSVRecord(record, columns)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func decodeCSVRecord(record []string, columns map[string]int) (Task, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	task := Task{
+		Title:       field("title"),
+		Description: field("description"),
+		Assignee:    field("assignee"),
+	}
+	var err error
+	if task.ID, err = parseOptionalInt(field("id")); err != nil {
+		return task, fmt.Errorf("id: %w", err)
+	}
+	if task.ParentID, err = parseOptionalInt(field("parent_id")); err != nil {
+		return task, fmt.Errorf("parent_id: %w", err)
+	}
+	if v := field("done"); v != "" {
+		if task.Done, err = strconv.ParseBool(v); err != nil {
+			return task, fmt.Errorf("done: %w", err)
+		}
+	}
+	if task.Priority, err = ParsePriority(field("priority")); err != nil {
+		return task, err
+	}
+	if v := field("tags"); v != "" {
+		task.Tags = strings.Split(v, ",")
+	}
+	if v := field("recurrence"); v != "" {
+		if task.Recurrence, err = ParseRecurrence(v); err != nil {
+			return task, err
+		}
+	}
+	if task.DueDate, err = parseOptionalTime(field("due_date")); err != nil {
+		return task, fmt.Errorf("due_date: %w", err)
+	}
+	if task.CompletedAt, err = parseOptionalTime(field("completed_at")); err != nil {
+		return task, fmt.Errorf("completed_at: %w", err)
+	}
+	for name, dst := range map[string]*time.Time{"created_at": &task.CreatedAt, "updated_at": &task.UpdatedAt} {
+		t, err := parseOptionalTime(field(name))
+		if err != nil {
+			return task, fmt.Errorf("%s: %w", name, err)
+		}
+		if t != nil {
+			*dst = *t
+		}
+	}
+	return task, nil
+}
+
+func parseOptionalInt(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// parseOptionalTime accepts RFC 3339 timestamps and plain YYYY-MM-DD dates (midnight UTC)
+func parseOptionalTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not an RFC 3339 timestamp or YYYY-MM-DD date", s)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
@@ -0,0 +1,209 @@
+package taskmanager
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTransferFixture builds a manager covering every exportable field
+func newTransferFixture(t *testing.T) *TaskManager {
+	t.Helper()
+	now := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	tm := NewTaskManager()
+	tm.now = func() time.Time { return now }
+
+	due := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	rule, _ := ParseRecurrence("FREQ=WEEKLY;INTERVAL=2")
+	parent, err := tm.CreateTask(Task{
+		Title:      "Plan trip",
+		Priority:   PriorityHigh,
+		Tags:       []string{"travel", "@home"},
+		DueDate:    &due,
+		Assignee:   "alice",
+		Recurrence: rule,
+	})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	if _, err := tm.CreateTask(Task{Title: "Book hotel", Description: "Near the station", ParentID: parent.ID, Done: true}); err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	return tm
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatCSV, FormatTodoTxt} {
+		t.Run(string(format), func(t *testing.T) {
+			src := newTransferFixture(t)
+			var buf bytes.Buffer
+			if err := src.Export(&buf, format); err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+
+			dst := NewTaskManager()
+			dst.AddTask("Existing", "") // takes ID 1, so only the parent moves
+			report, err := dst.Import(&buf, format, ImportOptions{})
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if report.Imported != 2 || len(report.Skipped) != 0 {
+				t.Fatalf("Unexpected report %+v", report)
+			}
+			if len(report.Remapped) != 1 || report.Remapped[1] != 3 {
+				t.Errorf("Expected only ID 1->3, got %v", report.Remapped)
+			}
+
+			parent, _ := dst.GetTask(3)
+			child, _ := dst.GetTask(2)
+			if parent.Title != "Plan trip" || parent.Priority != PriorityHigh || parent.Assignee != "alice" {
+				t.Errorf("Unexpected parent %+v", parent)
+			}
+			if len(parent.Tags) != 2 || parent.Tags[0] != "travel" || parent.Tags[1] != "@home" {
+				t.Errorf("Unexpected tags %v", parent.Tags)
+			}
+			if parent.DueDate == nil || !parent.DueDate.Equal(time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Unexpected due date %v", parent.DueDate)
+			}
+			if parent.Recurrence == nil || parent.Recurrence.String() != "FREQ=WEEKLY;INTERVAL=2" {
+				t.Errorf("Unexpected recurrence %v", parent.Recurrence)
+			}
+			if child.Title != "Book hotel" || !child.Done || child.ParentID != parent.ID {
+				t.Errorf("Unexpected child %+v", child)
+			}
+			wantCreated := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+			if format == FormatTodoTxt { // todo.txt only keeps dates
+				wantCreated = wantCreated.Truncate(24 * time.Hour)
+			}
+			if child.CompletedAt == nil || !child.CreatedAt.Equal(wantCreated) {
+				t.Errorf("Timestamps were not imported: %+v", child)
+			}
+			if format != FormatTodoTxt && child.Description != "Near the station" {
+				t.Errorf("Description lost: %q", child.Description)
+			}
+		})
+	}
+}
+
+func TestImportReportsInvalidRows(t *testing.T) {
+	input := `id,title,priority,parent_id,due_date
+1,Valid,high,,
+2,,low,,
+3,Bad priority,urgent,,
+4,Orphan,,99,
+5,Child of valid,,1,2025-06-10
+6,Child of orphan,,4,
+1,Duplicate,,,
+7,Bad date,,,tomorrow
+`
+	tm := NewTaskManager()
+	report, err := tm.Import(strings.NewReader(input), FormatCSV, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if report.Imported != 2 {
+		t.Errorf("Expected 2 imported tasks, got %d", report.Imported)
+	}
+
+	expected := map[int]error{3: ErrEmptyTitle, 4: ErrInvalidPriority, 5: ErrInvalidParent, 7: ErrInvalidParent}
+	rows := map[int]bool{}
+	for _, issue := range report.Skipped {
+		rows[issue.Row] = true
+		if want, ok := expected[issue.Row]; ok && !errors.Is(issue.Err, want) {
+			t.Errorf("Row %d: expected %v, got %v", issue.Row, want, issue.Err)
+		}
+	}
+	for _, row := range []int{3, 4, 5, 7, 8, 9} {
+		if !rows[row] {
+			t.Errorf("Row %d was not reported", row)
+		}
+	}
+
+	child, err := tm.GetTask(5)
+	if err != nil || child.Title != "Child of valid" || child.ParentID != 1 {
+		t.Errorf("Unexpected child %+v (%v)", child, err)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	tm := NewTaskManager()
+	input := `[{"id": 1, "title": "One"}, {"id": 2, "title": "Two", "parent_id": 1}, {"title": ""}]`
+	report, err := tm.Import(strings.NewReader(input), FormatJSON, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if report.Imported != 2 || len(report.Skipped) != 1 || report.Skipped[0].Row != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if tasks, _ := tm.ListTasks(TaskFilter{}); len(tasks) != 0 {
+		t.Errorf("Dry run modified the manager: %+v", tasks)
+	}
+}
+
+func TestImportKeepsFreeIDs(t *testing.T) {
+	input := `[
+		{"id": 2, "title": "Taken"},
+		{"id": 7, "title": "Free"},
+		{"title": "No ID"},
+		{"id": 3, "title": "Child of taken", "parent_id": 2}
+	]`
+	for _, dryRun := range []bool{false, true} {
+		tm := NewTaskManager()
+		tm.AddTask("One", "")
+		tm.AddTask("Two", "")
+		report, err := tm.Import(strings.NewReader(input), FormatJSON, ImportOptions{DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if report.Imported != 4 || len(report.Remapped) != 1 || report.Remapped[2] != 8 {
+			t.Errorf("DryRun %v: expected 4 imported and only ID 2->8, got %+v", dryRun, report)
+		}
+		if dryRun {
+			continue
+		}
+		for id, title := range map[int]string{7: "Free", 8: "Taken", 9: "No ID", 3: "Child of taken"} {
+			if task, err := tm.GetTask(id); err != nil || task.Title != title {
+				t.Errorf("Expected %q at ID %d, got %+v (%v)", title, id, task, err)
+			}
+		}
+		if child, _ := tm.GetTask(3); child.ParentID != 8 {
+			t.Errorf("Expected the child to follow its parent to ID 8, got %d", child.ParentID)
+		}
+	}
+}
+
+func TestImportRollsBackFailedWrite(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), n: -1}
+	tm := NewTaskManagerWithStore(store)
+	tm.AddTask("Existing", "")
+
+	store.n = 1
+	input := `[{"id": 1, "title": "One"}, {"id": 2, "title": "Two"}, {"id": 3, "title": "Three"}]`
+	if _, err := tm.Import(strings.NewReader(input), FormatJSON, ImportOptions{}); err == nil {
+		t.Fatal("Expected the failed write to fail Import")
+	}
+	if tasks, _ := tm.ListTasks(TaskFilter{}); len(tasks) != 1 || tasks[0].Title != "Existing" {
+		t.Errorf("Expected only the existing task after the rollback, got %+v", tasks)
+	}
+	if err := tm.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if err := tm.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Expected the failed import not to be recorded, got %v", err)
+	}
+}
+
+func TestImportExportUnknownFormat(t *testing.T) {
+	tm := NewTaskManager()
+	if err := tm.Export(&bytes.Buffer{}, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Export: expected ErrUnknownFormat, got %v", err)
+	}
+	if _, err := tm.Import(strings.NewReader(""), "xml", ImportOptions{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Import: expected ErrUnknownFormat, got %v", err)
+	}
+	if _, err := ParseFormat("todo.txt"); err != nil {
+		t.Errorf("ParseFormat(todo.txt) failed: %v", err)
+	}
+}
@@ -2,6 +2,10 @@ package user
 
 import (
 	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"shared/email"
 )
 
 // Predefined errors
@@ -11,6 +15,13 @@ var (
 	ErrInvalidEmail = errors.New("invalid email format")
 )
 
+// Validation limits
+const (
+	MaxNameLength = 30
+	MinAge        = 0
+	MaxAge        = 150
+)
+
 // User represents a user in the system
 type User struct {
 	Name  string
@@ -18,50 +29,62 @@ type User struct {
 	Email string
 }
 
-// Validate checks if the user data is valid, returns an error for each invalid field
+// Validate checks if the user data is valid, returns an error for each invalid field.
+// The result is a ValidationErrors listing every failing field; errors.Is matches it
+// against ErrInvalidName, ErrInvalidAge and ErrInvalidEmail.
 func (u *User) Validate() error {
-	if !IsValidName(u.Name) {
-		return ErrInvalidName
+	var errs ValidationErrors
+
+	switch {
+	case u.Name == "":
+		errs = append(errs, newFieldError(FieldName, CodeRequired, ErrInvalidName, nil))
+	case !IsValidName(u.Name):
+		errs = append(errs, newFieldError(FieldName, CodeTooLong, ErrInvalidName, Params{"max": MaxNameLength}))
 	}
 
 	if !IsValidAge(u.Age) {
-		return ErrInvalidAge
+		errs = append(errs, newFieldError(FieldAge, CodeOutOfRange, ErrInvalidAge, Params{"min": MinAge, "max": MaxAge}))
 	}
 
-	if !IsValidEmail(u.Email) {
-		return ErrInvalidEmail
+	switch {
+	case u.Email == "":
+		errs = append(errs, newFieldError(FieldEmail, CodeRequired, ErrInvalidEmail, nil))
+	case !IsValidEmail(u.Email):
+		errs = append(errs, newFieldError(FieldEmail, CodeInvalidFormat, ErrInvalidEmail, nil))
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
 // String returns a string representation of the user, formatted as "Name: <name>, Age: <age>, Email: <email>"
 func (u *User) String() string {
-	// TODO: Implement this function
-	return ""
+	return fmt.Sprintf("Name: %s, Age: %d, Email: %s", u.Name, u.Age, u.Email)
 }
 
 // NewUser creates a new user with validation, returns an error if the user is not valid
 func NewUser(name string, age int, email string) (*User, error) {
-	// TODO: Implement this function
-	return nil, nil
+	u := &User{Name: name, Age: age, Email: email}
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
-// IsValidEmail checks if the email format is valid
-// You can use regexp.MustCompile to compile the email regex
-func IsValidEmail(email string) bool {
-	// TODO: Implement this function
-	return false
+// IsValidEmail checks if the email format is valid according to RFC 5322 and RFC 6531
+func IsValidEmail(address string) bool {
+	return email.IsValid(address)
 }
 
 // IsValidName checks if the name is valid, returns false if the name is empty or longer than 30 characters
 func IsValidName(name string) bool {
-	// TODO: Implement this function
-	return false
+	n := utf8.RuneCountInString(name)
+	return n >= 1 && n <= MaxNameLength
 }
 
 // IsValidAge checks if the age is valid, returns false if the age is not between 0 and 150
 func IsValidAge(age int) bool {
-	// TODO: Implement this function
-	return false
-}
\ No newline at end of file
+	return age >= MinAge && age <= MaxAge
+}
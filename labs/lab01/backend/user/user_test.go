@@ -1,6 +1,7 @@
 package user
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -78,7 +79,7 @@ func TestNewUser(t *testing.T) {
 				if err == nil {
 					t.Error("Expected error, got none")
 				}
-				if err != tt.errorType {
+				if !errors.Is(err, tt.errorType) {
 					t.Errorf("Expected error %v, got %v", tt.errorType, err)
 				}
 				return
@@ -168,7 +169,7 @@ func TestUserValidate(t *testing.T) {
 				if err == nil {
 					t.Error("Expected error, got none")
 				}
-				if err != tt.errorType {
+				if !errors.Is(err, tt.errorType) {
 					t.Errorf("Expected error %v, got %v", tt.errorType, err)
 				}
 				return
@@ -224,3 +225,29 @@ func TestUserString(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected bool
+	}{
+		{"john@example.com", true},
+		{"john.doe+news@example.com", true},
+		{`"john doe"@example.com`, true},
+		{"иван@пример.рф", true},
+		{"user@[192.0.2.1]", true},
+		{"john@notvalid", false},
+		{"john..doe@example.com", false},
+		{"john@example..com", false},
+		{"john doe@example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := IsValidEmail(tt.email); got != tt.expected {
+				t.Errorf("IsValidEmail(%q) = %v, want %v", tt.email, got, tt.expected)
+			}
+		})
+	}
+}
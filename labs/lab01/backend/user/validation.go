@@ -0,0 +1,141 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field names reported in FieldError.Field
+const (
+	FieldName  = "name"
+	FieldAge   = "age"
+	FieldEmail = "email"
+)
+
+// Error codes reported in FieldError.Code; they are stable and meant for clients to translate
+const (
+	CodeRequired      = "required"
+	CodeTooLong       = "too_long"
+	CodeOutOfRange    = "out_of_range"
+	CodeInvalidFormat = "invalid_format"
+)
+
+// Params are the values a message template may refer to, e.g. {max}
+type Params map[string]any
+
+// defaultMessages are the English message templates, keyed by code
+var defaultMessages = map[string]string{
+	CodeRequired:      "{field} is required",
+	CodeTooLong:       "{field} must be at most {max} characters",
+	CodeOutOfRange:    "{field} must be between {min} and {max}",
+	CodeInvalidFormat: "{field} is not valid",
+}
+
+// FieldError describes one invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Params  Params `json:"params,omitempty"`
+	Err     error  `json:"-"` // Sentinel such as ErrInvalidName
+}
+
+func newFieldError(field, code string, err error, params Params) *FieldError {
+	e := &FieldError{Field: field, Code: code, Params: params, Err: err}
+	e.Message = expand(defaultMessages[code], e)
+	return e
+}
+
+// Error returns the field name followed by its message
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Unwrap returns the sentinel error of the field
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors collects every invalid field of a User, in field order
+type ValidationErrors []*FieldError
+
+// Error joins the messages of all fields
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the field errors so errors.Is and errors.As can match any of them
+func (v ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(v))
+	for i, e := range v {
+		errs[i] = e
+	}
+	return errs
+}
+
+// Field returns the error for the named field, or nil if the field is valid
+func (v ValidationErrors) Field(name string) *FieldError {
+	for _, e := range v {
+		if e.Field == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Translator returns the message for a field error in another language, or false to keep the default
+type Translator interface {
+	Translate(e *FieldError) (string, bool)
+}
+
+// Localize returns a copy of v with messages replaced by t where it has a translation
+func (v ValidationErrors) Localize(t Translator) ValidationErrors {
+	localized := make(ValidationErrors, len(v))
+	for i, e := range v {
+		c := *e
+		if message, ok := t.Translate(e); ok {
+			c.Message = message
+		}
+		localized[i] = &c
+	}
+	return localized
+}
+
+// Catalog is a Translator built from message templates. Keys are "field.code" or just "code",
+// the more specific key wins. Templates may refer to {field} and to any Params, e.g.
+//
+//	Catalog{"too_long": "{field}: не более {max} символов", "field.name": "имя"}
+//
+// Keys of the form "field.<name>" translate the field name used for {field}.
+type Catalog map[string]string
+
+// Translate implements Translator
+func (c Catalog) Translate(e *FieldError) (string, bool) {
+	template, ok := c[e.Field+"."+e.Code]
+	if !ok {
+		template, ok = c[e.Code]
+	}
+	if !ok {
+		return "", false
+	}
+	field := e.Field
+	if name, ok := c["field."+e.Field]; ok {
+		field = name
+	}
+	translated := *e
+	translated.Field = field
+	return expand(template, &translated), true
+}
+
+// expand replaces {field} and {param} placeholders in template
+func expand(template string, e *FieldError) string {
+	pairs := []string{"{field}", e.Field}
+	for key, value := range e.Params {
+		pairs = append(pairs, "{"+key+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
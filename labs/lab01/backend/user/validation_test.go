@@ -0,0 +1,107 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateCollectsAllFields(t *testing.T) {
+	u := User{Name: strings.Repeat("a", 31), Age: 200, Email: "not-an-email"}
+	err := u.Validate()
+
+	for _, sentinel := range []error{ErrInvalidName, ErrInvalidAge, ErrInvalidEmail} {
+		if !errors.Is(err, sentinel) {
+			t.Errorf("Expected errors.Is(err, %v)", sentinel)
+		}
+	}
+
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Expected ValidationErrors, got %T", err)
+	}
+	expected := []struct{ field, code, message string }{
+		{FieldName, CodeTooLong, "name must be at most 30 characters"},
+		{FieldAge, CodeOutOfRange, "age must be between 0 and 150"},
+		{FieldEmail, CodeInvalidFormat, "email is not valid"},
+	}
+	if len(verrs) != len(expected) {
+		t.Fatalf("Expected %d field errors, got %d", len(expected), len(verrs))
+	}
+	for i, want := range expected {
+		got := verrs[i]
+		if got.Field != want.field || got.Code != want.code || got.Message != want.message {
+			t.Errorf("Field error %d: expected %+v, got %+v", i, want, *got)
+		}
+	}
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != FieldName {
+		t.Errorf("Expected errors.As to find the name error first, got %v", fieldErr)
+	}
+}
+
+func TestValidateRequiredFields(t *testing.T) {
+	err := (&User{Age: 30}).Validate()
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	for _, field := range []string{FieldName, FieldEmail} {
+		if e := verrs.Field(field); e == nil || e.Code != CodeRequired {
+			t.Errorf("Expected %s to be required, got %v", field, e)
+		}
+	}
+	if e := verrs.Field(FieldAge); e != nil {
+		t.Errorf("Expected age to be valid, got %v", e)
+	}
+	if errors.Is(err, ErrInvalidAge) {
+		t.Error("Did not expect ErrInvalidAge")
+	}
+}
+
+func TestValidationErrorsJSON(t *testing.T) {
+	err := (&User{Name: "John", Age: -1, Email: "john@example.com"}).Validate()
+	data, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Fatalf("Marshal failed: %v", jsonErr)
+	}
+	expected := `[{"field":"age","code":"out_of_range","message":"age must be between 0 and 150","params":{"max":150,"min":0}}]`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	err := (&User{Name: "", Age: 151, Email: "bad"}).Validate()
+	var verrs ValidationErrors
+	errors.As(err, &verrs)
+
+	ru := Catalog{
+		"required":         "поле «{field}» обязательно",
+		"age.out_of_range": "возраст должен быть от {min} до {max}",
+		"field.name":       "имя",
+	}
+	localized := verrs.Localize(ru)
+
+	expected := []string{
+		"поле «имя» обязательно",
+		"возраст должен быть от 0 до 150",
+		"email is not valid", // no translation, default kept
+	}
+	for i, want := range expected {
+		if localized[i].Message != want {
+			t.Errorf("Message %d: expected %q, got %q", i, want, localized[i].Message)
+		}
+	}
+	if localized[0].Field != FieldName {
+		t.Errorf("Expected field name to stay %q, got %q", FieldName, localized[0].Field)
+	}
+	if verrs[0].Message != "name is required" {
+		t.Errorf("Localize must not modify the original, got %q", verrs[0].Message)
+	}
+	if !errors.Is(localized, ErrInvalidName) {
+		t.Error("Expected localized errors to keep their sentinels")
+	}
+}
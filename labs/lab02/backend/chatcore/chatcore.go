@@ -2,61 +2,331 @@ package chatcore
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
-// Message represents a chat message
-// Sender, Recipient, Content, Broadcast, Timestamp
-// TODO: Add more fields if needed
+// Broker errors
+var (
+	ErrBrokerClosed   = errors.New("broker is closed")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrEmptyRoom      = errors.New("room name is required")
+	ErrNotMember      = errors.New("sender is not a member of the room")
+	ErrUnknownMessage = errors.New("message is not in the mailbox")
+	ErrInvalidEvent   = errors.New("invalid event type")
+)
+
+// Message represents a chat message or another event, see EventType
+// ID, Type, Sender, Recipient, Content, Broadcast, Timestamp
+// Room targets the members of a room and takes precedence over Recipient and Broadcast.
 
 type Message struct {
+	ID        string    // Assigned by the broker unless set by Identity.Seal, unique across brokers sharing a Transport, see Ack
+	Type      EventType // EventMessage when empty
 	Sender    string
 	Recipient string
 	Content   string
 	Broadcast bool
-	Timestamp int64
+	Timestamp int64             // Unix nanoseconds, set by SendMessage when zero
+	Room      string            // Target room, see JoinRoom
+	System    bool              // Generated by the broker, e.g. a room membership change
+	Ref       string            // ID of the message a read receipt refers to
+	Presence  Presence          // New status of Sender for EventPresence
+	Meta      map[string]string // Annotations added by interceptors, see WithMeta
+	Encrypted bool              // Content is sealed for Recipient, see Identity.Seal
+	Signature []byte            // Sender's signature of an encrypted message
 }
 
 // Broker handles message routing between users
-// Contains context, input channel, user registry, mutex, done channel
+// Contains context, input channel, user registry, room registry, mutexes, done channel
 
 type Broker struct {
 	ctx        context.Context
-	input      chan Message            // Incoming messages
-	users      map[string]chan Message // userID -> receiving channel
-	usersMutex sync.RWMutex            // Protects users map
-	done       chan struct{}           // For shutdown
-	// TODO: Add more fields if needed
+	cancel     context.CancelFunc             // Stops Run without draining, see Close
+	input      chan envelope                  // Incoming messages
+	users      map[string]*subscriber         // userID -> receiving channel and delivery policy
+	usersMutex sync.RWMutex                   // Protects users map
+	rooms      map[string]map[string]struct{} // room -> member userIDs
+	roomsMutex sync.RWMutex                   // Protects rooms map
+	done       chan struct{}                  // Closed when Run returns
+	closing    chan struct{}                  // Closed by Close, no new messages are accepted
+	drain      chan struct{}                  // Closed by Close once no sender can add to input
+	closeOnce  sync.Once
+	sendMutex  sync.RWMutex    // Held for reading while a message is queued
+	started    atomic.Bool     // Run was called, or Close ran without it
+	defaults   DeliveryOptions // For users registered without options, protected by usersMutex
+	stats      brokerCounters
+	mailboxes  mailboxes // Unacknowledged direct messages per user
+	node       string    // Prefix of the message IDs assigned by this broker
+	lastID     atomic.Uint64
+	clock      Clock
+	presence   presenceTracker
+	chain      []Interceptor // Run by SendMessage, see Use
+	chainMutex sync.RWMutex
+	transport  Transport      // nil for a purely in-process broker
+	remote     <-chan Message // Messages from the transport, including our own
+	seen       recentIDs      // Transport messages already delivered, only used by Run
+	keys       keyring        // Public keys for end-to-end encrypted direct messages
 }
 
 // NewBroker creates a new message broker
 func NewBroker(ctx context.Context) *Broker {
-	// TODO: Initialize broker fields
+	ctx, cancel := context.WithCancel(ctx)
 	return &Broker{
-		ctx:   ctx,
-		input: make(chan Message, 100),
-		users: make(map[string]chan Message),
-		done:  make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		input:    make(chan envelope, 100),
+		users:    make(map[string]*subscriber),
+		rooms:    make(map[string]map[string]struct{}),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+		drain:    make(chan struct{}),
+		defaults: DeliveryOptions{Policy: BlockWithTimeout, Timeout: DefaultDeliveryTimeout},
+		mailboxes: mailboxes{
+			opts:  MailboxOptions{Size: DefaultMailboxSize, TTL: DefaultMailboxTTL},
+			boxes: make(map[string][]mailboxEntry),
+		},
+		node:     newNodeID(),
+		clock:    SystemClock,
+		presence: presenceTracker{users: make(map[string]*presenceState)},
+		seen:     newRecentIDs(dedupWindow),
+		keys:     keyring{keys: make(map[string]PublicKeys), accepted: make(map[string]int64)},
 	}
 }
 
-// Run starts the broker event loop (goroutine)
+// Run starts the broker event loop (goroutine). It returns when the broker context
+// is done or after Close has drained the queue; later calls return immediately.
 func (b *Broker) Run() {
-	// TODO: Implement event loop (fan-in/fan-out pattern)
+	if !b.started.CompareAndSwap(false, true) {
+		return
+	}
+	defer close(b.done)
+	if timeout := b.presence.opts.IdleTimeout; timeout > 0 {
+		go b.watchIdle(timeout)
+	}
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-b.drain:
+			b.drainInput()
+			return
+		case env := <-b.input:
+			b.deliver(env)
+		case msg, ok := <-b.remote:
+			if !ok {
+				b.remote = nil
+				continue
+			}
+			b.receive(msg)
+		}
+	}
 }
 
-// SendMessage sends a message to the broker
+// SendMessage sends a message to the broker, returns an error if the broker is closed,
+// an interceptor rejects the message, the sender is not a member of the target room
+// or an encrypted message fails verification
 func (b *Broker) SendMessage(msg Message) error {
-	// TODO: Send message to appropriate channel/queue
+	return b.SendMessageContext(b.ctx, msg)
+}
+
+// SendMessageContext is SendMessage that gives up waiting for room in the queue when ctx is done
+func (b *Broker) SendMessageContext(ctx context.Context, msg Message) error {
+	if b.isClosing() {
+		return ErrBrokerClosed
+	}
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	msg.System = false // only the broker sends system messages
+	if err := validateEvent(&msg); err != nil {
+		return err
+	}
+	if err := b.checkEncryption(msg); err != nil {
+		return err
+	}
+	if err := b.route(ctx, msg); err != nil {
+		// Not queued, so the sender may retry an encrypted message with the same ID
+		b.keys.forget(msg)
+		return err
+	}
 	return nil
 }
 
-// RegisterUser adds a user to the broker
+// route runs the checks and interceptors that follow verification, then queues msg
+func (b *Broker) route(ctx context.Context, msg Message) error {
+	// Checked before the interceptors too, so that a rejected message does not count
+	// against a RateLimiter
+	if msg.Room != "" && !b.isMember(msg.Room, msg.Sender) {
+		return ErrNotMember
+	}
+	msg, err := b.intercept(msg)
+	if err != nil {
+		return err
+	}
+	b.touch(msg.Sender)
+	if msg.Type == EventReadReceipt {
+		b.Ack(msg.Sender, msg.Ref) // Reading a message acknowledges it
+	}
+	env := envelope{msg: msg}
+	switch {
+	case msg.Room != "":
+		members, ok := b.roomSnapshot(msg.Room, msg.Sender)
+		if !ok {
+			return ErrNotMember
+		}
+		env.targets = members
+	case !msg.Broadcast:
+		env.targets = []string{msg.Recipient}
+	}
+	return b.enqueueContext(ctx, env)
+}
+
+// RegisterUser adds a user to the broker with the default delivery options, see SetDeliveryOptions.
+// The user's mailbox is delivered in order before any live message, and the user becomes Online.
+// Registering again with the same channel does not repeat the messages already sent to it.
+// The channel stays owned by the caller, who may share it between users, until the broker
+// closes it: on Close, or when the Disconnect policy drops the last user receiving on it.
+// UnregisterUser leaves the channel open. Registering has no effect after Close.
 func (b *Broker) RegisterUser(userID string, recv chan Message) {
-	// TODO: Register user and their receiving channel
+	b.usersMutex.RLock()
+	opts := b.defaults
+	b.usersMutex.RUnlock()
+	b.RegisterUserWithOptions(userID, recv, opts)
+}
+
+// RegisterUserWithOptions adds a user to the broker with its own delivery policy
+func (b *Broker) RegisterUserWithOptions(userID string, recv chan Message, opts DeliveryOptions) {
+	b.usersMutex.Lock()
+	if b.isClosing() {
+		b.usersMutex.Unlock()
+		return
+	}
+	// Taken under the lock so that every direct message is in the backlog or delivered live;
+	// flushBacklog skips the ones that end up both
+	backlog := b.backlog(userID, recv)
+	b.users[userID] = &subscriber{id: userID, ch: recv, opts: opts, backlog: backlog}
+	b.usersMutex.Unlock()
+
+	if len(backlog) > 0 {
+		b.enqueue(envelope{targets: []string{userID}, flush: true})
+	}
+	b.setPresence(userID, Online)
 }
 
-// UnregisterUser removes a user from the broker
+// UnregisterUser removes a user from the broker and from every room they joined,
+// and the user becomes Offline
 func (b *Broker) UnregisterUser(userID string) {
-	// TODO: Remove user from registry
+	b.usersMutex.Lock()
+	delete(b.users, userID)
+	b.usersMutex.Unlock()
+
+	for _, env := range b.leaveAllRooms(userID) {
+		b.enqueue(env)
+	}
+	b.setPresence(userID, Offline)
+}
+
+// envelope is a queued message with its recipients resolved at send time,
+// so a room message only reaches the users who were members when it was sent
+type envelope struct {
+	msg     Message
+	targets []string // nil for broadcasts, which reach every user registered at delivery
+	flush   bool     // Only deliver the backlog of the targets
+}
+
+// enqueue puts env on the input queue, see enqueueContext
+func (b *Broker) enqueue(env envelope) error {
+	return b.enqueueContext(b.ctx, env)
+}
+
+// enqueueContext puts env on the input queue, or publishes its message when the broker has a
+// Transport, in which case the receiving brokers resolve the recipients themselves
+func (b *Broker) enqueueContext(ctx context.Context, env envelope) error {
+	b.sendMutex.RLock()
+	defer b.sendMutex.RUnlock()
+	if b.isClosing() {
+		return ErrBrokerClosed
+	}
+	if !env.flush {
+		env.msg = b.stamp(env.msg)
+		if b.transport != nil {
+			return b.transport.Publish(ctx, env.msg)
+		}
+	}
+	select {
+	case b.input <- env:
+		return nil
+	case <-b.closing:
+		return ErrBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+}
+
+// deliver fans a queued message out to its recipients, then disconnects the
+// recipients whose policy gave up on them
+func (b *Broker) deliver(env envelope) {
+	var stuck []*subscriber
+	for _, sub := range b.recipients(env) {
+		if !b.deliverTo(sub, env) {
+			stuck = append(stuck, sub)
+		}
+	}
+	for _, sub := range stuck {
+		b.disconnect(sub)
+	}
+}
+
+// recipients returns the registered users a queued message goes to, after storing a direct
+// message in the mailbox of each target. Delivery happens after usersMutex is released, so
+// a consumer that is slow to receive does not stall registration or Stats; channels are only
+// closed on the Run goroutine, which is the one delivering.
+func (b *Broker) recipients(env envelope) []*subscriber {
+	b.usersMutex.RLock()
+	defer b.usersMutex.RUnlock()
+	if env.targets == nil {
+		subs := make([]*subscriber, 0, len(b.users))
+		for _, sub := range b.users {
+			subs = append(subs, sub)
+		}
+		return subs
+	}
+	subs := make([]*subscriber, 0, len(env.targets))
+	for _, id := range env.targets {
+		if !env.flush && isDirect(env.msg) {
+			b.store(id, env.msg)
+		}
+		if sub, ok := b.users[id]; ok {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// deliverTo sends the user's backlog and then the message, returning false if the
+// user must be disconnected
+func (b *Broker) deliverTo(sub *subscriber, env envelope) bool {
+	if !b.flushBacklog(sub) {
+		return false
+	}
+	return env.flush || b.send(sub, env.msg)
+}
+
+// stamp assigns the next message ID, the current time and the default type unless already set
+func (b *Broker) stamp(msg Message) Message {
+	if msg.Type == "" {
+		msg.Type = EventMessage
+	}
+	if msg.ID == "" {
+		msg.ID = b.node + "-" + strconv.FormatUint(b.lastID.Add(1), 10)
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = b.clock.Now().UnixNano()
+	}
+	return msg
 }
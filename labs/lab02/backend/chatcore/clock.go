@@ -0,0 +1,23 @@
+package chatcore
+
+import "time"
+
+// Clock abstracts time so that expiry and idle detection can be tested deterministically
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real wall clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock replaces the clock used for timestamps, mailbox expiry and idle detection.
+// It must be called before Run.
+func (b *Broker) SetClock(clock Clock) {
+	b.clock = clock
+}
@@ -0,0 +1,194 @@
+package chatcore
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDeliveryTimeout is how long BlockWithTimeout waits for a full user channel by default
+const DefaultDeliveryTimeout = time.Second
+
+// DeliveryPolicy decides what the broker does when a user's channel is full,
+// so that one slow consumer cannot stall delivery to everyone else
+type DeliveryPolicy int
+
+const (
+	// BlockWithTimeout waits up to DeliveryOptions.Timeout for room, then drops the message
+	BlockWithTimeout DeliveryPolicy = iota
+	// DropNewest drops the message that does not fit
+	DropNewest
+	// DropOldest treats the channel buffer as a ring: the oldest queued message is evicted
+	// to make room for the new one
+	DropOldest
+	// Disconnect unregisters the user and closes their channel
+	Disconnect
+)
+
+// String returns the policy name
+func (p DeliveryPolicy) String() string {
+	switch p {
+	case BlockWithTimeout:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Disconnect:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// DeliveryOptions configures delivery to one user
+type DeliveryOptions struct {
+	Policy  DeliveryPolicy
+	Timeout time.Duration // For BlockWithTimeout; 0 drops immediately like DropNewest
+}
+
+// Stats are the broker's delivery counters
+type Stats struct {
+	Delivered    uint64 // Messages put on a user channel, including ones DropOldest evicted later
+	Dropped      uint64
+	Disconnected uint64
+	Users        map[string]UserStats // Currently registered users
+}
+
+// UserStats are the delivery counters of one registered user
+type UserStats struct {
+	Policy    DeliveryPolicy
+	Delivered uint64
+	Dropped   uint64
+}
+
+// subscriber is a registered user's channel with its delivery policy and counters
+type subscriber struct {
+	id        string
+	ch        chan Message
+	opts      DeliveryOptions
+	backlog   []Message // Mailbox snapshot taken at registration, only used by Run
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// brokerCounters are the totals across all users, including unregistered ones
+type brokerCounters struct {
+	delivered    atomic.Uint64
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+// SetDeliveryOptions changes the delivery options of users registered afterwards with RegisterUser
+func (b *Broker) SetDeliveryOptions(opts DeliveryOptions) {
+	b.usersMutex.Lock()
+	defer b.usersMutex.Unlock()
+	b.defaults = opts
+}
+
+// Stats returns a snapshot of the delivery counters
+func (b *Broker) Stats() Stats {
+	b.usersMutex.RLock()
+	defer b.usersMutex.RUnlock()
+	stats := Stats{
+		Delivered:    b.stats.delivered.Load(),
+		Dropped:      b.stats.dropped.Load(),
+		Disconnected: b.stats.disconnected.Load(),
+		Users:        make(map[string]UserStats, len(b.users)),
+	}
+	for id, sub := range b.users {
+		stats.Users[id] = UserStats{
+			Policy:    sub.opts.Policy,
+			Delivered: sub.delivered.Load(),
+			Dropped:   sub.dropped.Load(),
+		}
+	}
+	return stats
+}
+
+// send delivers msg to one user according to their policy.
+// It returns false if the user must be disconnected.
+func (b *Broker) send(sub *subscriber, msg Message) bool {
+	select {
+	case sub.ch <- msg:
+		b.countDelivered(sub, msg)
+		return true
+	default:
+	}
+
+	switch sub.opts.Policy {
+	case BlockWithTimeout:
+		if sub.opts.Timeout > 0 {
+			timer := time.NewTimer(sub.opts.Timeout)
+			defer timer.Stop()
+			select {
+			case sub.ch <- msg:
+				b.countDelivered(sub, msg)
+				return true
+			case <-timer.C:
+			case <-b.ctx.Done():
+			}
+		}
+	case DropOldest:
+		// The consumer may drain the channel concurrently, so evicting can find it empty
+		for attempt := 0; attempt < cap(sub.ch)+1; attempt++ {
+			select {
+			case evicted := <-sub.ch:
+				b.countDropped(sub)
+				b.markSent(sub, evicted, false)
+			default:
+			}
+			select {
+			case sub.ch <- msg:
+				b.countDelivered(sub, msg)
+				return true
+			default:
+			}
+		}
+	case Disconnect:
+		b.countDropped(sub)
+		return false
+	}
+	b.countDropped(sub)
+	return true
+}
+
+func (b *Broker) countDelivered(sub *subscriber, msg Message) {
+	sub.delivered.Add(1)
+	b.stats.delivered.Add(1)
+	b.markSent(sub, msg, true)
+}
+
+func (b *Broker) countDropped(sub *subscriber) {
+	sub.dropped.Add(1)
+	b.stats.dropped.Add(1)
+}
+
+// disconnect unregisters a user whose channel stayed full and closes the channel,
+// unless other users share it. Nothing happens if the user registered again since.
+// It runs on the Run goroutine, so the room announcements are delivered directly
+// instead of being queued behind the input it is draining.
+func (b *Broker) disconnect(sub *subscriber) {
+	userID := sub.id
+	b.usersMutex.Lock()
+	ok := b.users[userID] == sub
+	if ok {
+		delete(b.users, userID)
+		b.releaseChannel(sub.ch)
+	}
+	b.usersMutex.Unlock()
+	if !ok {
+		return
+	}
+	b.stats.disconnected.Add(1)
+
+	deliver := func(env envelope) error {
+		env.msg = b.stamp(env.msg)
+		b.deliver(env)
+		return nil
+	}
+	for _, env := range b.leaveAllRooms(userID) {
+		deliver(env)
+	}
+	if b.updatePresence(userID, Offline) {
+		b.notifyPresence(userID, Offline, deliver)
+	}
+}
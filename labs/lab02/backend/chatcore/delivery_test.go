@@ -0,0 +1,191 @@
+package chatcore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sendAndSync sends n direct messages to slow, then one to fast, and waits for it.
+// The broker delivers in order, so every message to slow has been handled afterwards.
+func sendAndSync(t *testing.T, broker *Broker, slow string, n int, fast *testUser) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		msg := Message{Sender: "S", Recipient: slow, Content: string(rune('a' + i))}
+		if err := broker.SendMessage(msg); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	if err := broker.SendMessage(Message{Sender: "S", Recipient: fast.ID, Content: "sync"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	expectMessage(t, fast, func(m Message) bool { return m.Content == "sync" }, "sync message")
+}
+
+func drain(ch chan Message) []string {
+	var contents []string
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return contents
+			}
+			contents = append(contents, m.Content)
+		default:
+			return contents
+		}
+	}
+}
+
+func TestDeliveryPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      DeliveryOptions
+		received  []string
+		delivered uint64 // Evicted messages count as both delivered and dropped
+		dropped   uint64
+	}{
+		{"drop newest", DeliveryOptions{Policy: DropNewest}, []string{"a", "b"}, 2, 3},
+		{"drop oldest", DeliveryOptions{Policy: DropOldest}, []string{"d", "e"}, 5, 3},
+		{"block with timeout", DeliveryOptions{Policy: BlockWithTimeout, Timeout: 10 * time.Millisecond}, []string{"a", "b"}, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			broker := NewBroker(ctx)
+			go broker.Run()
+
+			slow := make(chan Message, 2)
+			broker.RegisterUserWithOptions("slow", slow, tt.opts)
+			fast := newRoomTestUser("fast")
+			broker.RegisterUser(fast.ID, fast.Recv)
+
+			sendAndSync(t, broker, "slow", 5, fast)
+
+			got := drain(slow)
+			if len(got) != len(tt.received) {
+				t.Fatalf("Expected %v, got %v", tt.received, got)
+			}
+			for i := range got {
+				if got[i] != tt.received[i] {
+					t.Errorf("Expected %v, got %v", tt.received, got)
+				}
+			}
+			stats := broker.Stats()
+			if stats.Users["slow"].Dropped != tt.dropped {
+				t.Errorf("Expected %d dropped, got %d", tt.dropped, stats.Users["slow"].Dropped)
+			}
+			if stats.Dropped != tt.dropped || stats.Users["fast"].Dropped != 0 {
+				t.Errorf("Expected only slow to drop messages, got %+v", stats)
+			}
+			if stats.Users["slow"].Delivered != tt.delivered {
+				t.Errorf("Expected %d delivered to slow, got %d", tt.delivered, stats.Users["slow"].Delivered)
+			}
+		})
+	}
+}
+
+func TestDeliveryDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	slow := make(chan Message, 2)
+	broker.RegisterUserWithOptions("slow", slow, DeliveryOptions{Policy: Disconnect})
+	fast := newRoomTestUser("fast")
+	broker.RegisterUser(fast.ID, fast.Recv)
+	for _, id := range []string{"slow", "fast"} {
+		if err := broker.JoinRoom(id, "go"); err != nil {
+			t.Fatalf("JoinRoom failed: %v", err)
+		}
+	}
+	expectMessage(t, fast, isSystem(SystemJoined, "fast", "go"), "own join")
+
+	// The slow channel is already full with both join announcements
+	if err := broker.SendMessage(Message{Sender: "fast", Room: "go", Content: "hi"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	expectMessage(t, fast, func(m Message) bool { return m.Content == "hi" }, "room message")
+	expectMessage(t, fast, isSystem(SystemLeft, "slow", "go"), "leave of disconnected user")
+
+	if got := drain(slow); len(got) != 2 {
+		t.Errorf("Expected only the join announcements before disconnect, got %v", got)
+	}
+	if _, ok := <-slow; ok {
+		t.Error("Expected the slow channel to be closed")
+	}
+	stats := broker.Stats()
+	if stats.Disconnected != 1 {
+		t.Errorf("Expected 1 disconnect, got %d", stats.Disconnected)
+	}
+	if _, ok := stats.Users["slow"]; ok {
+		t.Error("Expected slow to be unregistered")
+	}
+	if members := broker.RoomMembers("go"); len(members) != 1 || members[0] != "fast" {
+		t.Errorf("Expected only fast in the room, got %v", members)
+	}
+}
+
+func TestSlowConsumerDoesNotStallBroker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	broker.SetDeliveryOptions(DeliveryOptions{Policy: BlockWithTimeout, Timeout: time.Millisecond})
+	go broker.Run()
+
+	broker.RegisterUser("stuck", make(chan Message)) // never read
+	fast := newRoomTestUser("fast")
+	broker.RegisterUser(fast.ID, fast.Recv)
+
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		if err := broker.SendMessage(Message{Sender: "S", Content: "all", Broadcast: true}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		expectMessage(t, fast, func(m Message) bool { return m.Content == "all" }, "broadcast")
+	}
+	sendAndSync(t, broker, "stuck", 0, fast)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected delivery to continue past the stuck user, took %v", elapsed)
+	}
+	if stats := broker.Stats(); stats.Users["stuck"].Dropped != 50 || stats.Users["fast"].Delivered < 50 {
+		t.Errorf("Expected 50 dropped for stuck and 50 delivered to fast, got %+v", stats.Users)
+	}
+}
+
+func TestBlockedSendDoesNotHoldUsers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	broker.SetDeliveryOptions(DeliveryOptions{Policy: BlockWithTimeout, Timeout: time.Minute})
+	go broker.Run()
+
+	stuck := make(chan Message) // read only at the end
+	broker.RegisterUser("stuck", stuck)
+	if err := broker.SendMessage(Message{Sender: "S", Content: "all", Broadcast: true}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // Let Run block on the stuck channel
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		late := newRoomTestUser("late")
+		broker.RegisterUser(late.ID, late.Recv)
+		broker.SetDeliveryOptions(DeliveryOptions{Policy: DropNewest})
+		broker.Stats()
+		broker.UnregisterUser(late.ID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected registration and Stats not to wait for a blocked send")
+	}
+	if m := <-stuck; m.Content != "all" {
+		t.Errorf("Expected the blocked broadcast, got %+v", m)
+	}
+}
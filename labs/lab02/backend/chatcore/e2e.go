@@ -0,0 +1,273 @@
+package chatcore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// End-to-end encryption errors
+var (
+	ErrNoKey           = errors.New("user has no registered key")
+	ErrInvalidKey      = errors.New("invalid public key")
+	ErrBadSignature    = errors.New("message signature does not match the sender")
+	ErrNotEncrypted    = errors.New("direct messages must be encrypted")
+	ErrDecrypt         = errors.New("message cannot be decrypted with this key")
+	ErrEncryptedTarget = errors.New("only direct messages can be encrypted")
+	ErrReplay          = errors.New("encrypted message was already sent or is too old")
+)
+
+// signatureContext separates our signatures from any other use of the same key
+const signatureContext = "chatcore-e2e-v2"
+
+// MaxEncryptedAge is how far the Timestamp of an encrypted message may be from the broker's
+// clock, in either direction. The broker remembers the IDs it accepted for that long.
+const MaxEncryptedAge = 5 * time.Minute
+
+// PublicKeys identify a user for end-to-end encrypted direct messages
+type PublicKeys struct {
+	Box  [32]byte          // X25519 key that messages to the user are sealed for
+	Sign ed25519.PublicKey // Verifies the messages the user sends
+}
+
+// Fingerprint is a short hex digest of the keys for comparing them out of band
+func (k PublicKeys) Fingerprint() string {
+	h := sha256.New()
+	h.Write(k.Box[:])
+	h.Write(k.Sign)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Equal reports whether both keys are the same
+func (k PublicKeys) Equal(other PublicKeys) bool {
+	return k.Box == other.Box && bytes.Equal(k.Sign, other.Sign)
+}
+
+func (k PublicKeys) valid() bool {
+	return k.Box != [32]byte{} && len(k.Sign) == ed25519.PublicKeySize
+}
+
+// Identity holds a user's private keys. It lives on the user's device; the broker only
+// ever sees the PublicKeys.
+type Identity struct {
+	UserID  string
+	boxKey  [32]byte
+	signKey ed25519.PrivateKey
+	public  PublicKeys
+}
+
+// NewIdentity generates fresh keys for a user
+func NewIdentity(userID string) (*Identity, error) {
+	boxPublic, boxPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signPublic, signPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		UserID:  userID,
+		boxKey:  *boxPrivate,
+		signKey: signPrivate,
+		public:  PublicKeys{Box: *boxPublic, Sign: signPublic},
+	}, nil
+}
+
+// PublicKeys returns the keys to register with the broker, see Broker.RegisterKey
+func (id *Identity) PublicKeys() PublicKeys {
+	return id.public
+}
+
+// Seal encrypts the content of a direct message for the recipient's keys and signs it.
+// The sender is set to the identity's user, and a random ID and the current time are
+// assigned unless set; the signature covers them so the message cannot be replayed.
+func (id *Identity) Seal(msg Message, recipient PublicKeys) (Message, error) {
+	if !recipient.valid() {
+		return Message{}, ErrInvalidKey
+	}
+	if msg.ID == "" {
+		var nonce [16]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return Message{}, err
+		}
+		msg.ID = "e2e-" + hex.EncodeToString(nonce[:])
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = time.Now().UnixNano()
+	}
+	sealed, err := box.SealAnonymous(nil, []byte(msg.Content), &recipient.Box, rand.Reader)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Sender = id.UserID
+	msg.Content = base64.StdEncoding.EncodeToString(sealed)
+	msg.Encrypted = true
+	msg.Signature = ed25519.Sign(id.signKey, signedData(msg))
+	return msg, nil
+}
+
+// Open verifies that an encrypted message was signed with the sender's keys and decrypts it
+func (id *Identity) Open(msg Message, sender PublicKeys) (Message, error) {
+	if !msg.Encrypted {
+		return Message{}, ErrNotEncrypted
+	}
+	if !verifySignature(msg, sender) {
+		return Message{}, ErrBadSignature
+	}
+	sealed, err := base64.StdEncoding.DecodeString(msg.Content)
+	if err != nil {
+		return Message{}, ErrDecrypt
+	}
+	content, ok := box.OpenAnonymous(nil, sealed, &id.public.Box, &id.boxKey)
+	if !ok {
+		return Message{}, ErrDecrypt
+	}
+	msg.Content = string(content)
+	msg.Encrypted = false
+	return msg, nil
+}
+
+// signedData is what a signature covers: the ID, the time, the sender, the recipient
+// and the ciphertext
+func signedData(msg Message) []byte {
+	var buf bytes.Buffer
+	timestamp := strconv.FormatInt(msg.Timestamp, 10)
+	for _, part := range []string{signatureContext, msg.ID, timestamp, msg.Sender, msg.Recipient, msg.Content} {
+		buf.WriteString(part)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func verifySignature(msg Message, sender PublicKeys) bool {
+	return len(sender.Sign) == ed25519.PublicKeySize &&
+		ed25519.Verify(sender.Sign, signedData(msg), msg.Signature)
+}
+
+// keyring holds the public keys registered with a broker
+type keyring struct {
+	mutex    sync.RWMutex
+	keys     map[string]PublicKeys
+	required bool // Plaintext direct messages are rejected
+
+	acceptedMutex sync.Mutex
+	accepted      map[string]int64 // IDs of accepted encrypted messages -> their Timestamp
+	pruned        int64            // When accepted was last pruned
+}
+
+// RegisterKey publishes a user's public keys. Replacing different keys announces the change
+// to every registered user with an EventKeyChange, so their clients can warn about it.
+// Keys are local to the broker; with a Transport, register them on every broker.
+func (b *Broker) RegisterKey(userID string, keys PublicKeys) error {
+	if !keys.valid() {
+		return ErrInvalidKey
+	}
+	keys.Sign = bytes.Clone(keys.Sign)
+	b.keys.mutex.Lock()
+	old, existed := b.keys.keys[userID]
+	b.keys.keys[userID] = keys
+	b.keys.mutex.Unlock()
+
+	if existed && !old.Equal(keys) {
+		return b.enqueue(envelope{msg: Message{
+			Type:      EventKeyChange,
+			Sender:    userID,
+			Content:   keys.Fingerprint(),
+			Broadcast: true,
+			System:    true,
+		}})
+	}
+	return nil
+}
+
+// PublicKey returns the keys registered for a user, ErrNoKey if there are none
+func (b *Broker) PublicKey(userID string) (PublicKeys, error) {
+	b.keys.mutex.RLock()
+	defer b.keys.mutex.RUnlock()
+	keys, ok := b.keys.keys[userID]
+	if !ok {
+		return PublicKeys{}, ErrNoKey
+	}
+	return keys, nil
+}
+
+// SetEncryptionRequired makes SendMessage reject direct messages that are not encrypted
+func (b *Broker) SetEncryptionRequired(required bool) {
+	b.keys.mutex.Lock()
+	defer b.keys.mutex.Unlock()
+	b.keys.required = required
+}
+
+// checkEncryption verifies the signature of an encrypted message against the sender's
+// registered keys, that the recipient has keys, and that the message is not a replay.
+// The broker cannot read the content, so whether it decrypts is up to the recipient's Open.
+func (b *Broker) checkEncryption(msg Message) error {
+	b.keys.mutex.RLock()
+	if !msg.Encrypted {
+		required := b.keys.required
+		b.keys.mutex.RUnlock()
+		if required && msg.Type == EventMessage && msg.Room == "" && !msg.Broadcast {
+			return ErrNotEncrypted
+		}
+		return nil
+	}
+	sender, hasSender := b.keys.keys[msg.Sender]
+	_, hasRecipient := b.keys.keys[msg.Recipient]
+	b.keys.mutex.RUnlock()
+
+	if msg.Type != EventMessage || msg.Room != "" || msg.Broadcast {
+		return ErrEncryptedTarget
+	}
+	if !hasSender || !hasRecipient {
+		return ErrNoKey
+	}
+	if !verifySignature(msg, sender) {
+		return ErrBadSignature
+	}
+	return b.keys.accept(msg, b.clock.Now().UnixNano())
+}
+
+// accept records the ID of a verified encrypted message, rejecting IDs accepted before
+// and timestamps further than MaxEncryptedAge from now
+func (k *keyring) accept(msg Message, now int64) error {
+	window := int64(MaxEncryptedAge)
+	if msg.ID == "" || msg.Timestamp < now-window || msg.Timestamp > now+window {
+		return ErrReplay
+	}
+	k.acceptedMutex.Lock()
+	defer k.acceptedMutex.Unlock()
+	if _, ok := k.accepted[msg.ID]; ok {
+		return ErrReplay
+	}
+	// IDs older than the window can be forgotten, their timestamps are rejected anyway
+	if now-k.pruned > window {
+		for id, ts := range k.accepted {
+			if ts < now-window {
+				delete(k.accepted, id)
+			}
+		}
+		k.pruned = now
+	}
+	k.accepted[msg.ID] = msg.Timestamp
+	return nil
+}
+
+// forget removes the ID of an accepted encrypted message that was not sent after all
+func (k *keyring) forget(msg Message) {
+	if !msg.Encrypted {
+		return
+	}
+	k.acceptedMutex.Lock()
+	defer k.acceptedMutex.Unlock()
+	delete(k.accepted, msg.ID)
+}
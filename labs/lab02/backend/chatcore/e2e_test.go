@@ -0,0 +1,261 @@
+package chatcore
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newIdentity(t *testing.T, broker *Broker, userID string) *Identity {
+	t.Helper()
+	id, err := NewIdentity(userID)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	if err := broker.RegisterKey(userID, id.PublicKeys()); err != nil {
+		t.Fatalf("RegisterKey: %v", err)
+	}
+	return id
+}
+
+// flipFirst changes the first character of a base64 string to another valid one
+func flipFirst(s string) string {
+	if s[0] == 'A' {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
+
+func TestEncryptedDirectMessage(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	broker.SetEncryptionRequired(true)
+	alice, bob := newIdentity(t, broker, "alice"), newIdentity(t, broker, "bob")
+	b := newRoomTestUser("bob")
+	broker.RegisterUser(b.ID, b.Recv)
+
+	bobKeys, err := broker.PublicKey("bob")
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+	sealed, err := alice.Seal(Message{Recipient: "bob", Content: "the password is swordfish"}, bobKeys)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if err := broker.SendMessage(sealed); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	received := expectMessage(t, b, func(m Message) bool { return m.Encrypted && m.Sender == "alice" }, "encrypted message")
+	if strings.Contains(received.Content, "swordfish") {
+		t.Errorf("Expected the broker to route ciphertext, got %q", received.Content)
+	}
+	if pending := broker.Pending("bob"); len(pending) != 1 || !pending[0].Encrypted {
+		t.Errorf("Expected the mailbox to keep the ciphertext, got %+v", pending)
+	}
+
+	aliceKeys, _ := broker.PublicKey("alice")
+	opened, err := bob.Open(received, aliceKeys)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if opened.Content != "the password is swordfish" || opened.Encrypted {
+		t.Errorf("Expected the plaintext, got %+v", opened)
+	}
+
+	// Broadcasts and rooms stay in plaintext, direct messages must not
+	if err := broker.SendMessage(Message{Sender: "alice", Content: "hi all", Broadcast: true}); err != nil {
+		t.Errorf("Expected a plaintext broadcast to pass, got %v", err)
+	}
+	if err := broker.SendMessage(Message{Sender: "alice", Recipient: "bob", Content: "psst"}); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestEncryptedMessageVerification(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	alice, _ := newIdentity(t, broker, "alice"), newIdentity(t, broker, "bob")
+	mallory, err := NewIdentity("alice") // Claims to be alice with keys of her own
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	bobKeys, _ := broker.PublicKey("bob")
+	sealed, _ := alice.Seal(Message{Recipient: "bob", Content: "hello"}, bobKeys)
+
+	tampered := sealed
+	tampered.Content = flipFirst(sealed.Content)
+	redirected := sealed
+	redirected.Recipient = "carol"
+	broker.RegisterKey("carol", bobKeys)
+	forged, _ := mallory.Seal(Message{Recipient: "bob", Content: "send money"}, bobKeys)
+	unknown := sealed
+	unknown.Recipient = "dave"
+
+	changedID := sealed
+	changedID.ID = "e2e-other"
+	stale, _ := alice.Seal(Message{Recipient: "bob", Content: "old", Timestamp: time.Now().Add(-time.Hour).UnixNano()}, bobKeys)
+	future, _ := alice.Seal(Message{Recipient: "bob", Content: "early", Timestamp: time.Now().Add(time.Hour).UnixNano()}, bobKeys)
+
+	tests := []struct {
+		name string
+		msg  Message
+		err  error
+	}{
+		{"valid", sealed, nil},
+		{"replayed", sealed, ErrReplay},
+		{"changed ID", changedID, ErrBadSignature},
+		{"stale", stale, ErrReplay},
+		{"from the future", future, ErrReplay},
+		{"tampered content", tampered, ErrBadSignature},
+		{"changed recipient", redirected, ErrBadSignature},
+		{"forged sender", forged, ErrBadSignature},
+		{"recipient without key", unknown, ErrNoKey},
+		{"encrypted broadcast", Message{Sender: "alice", Broadcast: true, Encrypted: true}, ErrEncryptedTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := broker.SendMessage(tt.msg); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedReplayWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock(time.Now())
+	broker := NewBroker(ctx)
+	broker.SetClock(clock)
+	go broker.Run()
+	alice, _ := newIdentity(t, broker, "alice"), newIdentity(t, broker, "bob")
+	bobKeys, _ := broker.PublicKey("bob")
+
+	first, _ := alice.Seal(Message{Recipient: "bob", Content: "first"}, bobKeys)
+	if err := broker.SendMessage(first); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	// Once the window has passed the ID is forgotten, and the timestamp rejects the replay
+	clock.Advance(MaxEncryptedAge + time.Second)
+	second, _ := alice.Seal(Message{Recipient: "bob", Content: "second", Timestamp: clock.Now().UnixNano()}, bobKeys)
+	if err := broker.SendMessage(second); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if _, ok := broker.keys.accepted[first.ID]; ok {
+		t.Error("Expected the expired ID to be pruned")
+	}
+	if err := broker.SendMessage(first); !errors.Is(err, ErrReplay) {
+		t.Errorf("Expected ErrReplay, got %v", err)
+	}
+}
+
+func TestRejectedEncryptedMessageCanBeRetried(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	alice, _ := newIdentity(t, broker, "alice"), newIdentity(t, broker, "bob")
+	bobKeys, _ := broker.PublicKey("bob")
+	clock := newFakeClock(time.Now())
+	limiter, _ := NewRateLimiter(1, time.Minute, 1)
+	limiter.SetClock(clock)
+	broker.Use(limiter)
+
+	first, _ := alice.Seal(Message{Recipient: "bob", Content: "first"}, bobKeys)
+	second, _ := alice.Seal(Message{Recipient: "bob", Content: "second"}, bobKeys)
+	if err := broker.SendMessage(first); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if err := broker.SendMessage(second); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited, got %v", err)
+	}
+	// The rejected message was not sent, so sending it again is not a replay
+	clock.Advance(time.Minute)
+	if err := broker.SendMessage(second); err != nil {
+		t.Errorf("Expected the retry to be sent, got %v", err)
+	}
+	if err := broker.SendMessage(second); !errors.Is(err, ErrReplay) {
+		t.Errorf("Expected ErrReplay once sent, got %v", err)
+	}
+}
+
+func TestOpenRejectsTamperingAndWrongKeys(t *testing.T) {
+	alice, _ := NewIdentity("alice")
+	bob, _ := NewIdentity("bob")
+	carol, _ := NewIdentity("carol")
+	sealed, err := alice.Seal(Message{Recipient: "bob", Content: "for bob only"}, bob.PublicKeys())
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	tampered := sealed
+	tampered.Content = flipFirst(sealed.Content)
+	tests := []struct {
+		name   string
+		reader *Identity
+		msg    Message
+		sender PublicKeys
+		err    error
+	}{
+		{"recipient", bob, sealed, alice.PublicKeys(), nil},
+		{"other user", carol, sealed, alice.PublicKeys(), ErrDecrypt},
+		{"wrong sender key", bob, sealed, carol.PublicKeys(), ErrBadSignature},
+		{"tampered", bob, tampered, alice.PublicKeys(), ErrBadSignature},
+		{"plaintext", bob, Message{Sender: "alice", Content: "hi"}, alice.PublicKeys(), ErrNotEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.reader.Open(tt.msg, tt.sender); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	if _, err := alice.Seal(Message{Recipient: "bob"}, PublicKeys{}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestKeyChangeNotification(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	a := newRoomTestUser("alice")
+	broker.RegisterUser(a.ID, a.Recv)
+	bob := newIdentity(t, broker, "bob")
+
+	// Registering the same keys again is not a change
+	if err := broker.RegisterKey("bob", bob.PublicKeys()); err != nil {
+		t.Fatalf("RegisterKey: %v", err)
+	}
+	newBob := newIdentity(t, broker, "bob")
+	fingerprint := newBob.PublicKeys().Fingerprint()
+	expectMessage(t, a, func(m Message) bool {
+		return m.Type == EventKeyChange && m.System && m.Sender == "bob" && m.Content == fingerprint
+	}, "key change")
+	expectNoMessage(t, a)
+
+	// Messages sealed for the old key cannot be read with the new one
+	alice, _ := NewIdentity("alice")
+	sealed, _ := alice.Seal(Message{Recipient: "bob", Content: "old"}, bob.PublicKeys())
+	if _, err := newBob.Open(sealed, alice.PublicKeys()); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt, got %v", err)
+	}
+	if err := broker.RegisterKey("bob", PublicKeys{}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if _, err := broker.PublicKey("nobody"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+	if err := broker.SendMessage(Message{Type: EventKeyChange, Sender: "bob", Broadcast: true}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Expected users not to send key changes, got %v", err)
+	}
+}
+
+func TestContentFiltersSkipEncrypted(t *testing.T) {
+	alice, _ := NewIdentity("alice")
+	bob, _ := NewIdentity("bob")
+	sealed, _ := alice.Seal(Message{Recipient: "bob", Content: "darn"}, bob.PublicKeys())
+	// Masking every letter would corrupt the ciphertext
+	filter := NewRegexFilter(true, regexp.MustCompile(`[A-Za-z]`))
+	got, err := filter.Intercept(sealed)
+	if err != nil || got.Content != sealed.Content {
+		t.Errorf("Expected the ciphertext unchanged, got %q (%v)", got.Content, err)
+	}
+}
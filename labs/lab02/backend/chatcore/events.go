@@ -0,0 +1,188 @@
+package chatcore
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the kind of event a Message carries
+type EventType string
+
+const (
+	EventMessage     EventType = "message" // Default for messages sent without a type
+	EventTypingStart EventType = "typing-start"
+	EventTypingStop  EventType = "typing-stop"
+	EventReadReceipt EventType = "read-receipt" // Ref is the ID of the message read
+	EventPresence    EventType = "presence"     // Sent by the broker, Presence is the new status of Sender
+	EventKeyChange   EventType = "key-change"   // Sent by the broker, Content is the fingerprint of Sender's new keys
+	EventAck         EventType = "ack"          // Sent between brokers over a Transport, Sender acknowledged Ref
+)
+
+// Presence is the status of a user
+type Presence string
+
+const (
+	Online  Presence = "online"
+	Away    Presence = "away"
+	Offline Presence = "offline"
+)
+
+// PresenceOptions configures presence tracking
+type PresenceOptions struct {
+	Notify      bool          // Broadcast presence changes to every registered user
+	IdleTimeout time.Duration // Users without activity for this long become Away; 0 disables
+}
+
+// presenceTracker holds the status of the registered users
+type presenceTracker struct {
+	mutex sync.Mutex
+	opts  PresenceOptions
+	users map[string]*presenceState
+}
+
+type presenceState struct {
+	status     Presence
+	lastActive time.Time
+}
+
+// SetPresenceOptions configures presence tracking. It must be called before Run.
+func (b *Broker) SetPresenceOptions(opts PresenceOptions) {
+	b.presence.mutex.Lock()
+	defer b.presence.mutex.Unlock()
+	b.presence.opts = opts
+}
+
+// Presence returns the status of a user registered with this broker, Offline for anyone else
+func (b *Broker) Presence(userID string) Presence {
+	b.presence.mutex.Lock()
+	defer b.presence.mutex.Unlock()
+	if state, ok := b.presence.users[userID]; ok {
+		return state.status
+	}
+	return Offline
+}
+
+// validateEvent checks a user-sent event and fills in the default type
+func validateEvent(msg *Message) error {
+	switch msg.Type {
+	case "":
+		msg.Type = EventMessage
+	case EventMessage, EventTypingStart, EventTypingStop:
+	case EventReadReceipt:
+		if msg.Ref == "" {
+			return ErrInvalidEvent
+		}
+	default:
+		return ErrInvalidEvent
+	}
+	return nil
+}
+
+// setPresence records a status change, announcing it if enabled.
+// Offline removes the user from the tracker.
+func (b *Broker) setPresence(userID string, status Presence) {
+	if b.updatePresence(userID, status) {
+		b.notifyPresence(userID, status, b.enqueue)
+	}
+}
+
+// updatePresence records a status change and reports whether the status changed
+func (b *Broker) updatePresence(userID string, status Presence) bool {
+	b.presence.mutex.Lock()
+	defer b.presence.mutex.Unlock()
+	state, ok := b.presence.users[userID]
+	if status == Offline {
+		delete(b.presence.users, userID)
+		return ok
+	}
+	if !ok {
+		state = &presenceState{status: Offline}
+		b.presence.users[userID] = state
+	}
+	state.lastActive = b.clock.Now()
+	changed := state.status != status
+	state.status = status
+	return changed
+}
+
+// touch records activity of a registered user, bringing them back Online from Away
+func (b *Broker) touch(userID string) {
+	b.presence.mutex.Lock()
+	state, ok := b.presence.users[userID]
+	if !ok {
+		b.presence.mutex.Unlock()
+		return
+	}
+	state.lastActive = b.clock.Now()
+	back := state.status == Away
+	state.status = Online
+	b.presence.mutex.Unlock()
+
+	if back {
+		b.notifyPresence(userID, Online, b.enqueue)
+	}
+}
+
+// notifyPresence broadcasts a status change through send if notifications are enabled
+func (b *Broker) notifyPresence(userID string, status Presence, send func(envelope) error) {
+	b.presence.mutex.Lock()
+	notify := b.presence.opts.Notify
+	b.presence.mutex.Unlock()
+	if !notify {
+		return
+	}
+	send(envelope{msg: Message{
+		Type:      EventPresence,
+		Sender:    userID,
+		Presence:  status,
+		Broadcast: true,
+		System:    true,
+	}})
+}
+
+// watchIdle marks users Away once they have been inactive for the idle timeout.
+// It sleeps until the earliest user could become idle.
+func (b *Broker) watchIdle(timeout time.Duration) {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-b.clock.After(b.nextIdleCheck(timeout)):
+		}
+		for _, userID := range b.idleUsers(timeout) {
+			b.notifyPresence(userID, Away, b.enqueue)
+		}
+	}
+}
+
+// nextIdleCheck returns how long until the earliest Online user reaches the idle timeout
+func (b *Broker) nextIdleCheck(timeout time.Duration) time.Duration {
+	b.presence.mutex.Lock()
+	defer b.presence.mutex.Unlock()
+	now := b.clock.Now()
+	next := timeout
+	for _, state := range b.presence.users {
+		if state.status != Online {
+			continue
+		}
+		if wait := state.lastActive.Add(timeout).Sub(now); wait < next {
+			next = max(wait, 0)
+		}
+	}
+	return next
+}
+
+// idleUsers marks the Online users inactive for the timeout as Away and returns them
+func (b *Broker) idleUsers(timeout time.Duration) []string {
+	b.presence.mutex.Lock()
+	defer b.presence.mutex.Unlock()
+	now := b.clock.Now()
+	var idle []string
+	for userID, state := range b.presence.users {
+		if state.status == Online && !now.Before(state.lastActive.Add(timeout)) {
+			state.status = Away
+			idle = append(idle, userID)
+		}
+	}
+	return idle
+}
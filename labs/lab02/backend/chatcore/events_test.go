@@ -0,0 +1,143 @@
+package chatcore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func isPresence(userID string, status Presence) func(Message) bool {
+	return func(m Message) bool {
+		return m.Type == EventPresence && m.System && m.Sender == userID && m.Presence == status
+	}
+}
+
+func TestTypedEvents(t *testing.T) {
+	broker, syncer := newMailboxBroker(t)
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	broker.RegisterUser(a.ID, a.Recv)
+	broker.RegisterUser(b.ID, b.Recv)
+
+	tests := []struct {
+		name string
+		msg  Message
+		err  error
+	}{
+		{"typing start", Message{Type: EventTypingStart, Sender: "A", Recipient: "B"}, nil},
+		{"typing stop", Message{Type: EventTypingStop, Sender: "A", Recipient: "B"}, nil},
+		{"receipt without ref", Message{Type: EventReadReceipt, Sender: "A", Recipient: "B"}, ErrInvalidEvent},
+		{"presence from user", Message{Type: EventPresence, Sender: "A", Presence: Away, Broadcast: true}, ErrInvalidEvent},
+		{"unknown type", Message{Type: "poke", Sender: "A", Recipient: "B"}, ErrInvalidEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := broker.SendMessage(tt.msg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if err == nil {
+				expectMessage(t, b, func(m Message) bool { return m.Type == tt.msg.Type && m.Sender == "A" }, string(tt.msg.Type))
+			}
+		})
+	}
+	sendAndSync(t, broker, "B", 0, syncer)
+	if pending := broker.Pending("B"); len(pending) != 0 {
+		t.Errorf("Expected typing events to skip the mailbox, got %+v", pending)
+	}
+
+	// A read receipt reaches the original sender and acknowledges the message
+	broker.SendMessage(Message{Sender: "A", Recipient: "B", Content: "hi"})
+	hi := expectMessage(t, b, func(m Message) bool { return m.Type == EventMessage && m.Content == "hi" }, "message")
+	if err := broker.SendMessage(Message{Type: EventReadReceipt, Sender: "B", Recipient: "A", Ref: hi.ID}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	expectMessage(t, a, func(m Message) bool { return m.Type == EventReadReceipt && m.Ref == hi.ID }, "read receipt")
+	if pending := broker.Pending("B"); len(pending) != 0 {
+		t.Errorf("Expected the read message to be acknowledged, got %+v", pending)
+	}
+}
+
+func TestPresenceOnRegister(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	broker.SetPresenceOptions(PresenceOptions{Notify: true})
+	go broker.Run()
+
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	if got := broker.Presence("A"); got != Offline {
+		t.Errorf("Expected %s before registration, got %s", Offline, got)
+	}
+	broker.RegisterUser(a.ID, a.Recv)
+	expectMessage(t, a, isPresence("A", Online), "own presence")
+	broker.RegisterUser(b.ID, b.Recv)
+	expectMessage(t, a, isPresence("B", Online), "B online")
+	expectMessage(t, b, isPresence("B", Online), "own presence")
+	if got := broker.Presence("B"); got != Online {
+		t.Errorf("Expected %s, got %s", Online, got)
+	}
+
+	broker.UnregisterUser(b.ID)
+	expectMessage(t, a, isPresence("B", Offline), "B offline")
+	if got := broker.Presence("B"); got != Offline {
+		t.Errorf("Expected %s, got %s", Offline, got)
+	}
+	expectNoMessage(t, a)
+}
+
+func TestPresenceWithoutNotify(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	a := newRoomTestUser("A")
+	broker.RegisterUser(a.ID, a.Recv)
+	if got := broker.Presence("A"); got != Online {
+		t.Errorf("Expected %s, got %s", Online, got)
+	}
+	expectNoMessage(t, a)
+}
+
+func TestPresenceIdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	broker := NewBroker(ctx)
+	broker.SetClock(clock)
+	broker.SetPresenceOptions(PresenceOptions{Notify: true, IdleTimeout: 5 * time.Minute})
+
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	broker.RegisterUser(a.ID, a.Recv)
+	broker.RegisterUser(b.ID, b.Recv)
+	go broker.Run()
+	expectMessage(t, a, isPresence("A", Online), "A online")
+	expectMessage(t, a, isPresence("B", Online), "B online")
+
+	clock.waitForWaiter(t)
+	clock.Advance(4 * time.Minute)
+	broker.SendMessage(Message{Sender: "B", Recipient: "A", Content: "still here"})
+	expectContents(t, a, "still here")
+
+	// A has been idle for the timeout, B only for a minute
+	clock.waitForWaiter(t)
+	clock.Advance(time.Minute)
+	expectMessage(t, a, isPresence("A", Away), "A away")
+	if got := broker.Presence("B"); got != Online {
+		t.Errorf("Expected B %s, got %s", Online, got)
+	}
+
+	clock.waitForWaiter(t)
+	clock.Advance(4 * time.Minute)
+	expectMessage(t, a, isPresence("B", Away), "B away")
+
+	// Activity brings a user back
+	broker.SendMessage(Message{Type: EventTypingStart, Sender: "A", Recipient: "B"})
+	for _, want := range []struct {
+		userID string
+		status Presence
+	}{{"A", Online}, {"B", Online}, {"A", Away}, {"B", Away}, {"A", Online}} {
+		expectMessage(t, b, isPresence(want.userID, want.status), want.userID+" "+string(want.status))
+	}
+	expectMessage(t, b, func(m Message) bool { return m.Type == EventTypingStart }, "typing")
+	if got := broker.Presence("A"); got != Online {
+		t.Errorf("Expected A %s, got %s", Online, got)
+	}
+}
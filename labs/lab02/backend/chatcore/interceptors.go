@@ -0,0 +1,313 @@
+package chatcore
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrRejected is matched by every error of the built-in interceptors
+var ErrRejected = errors.New("message rejected")
+
+// Rejection reasons of the built-in interceptors
+var (
+	ErrBlockedContent = fmt.Errorf("%w: blocked content", ErrRejected)
+	ErrContentTooLong = fmt.Errorf("%w: content too long", ErrRejected)
+	ErrRateLimited    = fmt.Errorf("%w: rate limit exceeded", ErrRejected)
+	ErrBlockedSender  = fmt.Errorf("%w: sender is blocked by the recipient", ErrRejected)
+)
+
+// ErrInvalidRateLimit is returned by NewRateLimiter for limits that allow nothing
+var ErrInvalidRateLimit = errors.New("rate, interval and burst must be positive")
+
+// Interceptor runs between SendMessage and delivery. It returns the message to deliver,
+// possibly transformed or annotated, or an error that SendMessage returns to the sender.
+type Interceptor interface {
+	Intercept(msg Message) (Message, error)
+}
+
+// InterceptorFunc adapts a function to an Interceptor
+type InterceptorFunc func(msg Message) (Message, error)
+
+// Intercept calls f(msg)
+func (f InterceptorFunc) Intercept(msg Message) (Message, error) {
+	return f(msg)
+}
+
+// Use appends interceptors to the chain run by SendMessage, in order.
+// System messages generated by the broker skip the chain.
+func (b *Broker) Use(interceptors ...Interceptor) {
+	b.chainMutex.Lock()
+	defer b.chainMutex.Unlock()
+	b.chain = append(b.chain, interceptors...)
+}
+
+// intercept runs msg through the chain, stopping at the first rejection
+func (b *Broker) intercept(msg Message) (Message, error) {
+	b.chainMutex.RLock()
+	chain := b.chain
+	b.chainMutex.RUnlock()
+	for _, interceptor := range chain {
+		var err error
+		if msg, err = interceptor.Intercept(msg); err != nil {
+			return Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// WithMeta returns a copy of msg with an annotation added; the original Meta map is not modified
+func (m Message) WithMeta(key, value string) Message {
+	meta := maps.Clone(m.Meta)
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	meta[key] = value
+	m.Meta = meta
+	return m
+}
+
+// MetaFiltered is the annotation set by content filters that masked part of a message
+const MetaFiltered = "filtered"
+
+// ContentTooLongError is returned for messages longer than MaxContentLength
+type ContentTooLongError struct {
+	Length, Max int // In characters
+}
+
+func (e *ContentTooLongError) Error() string {
+	return fmt.Sprintf("%v (%d characters, at most %d)", ErrContentTooLong, e.Length, e.Max)
+}
+
+func (e *ContentTooLongError) Unwrap() error { return ErrContentTooLong }
+
+// MaxContentLength rejects messages whose content has more characters than its value
+type MaxContentLength int
+
+// Intercept implements Interceptor
+func (m MaxContentLength) Intercept(msg Message) (Message, error) {
+	if n := utf8.RuneCountInString(msg.Content); n > int(m) {
+		return Message{}, &ContentTooLongError{Length: n, Max: int(m)}
+	}
+	return msg, nil
+}
+
+// WordFilter rejects or masks messages containing any of its words, ignoring case.
+// Words are matched whole, in any script. Encrypted messages pass unchanged.
+type WordFilter struct {
+	words map[string]struct{}
+	mask  bool
+}
+
+// NewWordFilter creates a filter for words. With mask set, matching words are replaced
+// by asterisks and the message is annotated with MetaFiltered instead of being rejected.
+func NewWordFilter(mask bool, words ...string) *WordFilter {
+	f := &WordFilter{words: make(map[string]struct{}, len(words)), mask: mask}
+	for _, w := range words {
+		f.words[strings.ToLower(w)] = struct{}{}
+	}
+	return f
+}
+
+// Intercept implements Interceptor
+func (f *WordFilter) Intercept(msg Message) (Message, error) {
+	if msg.Encrypted {
+		return msg, nil
+	}
+	var out strings.Builder
+	found := false
+	content := msg.Content
+	for len(content) > 0 {
+		// Copy everything up to the next word, then the word itself
+		start := strings.IndexFunc(content, isWordRune)
+		if start < 0 {
+			out.WriteString(content)
+			break
+		}
+		out.WriteString(content[:start])
+		content = content[start:]
+		end := strings.IndexFunc(content, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(content)
+		}
+		word := content[:end]
+		content = content[end:]
+		if _, ok := f.words[strings.ToLower(word)]; !ok {
+			out.WriteString(word)
+			continue
+		}
+		if !f.mask {
+			return Message{}, ErrBlockedContent
+		}
+		found = true
+		out.WriteString(strings.Repeat("*", utf8.RuneCountInString(word)))
+	}
+	if !found {
+		return msg, nil
+	}
+	msg.Content = out.String()
+	return msg.WithMeta(MetaFiltered, "true"), nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// RegexFilter rejects or masks messages matching any of its patterns. Encrypted messages pass unchanged.
+type RegexFilter struct {
+	patterns []*regexp.Regexp
+	mask     bool
+}
+
+// NewRegexFilter creates a filter for patterns. With mask set, matches are replaced
+// by asterisks and the message is annotated with MetaFiltered instead of being rejected.
+func NewRegexFilter(mask bool, patterns ...*regexp.Regexp) *RegexFilter {
+	return &RegexFilter{patterns: patterns, mask: mask}
+}
+
+// Intercept implements Interceptor
+func (f *RegexFilter) Intercept(msg Message) (Message, error) {
+	if msg.Encrypted {
+		return msg, nil
+	}
+	found := false
+	for _, re := range f.patterns {
+		if !re.MatchString(msg.Content) {
+			continue
+		}
+		if !f.mask {
+			return Message{}, ErrBlockedContent
+		}
+		found = true
+		msg.Content = re.ReplaceAllStringFunc(msg.Content, func(s string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(s))
+		})
+	}
+	if !found {
+		return msg, nil
+	}
+	return msg.WithMeta(MetaFiltered, "true"), nil
+}
+
+// RateLimitError is returned when a sender exceeds their rate limit
+type RateLimitError struct {
+	Sender     string
+	RetryAfter time.Duration // Until the next message is allowed
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v for %s, retry after %v", ErrRateLimited, e.Sender, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// RateLimiter limits how many messages each sender may send, using a token bucket per sender.
+// Every message that reaches it takes a token, so add it with Use after the interceptors
+// that may reject a message, such as a BlockList.
+type RateLimiter struct {
+	mutex   sync.Mutex
+	clock   Clock
+	every   time.Duration // One token is added per interval
+	burst   int
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each sender rate messages per interval on average, with bursts
+// of up to burst messages
+func NewRateLimiter(rate int, per time.Duration, burst int) (*RateLimiter, error) {
+	if rate <= 0 || per <= 0 || burst <= 0 {
+		return nil, fmt.Errorf("%w: %d per %v, burst %d", ErrInvalidRateLimit, rate, per, burst)
+	}
+	return &RateLimiter{
+		clock:   SystemClock,
+		every:   max(per/time.Duration(rate), 1),
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+	}, nil
+}
+
+// SetClock replaces the clock used to refill the buckets
+func (l *RateLimiter) SetClock(clock Clock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.clock = clock
+}
+
+// Intercept implements Interceptor
+func (l *RateLimiter) Intercept(msg Message) (Message, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.clock.Now()
+	b, ok := l.buckets[msg.Sender]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[msg.Sender] = b
+	}
+	b.tokens = min(float64(l.burst), b.tokens+float64(now.Sub(b.last))/float64(l.every))
+	b.last = now
+	if b.tokens < 1 {
+		retry := time.Duration((1 - b.tokens) * float64(l.every))
+		return Message{}, &RateLimitError{Sender: msg.Sender, RetryAfter: retry}
+	}
+	b.tokens--
+	return msg, nil
+}
+
+// BlockList rejects direct messages and events to users who blocked the sender.
+// Room messages and broadcasts are not affected.
+type BlockList struct {
+	mutex   sync.RWMutex
+	blocked map[string]map[string]struct{} // userID -> users they blocked
+}
+
+// NewBlockList creates an empty block list
+func NewBlockList() *BlockList {
+	return &BlockList{blocked: make(map[string]map[string]struct{})}
+}
+
+// Block stops messages from blocked to userID
+func (l *BlockList) Block(userID, blocked string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.blocked[userID] == nil {
+		l.blocked[userID] = make(map[string]struct{})
+	}
+	l.blocked[userID][blocked] = struct{}{}
+}
+
+// Unblock allows messages from blocked to userID again
+func (l *BlockList) Unblock(userID, blocked string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.blocked[userID], blocked)
+	if len(l.blocked[userID]) == 0 {
+		delete(l.blocked, userID)
+	}
+}
+
+// IsBlocked reports whether userID blocked sender
+func (l *BlockList) IsBlocked(userID, sender string) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	_, ok := l.blocked[userID][sender]
+	return ok
+}
+
+// Intercept implements Interceptor
+func (l *BlockList) Intercept(msg Message) (Message, error) {
+	if msg.Room == "" && !msg.Broadcast && l.IsBlocked(msg.Recipient, msg.Sender) {
+		return Message{}, ErrBlockedSender
+	}
+	return msg, nil
+}
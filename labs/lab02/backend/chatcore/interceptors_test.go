@@ -0,0 +1,203 @@
+package chatcore
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxContentLength(t *testing.T) {
+	limit := MaxContentLength(5)
+	if _, err := limit.Intercept(Message{Content: "привет"[:10]}); err != nil {
+		t.Errorf("Expected 5 Cyrillic characters to pass, got %v", err)
+	}
+	_, err := limit.Intercept(Message{Content: "привет"})
+	var tooLong *ContentTooLongError
+	if !errors.As(err, &tooLong) || tooLong.Length != 6 || tooLong.Max != 5 {
+		t.Fatalf("Expected ContentTooLongError for 6 of 5 characters, got %v", err)
+	}
+	if !errors.Is(err, ErrContentTooLong) || !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected the error to match ErrContentTooLong and ErrRejected, got %v", err)
+	}
+}
+
+func TestContentFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   Interceptor
+		content  string
+		expected string
+		err      error
+		filtered bool
+	}{
+		{"clean", NewWordFilter(false, "darn"), "hello there", "hello there", nil, false},
+		{"reject word", NewWordFilter(false, "darn"), "oh DARN it", "", ErrBlockedContent, false},
+		{"part of a word", NewWordFilter(false, "darn"), "darned socks", "darned socks", nil, false},
+		{"mask words", NewWordFilter(true, "darn", "блин"), "darn, Блин! darn", "****, ****! ****", nil, true},
+		{"reject pattern", NewRegexFilter(false, regexp.MustCompile(`\d{4}-\d{4}`)), "card 1234-5678", "", ErrBlockedContent, false},
+		{"mask pattern", NewRegexFilter(true, regexp.MustCompile(`\d{4}-\d{4}`)), "card 1234-5678", "card *********", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.filter.Intercept(Message{Content: tt.content})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if msg.Content != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, msg.Content)
+			}
+			if filtered := msg.Meta[MetaFiltered] == "true"; filtered != tt.filtered {
+				t.Errorf("Expected filtered annotation %v, got %v", tt.filtered, msg.Meta)
+			}
+		})
+	}
+}
+
+func TestWithMetaCopies(t *testing.T) {
+	original := Message{Meta: map[string]string{"a": "1"}}
+	annotated := original.WithMeta("b", "2")
+	if _, ok := original.Meta["b"]; ok {
+		t.Error("Expected the original Meta to stay unchanged")
+	}
+	if annotated.Meta["a"] != "1" || annotated.Meta["b"] != "2" {
+		t.Errorf("Expected both annotations, got %v", annotated.Meta)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter, err := NewRateLimiter(1, time.Second, 3)
+	if err != nil {
+		t.Fatalf("NewRateLimiter: %v", err)
+	}
+	limiter.SetClock(clock)
+
+	for i := 0; i < 3; i++ {
+		if _, err := limiter.Intercept(Message{Sender: "A"}); err != nil {
+			t.Fatalf("Message %d: expected burst to pass, got %v", i, err)
+		}
+	}
+	_, err = limiter.Intercept(Message{Sender: "A"})
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || limited.RetryAfter != time.Second || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected RateLimitError with 1s retry, got %v", err)
+	}
+	if _, err := limiter.Intercept(Message{Sender: "B"}); err != nil {
+		t.Errorf("Expected other senders unaffected, got %v", err)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if _, err := limiter.Intercept(Message{Sender: "A"}); !errors.As(err, &limited) || limited.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected 500ms retry, got %v", err)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if _, err := limiter.Intercept(Message{Sender: "A"}); err != nil {
+		t.Errorf("Expected a refilled token, got %v", err)
+	}
+}
+
+func TestNewRateLimiterRejectsInvalidLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  int
+		per   time.Duration
+		burst int
+	}{
+		{"zero rate", 0, time.Second, 1},
+		{"negative rate", -1, time.Second, 1},
+		{"zero interval", 1, 0, 1},
+		{"zero burst", 1, time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRateLimiter(tt.rate, tt.per, tt.burst); !errors.Is(err, ErrInvalidRateLimit) {
+				t.Errorf("Expected ErrInvalidRateLimit, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiterIgnoresRejectedRoomMessages(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	limiter, _ := NewRateLimiter(1, time.Hour, 1)
+	broker.Use(limiter)
+	a := newRoomTestUser("A")
+	broker.RegisterUser(a.ID, a.Recv)
+
+	if err := broker.SendMessage(Message{Sender: "A", Room: "go", Content: "not a member"}); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("Expected ErrNotMember, got %v", err)
+	}
+	broker.JoinRoom("A", "go")
+	if err := broker.SendMessage(Message{Sender: "A", Room: "go", Content: "member"}); err != nil {
+		t.Errorf("Expected the token unspent by the rejected message, got %v", err)
+	}
+}
+
+func TestBlockList(t *testing.T) {
+	list := NewBlockList()
+	list.Block("B", "A")
+	tests := []struct {
+		name string
+		msg  Message
+		err  error
+	}{
+		{"blocked direct", Message{Sender: "A", Recipient: "B"}, ErrBlockedSender},
+		{"blocked typing", Message{Type: EventTypingStart, Sender: "A", Recipient: "B"}, ErrBlockedSender},
+		{"other direction", Message{Sender: "B", Recipient: "A"}, nil},
+		{"room", Message{Sender: "A", Room: "go"}, nil},
+		{"broadcast", Message{Sender: "A", Broadcast: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := list.Intercept(tt.msg); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+	list.Unblock("B", "A")
+	if list.IsBlocked("B", "A") {
+		t.Error("Expected A to be unblocked")
+	}
+}
+
+func TestBrokerInterceptorChain(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	var order []string
+	trace := func(name string) Interceptor {
+		return InterceptorFunc(func(msg Message) (Message, error) {
+			order = append(order, name)
+			return msg.WithMeta("last", name), nil
+		})
+	}
+	blocks := NewBlockList()
+	broker.Use(trace("first"), MaxContentLength(20), NewWordFilter(true, "darn"), blocks, trace("last"))
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	broker.RegisterUser(a.ID, a.Recv)
+	broker.RegisterUser(b.ID, b.Recv)
+
+	if err := broker.SendMessage(Message{Sender: "A", Recipient: "B", Content: "darn it"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	m := expectContents(t, b, "**** it")[0]
+	if m.Meta[MetaFiltered] != "true" || m.Meta["last"] != "last" {
+		t.Errorf("Expected annotations from the chain, got %v", m.Meta)
+	}
+	if strings.Join(order, ",") != "first,last" {
+		t.Errorf("Expected interceptors in order, got %v", order)
+	}
+
+	blocks.Block("B", "A")
+	if err := broker.SendMessage(Message{Sender: "A", Recipient: "B", Content: "hi"}); !errors.Is(err, ErrBlockedSender) {
+		t.Errorf("Expected ErrBlockedSender, got %v", err)
+	}
+	if err := broker.SendMessage(Message{Sender: "B", Recipient: "A", Content: strings.Repeat("x", 21)}); !errors.Is(err, ErrContentTooLong) {
+		t.Errorf("Expected ErrContentTooLong, got %v", err)
+	}
+	expectNoMessage(t, a)
+	expectNoMessage(t, b)
+}
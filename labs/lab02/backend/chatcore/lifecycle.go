@@ -0,0 +1,91 @@
+package chatcore
+
+import "context"
+
+// Close shuts the broker down gracefully. It stops accepting messages, lets Run deliver
+// the messages already queued, then closes the channels of all registered users,
+// each channel once even if several users share it.
+// If ctx is done before the queue is drained, the remaining messages are dropped and
+// ctx.Err() is returned. SendMessage returns ErrBrokerClosed once Close has been called.
+func (b *Broker) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.closing)
+		// Wait for the senders that got past the closing check, so that their
+		// messages are queued before Run starts draining
+		b.sendMutex.Lock()
+		close(b.drain)
+		b.sendMutex.Unlock()
+	})
+	if b.started.CompareAndSwap(false, true) {
+		// Run was never started, drain in its place
+		go func() {
+			defer close(b.done)
+			b.drainInput()
+		}()
+	}
+
+	var err error
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	b.cancel()
+	<-b.done
+	b.closeUsers()
+	return err
+}
+
+// Wait blocks until Run has returned, after Close or when the broker context is done
+func (b *Broker) Wait() {
+	<-b.done
+}
+
+// drainInput delivers the queued messages until the queue is empty or the broker is cancelled
+func (b *Broker) drainInput() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case env := <-b.input:
+			b.deliver(env)
+		default:
+			return
+		}
+	}
+}
+
+// closeUsers unregisters every user and closes their channels
+func (b *Broker) closeUsers() {
+	b.usersMutex.Lock()
+	defer b.usersMutex.Unlock()
+	channels := make(map[chan Message]struct{}, len(b.users))
+	for id, sub := range b.users {
+		channels[sub.ch] = struct{}{}
+		delete(b.users, id)
+	}
+	for ch := range channels {
+		close(ch)
+	}
+}
+
+// releaseChannel closes a channel the broker stopped delivering to, unless another
+// registered user still receives on it. Callers must hold usersMutex for writing.
+func (b *Broker) releaseChannel(ch chan Message) {
+	for _, sub := range b.users {
+		if sub.ch == ch {
+			return
+		}
+	}
+	close(ch)
+}
+
+// isClosing reports whether Close has been called
+func (b *Broker) isClosing() bool {
+	select {
+	case <-b.closing:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,198 @@
+package chatcore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiveAll reads u until its channel is closed and returns the contents
+func receiveAll(t *testing.T, u *testUser) []string {
+	t.Helper()
+	var contents []string
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case m, ok := <-u.Recv:
+			if !ok {
+				return contents
+			}
+			contents = append(contents, m.Content)
+		case <-timeout:
+			t.Fatalf("%s: channel was not closed", u.ID)
+		}
+	}
+}
+
+func TestBrokerCloseDrainsQueue(t *testing.T) {
+	for _, startRun := range []bool{true, false} {
+		name := "without Run"
+		if startRun {
+			name = "with Run"
+		}
+		t.Run(name, func(t *testing.T) {
+			broker := NewBroker(context.Background())
+			b := newRoomTestUser("B")
+			broker.RegisterUser(b.ID, b.Recv)
+			sendDirect(t, broker, "B", "one", "two", "three")
+			if startRun {
+				go broker.Run()
+			}
+
+			if err := broker.Close(context.Background()); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			broker.Wait()
+			got := receiveAll(t, b)
+			if len(got) != 3 || got[0] != "one" || got[2] != "three" {
+				t.Errorf("Expected the queued messages before the channel closed, got %v", got)
+			}
+		})
+	}
+}
+
+func TestBrokerClosedRejectsMessages(t *testing.T) {
+	broker := NewBroker(context.Background())
+	go broker.Run()
+	a := newRoomTestUser("A")
+	broker.RegisterUser(a.ID, a.Recv)
+	if err := broker.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if err := broker.SendMessage(Message{Sender: "A", Recipient: "A", Content: "late"}); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Expected ErrBrokerClosed, got %v", err)
+	}
+	if err := broker.JoinRoom("A", "go"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound after users were closed, got %v", err)
+	}
+	late := newRoomTestUser("late")
+	broker.RegisterUser(late.ID, late.Recv)
+	if _, ok := broker.Stats().Users["late"]; ok {
+		t.Error("Expected registration after Close to be ignored")
+	}
+	if err := broker.Close(context.Background()); err != nil {
+		t.Errorf("Expected a second Close to succeed, got %v", err)
+	}
+}
+
+func TestBrokerCloseDeadline(t *testing.T) {
+	broker := NewBroker(context.Background())
+	stuck := make(chan Message) // never read
+	broker.RegisterUserWithOptions("stuck", stuck, DeliveryOptions{Policy: BlockWithTimeout, Timeout: time.Hour})
+	go broker.Run()
+	sendDirect(t, broker, "stuck", "one", "two")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := broker.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Close to give up at the deadline, took %v", elapsed)
+	}
+	if _, ok := <-stuck; ok {
+		t.Error("Expected the stuck channel to be closed")
+	}
+}
+
+func TestBrokerWaitAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	broker := NewBroker(ctx)
+	go broker.Run()
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		broker.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the context was cancelled")
+	}
+}
+
+func TestSendMessageContext(t *testing.T) {
+	broker := NewBroker(context.Background()) // Run is not started, so the queue fills up
+	for i := 0; i < cap(broker.input); i++ {
+		if err := broker.SendMessage(Message{Sender: "A", Recipient: "B"}); err != nil {
+			t.Fatalf("SendMessage %d failed: %v", i, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := broker.SendMessageContext(ctx, Message{Sender: "A", Recipient: "B"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestBrokerCloseWithConcurrentSenders(t *testing.T) {
+	broker := NewBroker(context.Background())
+	b := &testUser{ID: "B", Recv: make(chan Message, 10000)}
+	broker.RegisterUser(b.ID, b.Recv)
+	go broker.Run()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	accepted := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				err := broker.SendMessage(Message{Sender: "A", Recipient: "B", Content: "x"})
+				if errors.Is(err, ErrBrokerClosed) {
+					return
+				}
+				if err != nil {
+					t.Errorf("SendMessage failed: %v", err)
+					return
+				}
+				mutex.Lock()
+				accepted++
+				mutex.Unlock()
+			}
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := broker.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	wg.Wait()
+
+	// Every accepted message is delivered before the channel is closed
+	if got := len(receiveAll(t, b)); got != accepted {
+		t.Errorf("Expected %d delivered messages, got %d", accepted, got)
+	}
+}
+
+func TestBrokerSharedChannel(t *testing.T) {
+	broker, syncer := newMailboxBroker(t)
+	shared := newRoomTestUser("shared")
+	shared.Recv = make(chan Message, 1)
+	broker.RegisterUserWithOptions("A", shared.Recv, DeliveryOptions{Policy: Disconnect})
+	broker.RegisterUserWithOptions("B", shared.Recv, DeliveryOptions{Policy: DropNewest})
+
+	// The second message finds the channel full and disconnects A, but B still receives on it
+	sendDirect(t, broker, "A", "first", "second")
+	sendAndSync(t, broker, "A", 0, syncer)
+	if stats := broker.Stats(); stats.Disconnected != 1 {
+		t.Fatalf("Expected A disconnected, got %+v", stats)
+	}
+	expectContents(t, shared, "first")
+	sendDirect(t, broker, "B", "for B")
+	expectContents(t, shared, "for B")
+
+	// Closing with the channel registered twice must close it once
+	broker.RegisterUser("C", shared.Recv)
+	if err := broker.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := receiveAll(t, shared); len(got) != 0 {
+		t.Errorf("Expected no more messages, got %v", got)
+	}
+}
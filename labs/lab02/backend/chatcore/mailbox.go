@@ -0,0 +1,203 @@
+package chatcore
+
+import (
+	"sync"
+	"time"
+)
+
+// Default mailbox limits, see SetMailboxOptions
+const (
+	DefaultMailboxSize = 100
+	DefaultMailboxTTL  = 24 * time.Hour
+)
+
+// MailboxOptions limits the per-user mailboxes that keep direct messages until the
+// recipient acknowledges them. A mailbox holds both messages sent while the user was
+// offline and messages delivered but not yet acknowledged; all of them are redelivered
+// in order when the user registers again.
+type MailboxOptions struct {
+	Size int           // Messages kept per user, the oldest are evicted first; 0 disables mailboxes
+	TTL  time.Duration // 0 keeps messages until they are acknowledged or evicted
+}
+
+// mailboxes holds the unacknowledged direct messages of every user
+type mailboxes struct {
+	mutex sync.Mutex
+	opts  MailboxOptions
+	boxes map[string][]mailboxEntry
+}
+
+type mailboxEntry struct {
+	msg     Message
+	expires time.Time    // Zero if the message never expires
+	sentTo  chan Message // Channel the message is known to be in, see RegisterUser
+}
+
+// SetMailboxOptions changes the mailbox limits. Existing mailboxes are trimmed to the new size
+// and their messages keep the expiry they were stored with.
+func (b *Broker) SetMailboxOptions(opts MailboxOptions) {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	b.mailboxes.opts = opts
+	for userID, box := range b.mailboxes.boxes {
+		if len(box) > opts.Size {
+			box = box[len(box)-opts.Size:]
+		}
+		b.setMailbox(userID, box)
+	}
+}
+
+// Ack acknowledges a direct message received by userID so that it is not redelivered.
+// With a Transport the ack is published, so that no other broker redelivers the message.
+func (b *Broker) Ack(userID, id string) error {
+	if !b.unstore(userID, id) {
+		return ErrUnknownMessage
+	}
+	if b.transport == nil {
+		return nil
+	}
+	return b.enqueue(envelope{msg: Message{Type: EventAck, System: true, Sender: userID, Ref: id}})
+}
+
+// unstore removes a message from a user's mailbox, reporting whether it was there
+func (b *Broker) unstore(userID, id string) bool {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	box := b.mailboxes.boxes[userID]
+	for i, entry := range box {
+		if entry.msg.ID == id {
+			b.setMailbox(userID, append(box[:i:i], box[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the unexpired messages in a user's mailbox, oldest first
+func (b *Broker) Pending(userID string) []Message {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	box := b.pruneMailbox(userID)
+	msgs := make([]Message, len(box))
+	for i, entry := range box {
+		msgs[i] = entry.msg
+	}
+	return msgs
+}
+
+// store keeps a direct message in its recipient's mailbox until it is acknowledged
+func (b *Broker) store(userID string, msg Message) {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	opts := b.mailboxes.opts
+	if opts.Size <= 0 || b.findEntry(userID, msg.ID) != nil {
+		return
+	}
+	entry := mailboxEntry{msg: msg}
+	if opts.TTL > 0 {
+		entry.expires = b.clock.Now().Add(opts.TTL)
+	}
+	box := append(b.pruneMailbox(userID), entry)
+	if len(box) > opts.Size {
+		box = box[len(box)-opts.Size:]
+	}
+	b.setMailbox(userID, box)
+}
+
+// backlog returns the unexpired messages of a user's mailbox that were not already
+// sent to recv, oldest first
+func (b *Broker) backlog(userID string, recv chan Message) []Message {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	var msgs []Message
+	for _, entry := range b.pruneMailbox(userID) {
+		if entry.sentTo != recv {
+			msgs = append(msgs, entry.msg)
+		}
+	}
+	return msgs
+}
+
+// markSent records whether a direct message is in the subscriber's channel, either
+// delivered (sent) or evicted from it
+func (b *Broker) markSent(sub *subscriber, msg Message, sent bool) {
+	if !isDirect(msg) {
+		return
+	}
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	if entry := b.findEntry(sub.id, msg.ID); entry != nil {
+		entry.sentTo = nil
+		if sent {
+			entry.sentTo = sub.ch
+		}
+	}
+}
+
+// findEntry returns the mailbox entry of a message, nil if there is none.
+// Callers must hold the mailboxes mutex.
+func (b *Broker) findEntry(userID, id string) *mailboxEntry {
+	box := b.mailboxes.boxes[userID]
+	for i := range box {
+		if box[i].msg.ID == id {
+			return &box[i]
+		}
+	}
+	return nil
+}
+
+// pruneMailbox drops the expired messages of a user and returns the rest.
+// Callers must hold the mailboxes mutex.
+func (b *Broker) pruneMailbox(userID string) []mailboxEntry {
+	box := b.mailboxes.boxes[userID]
+	now := b.clock.Now()
+	kept := box[:0]
+	for _, entry := range box {
+		if entry.expires.IsZero() || now.Before(entry.expires) {
+			kept = append(kept, entry)
+		}
+	}
+	b.setMailbox(userID, kept)
+	return kept
+}
+
+// setMailbox replaces a user's mailbox, deleting it when empty.
+// Callers must hold the mailboxes mutex.
+func (b *Broker) setMailbox(userID string, box []mailboxEntry) {
+	if len(box) == 0 {
+		delete(b.mailboxes.boxes, userID)
+		return
+	}
+	b.mailboxes.boxes[userID] = box
+}
+
+// unsent reports whether a message is still in a user's mailbox and not already in the
+// subscriber's channel, which happens when a live delivery raced with registering again
+func (b *Broker) unsent(sub *subscriber, id string) bool {
+	b.mailboxes.mutex.Lock()
+	defer b.mailboxes.mutex.Unlock()
+	entry := b.findEntry(sub.id, id)
+	return entry != nil && entry.sentTo != sub.ch
+}
+
+// isDirect reports whether msg is a direct text message that goes through the recipient's mailbox
+func isDirect(msg Message) bool {
+	return msg.Type == EventMessage && !msg.System && !msg.Broadcast && msg.Room == ""
+}
+
+// flushBacklog delivers the mailbox snapshot taken when the user registered, skipping
+// messages acknowledged or delivered since. It runs on the Run goroutine before any live
+// message to the user and returns false if the user must be disconnected.
+func (b *Broker) flushBacklog(sub *subscriber) bool {
+	for len(sub.backlog) > 0 {
+		msg := sub.backlog[0]
+		sub.backlog = sub.backlog[1:]
+		if !b.unsent(sub, msg.ID) {
+			continue
+		}
+		if !b.send(sub, msg) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package chatcore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	changed chan struct{} // Signalled whenever a waiter is added
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, changed: make(chan struct{}, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Advance moves the clock forward and fires every waiter whose deadline has passed
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = remaining
+}
+
+// waitForWaiter blocks until some goroutine is sleeping on the clock
+func (c *fakeClock) waitForWaiter(t *testing.T) {
+	t.Helper()
+	deadline := time.After(time.Second)
+	for {
+		c.mutex.Lock()
+		n := len(c.waiters)
+		c.mutex.Unlock()
+		if n > 0 {
+			return
+		}
+		select {
+		case <-c.changed:
+		case <-deadline:
+			t.Fatal("Broker never waited on the clock")
+		}
+	}
+}
+
+// newMailboxBroker starts a broker with a registered "sync" user used to wait for delivery
+func newMailboxBroker(t *testing.T) (*Broker, *testUser) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	broker := NewBroker(ctx)
+	go broker.Run()
+	syncer := newRoomTestUser("sync")
+	broker.RegisterUser(syncer.ID, syncer.Recv)
+	return broker, syncer
+}
+
+func sendDirect(t *testing.T, broker *Broker, to string, contents ...string) {
+	t.Helper()
+	for _, content := range contents {
+		if err := broker.SendMessage(Message{Sender: "S", Recipient: to, Content: content}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+}
+
+func expectContents(t *testing.T, u *testUser, contents ...string) []Message {
+	t.Helper()
+	msgs := make([]Message, len(contents))
+	for i, content := range contents {
+		msgs[i] = expectMessage(t, u, func(m Message) bool { return m.Content == content }, content)
+	}
+	return msgs
+}
+
+func TestMailboxOfflineDelivery(t *testing.T) {
+	broker, syncer := newMailboxBroker(t)
+	sendDirect(t, broker, "B", "one", "two")
+	sendAndSync(t, broker, "B", 0, syncer)
+	if pending := broker.Pending("B"); len(pending) != 2 {
+		t.Fatalf("Expected 2 pending messages, got %+v", pending)
+	}
+
+	b := newRoomTestUser("B")
+	broker.RegisterUser(b.ID, b.Recv)
+	sendDirect(t, broker, "B", "live")
+	msgs := expectContents(t, b, "one", "two", "live")
+	if msgs[0].ID == "" || msgs[0].ID == msgs[1].ID || msgs[1].ID == msgs[2].ID {
+		t.Errorf("Expected distinct message IDs, got %q, %q, %q", msgs[0].ID, msgs[1].ID, msgs[2].ID)
+	}
+	expectNoMessage(t, b)
+}
+
+func TestMailboxAckAndRedelivery(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	b := newRoomTestUser("B")
+	broker.RegisterUser(b.ID, b.Recv)
+	sendDirect(t, broker, "B", "one", "two", "three")
+	msgs := expectContents(t, b, "one", "two", "three")
+
+	if err := broker.Ack("B", msgs[1].ID); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	if err := broker.Ack("B", msgs[1].ID); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Expected ErrUnknownMessage, got %v", err)
+	}
+
+	// Reconnect: the unacknowledged messages come again with the same IDs
+	broker.UnregisterUser("B")
+	reconnected := newRoomTestUser("B")
+	broker.RegisterUser(reconnected.ID, reconnected.Recv)
+	again := expectContents(t, reconnected, "one", "three")
+	if again[0].ID != msgs[0].ID || again[1].ID != msgs[2].ID {
+		t.Errorf("Expected redelivered IDs %q and %q, got %q and %q", msgs[0].ID, msgs[2].ID, again[0].ID, again[1].ID)
+	}
+	expectNoMessage(t, reconnected)
+
+	for _, m := range again {
+		broker.Ack("B", m.ID)
+	}
+	if pending := broker.Pending("B"); len(pending) != 0 {
+		t.Errorf("Expected empty mailbox, got %+v", pending)
+	}
+}
+
+func TestMailboxReregisterSameChannel(t *testing.T) {
+	broker, syncer := newMailboxBroker(t)
+	b := newRoomTestUser("B")
+	broker.RegisterUser(b.ID, b.Recv)
+	sendDirect(t, broker, "B", "one", "two")
+	sendAndSync(t, broker, "B", 0, syncer)
+
+	// The channel still holds both messages, so registering it again must not repeat them
+	broker.RegisterUser(b.ID, b.Recv)
+	sendDirect(t, broker, "B", "three")
+	expectContents(t, b, "one", "two", "three")
+	expectNoMessage(t, b)
+	if pending := broker.Pending("B"); len(pending) != 3 {
+		t.Errorf("Expected the unacknowledged messages kept, got %+v", pending)
+	}
+}
+
+func TestMailboxOnlyKeepsDirectMessages(t *testing.T) {
+	broker, syncer := newMailboxBroker(t)
+	b := newRoomTestUser("B")
+	broker.RegisterUser(b.ID, b.Recv)
+	broker.JoinRoom(b.ID, "go")
+	broker.SendMessage(Message{Sender: "S", Content: "all", Broadcast: true})
+	broker.SendMessage(Message{Sender: "B", Room: "go", Content: "room"})
+	expectContents(t, syncer, "all")
+	sendAndSync(t, broker, "B", 0, syncer)
+	if pending := broker.Pending("B"); len(pending) != 0 {
+		t.Errorf("Expected no pending messages, got %+v", pending)
+	}
+}
+
+func TestMailboxLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MailboxOptions
+		advance time.Duration
+		pending []string
+	}{
+		{"evicts oldest", MailboxOptions{Size: 2}, 0, []string{"two", "three"}},
+		{"before expiry", MailboxOptions{Size: 10, TTL: time.Hour}, 59 * time.Minute, []string{"one", "two", "three"}},
+		{"expired", MailboxOptions{Size: 10, TTL: time.Hour}, time.Hour, nil},
+		{"disabled", MailboxOptions{}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			clock := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			broker := NewBroker(ctx)
+			broker.SetClock(clock)
+			broker.SetMailboxOptions(tt.opts)
+			go broker.Run()
+			syncer := newRoomTestUser("sync")
+			broker.RegisterUser(syncer.ID, syncer.Recv)
+
+			sendDirect(t, broker, "B", "one", "two", "three")
+			sendAndSync(t, broker, "B", 0, syncer)
+			clock.Advance(tt.advance)
+
+			pending := broker.Pending("B")
+			if len(pending) != len(tt.pending) {
+				t.Fatalf("Expected %v, got %+v", tt.pending, pending)
+			}
+			for i, m := range pending {
+				if m.Content != tt.pending[i] {
+					t.Errorf("Expected %v, got %+v", tt.pending, pending)
+				}
+			}
+
+			b := newRoomTestUser("B")
+			broker.RegisterUser(b.ID, b.Recv)
+			expectContents(t, b, tt.pending...)
+			expectNoMessage(t, b)
+		})
+	}
+}
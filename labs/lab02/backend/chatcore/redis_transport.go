@@ -0,0 +1,68 @@
+package chatcore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTransport connects brokers in different processes through a Redis pub/sub channel
+type RedisTransport struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// NewRedisTransport creates a transport publishing to the given Redis channel.
+// The client is owned by the caller.
+func NewRedisTransport(client redis.UniversalClient, channel string) *RedisTransport {
+	return &RedisTransport{client: client, channel: channel}
+}
+
+// Publish sends msg to every subscribed broker. It returns once Redis accepted the
+// message, so messages published one after another keep their order.
+func (t *RedisTransport) Publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return t.client.Publish(ctx, t.channel, data).Err()
+}
+
+// Subscribe returns the messages published from now on until ctx is done.
+// Payloads that are not messages are skipped.
+func (t *RedisTransport) Subscribe(ctx context.Context) (<-chan Message, error) {
+	pubsub := t.client.Subscribe(ctx, t.channel)
+	// Wait for the subscription confirmation, Redis drops messages published before it
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	out := make(chan Message, 100)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+		in := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case raw, ok := <-in:
+				if !ok {
+					return
+				}
+				var msg Message
+				if err := json.Unmarshal([]byte(raw.Payload), &msg); err != nil {
+					continue
+				}
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
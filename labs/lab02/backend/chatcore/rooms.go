@@ -0,0 +1,149 @@
+package chatcore
+
+import "sort"
+
+// Contents of the system messages sent to a room when its membership changes.
+// The Sender of such a message is the user who joined or left.
+const (
+	SystemJoined = "joined"
+	SystemLeft   = "left"
+)
+
+// JoinRoom adds a registered user to a room, creating the room if needed, and announces
+// the join to all members including the new one. Joining a room twice has no effect.
+func (b *Broker) JoinRoom(userID, room string) error {
+	if room == "" {
+		return ErrEmptyRoom
+	}
+	// Holding usersMutex keeps a concurrent UnregisterUser from running between
+	// the registration check and the membership update
+	b.usersMutex.RLock()
+	if _, ok := b.users[userID]; !ok {
+		b.usersMutex.RUnlock()
+		return ErrUserNotFound
+	}
+	b.roomsMutex.Lock()
+	members, ok := b.rooms[room]
+	if !ok {
+		members = make(map[string]struct{})
+		b.rooms[room] = members
+	}
+	_, already := members[userID]
+	members[userID] = struct{}{}
+	targets := memberIDs(members)
+	b.roomsMutex.Unlock()
+	b.usersMutex.RUnlock()
+
+	if already {
+		return nil
+	}
+	return b.enqueue(envelope{
+		msg:     Message{Sender: userID, Room: room, Content: SystemJoined, System: true},
+		targets: targets,
+	})
+}
+
+// LeaveRoom removes a user from a room and announces it to the remaining members.
+// Empty rooms are deleted.
+func (b *Broker) LeaveRoom(userID, room string) error {
+	b.roomsMutex.Lock()
+	env, err := b.leave(userID, room)
+	b.roomsMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.enqueue(env)
+}
+
+// leaveAllRooms removes a user from every room and returns the announcements to deliver
+func (b *Broker) leaveAllRooms(userID string) []envelope {
+	b.roomsMutex.Lock()
+	defer b.roomsMutex.Unlock()
+	var envs []envelope
+	for room, members := range b.rooms {
+		if _, ok := members[userID]; ok {
+			env, _ := b.leave(userID, room)
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
+// leave removes a user from a room and returns the announcement to its remaining members.
+// Callers must hold roomsMutex.
+func (b *Broker) leave(userID, room string) (envelope, error) {
+	members := b.rooms[room]
+	if _, ok := members[userID]; !ok {
+		return envelope{}, ErrNotMember
+	}
+	delete(members, userID)
+	if len(members) == 0 {
+		delete(b.rooms, room)
+	}
+	return envelope{
+		msg:     Message{Sender: userID, Room: room, Content: SystemLeft, System: true},
+		targets: memberIDs(members),
+	}, nil
+}
+
+// RoomMembers returns the sorted IDs of the members of a room
+func (b *Broker) RoomMembers(room string) []string {
+	b.roomsMutex.RLock()
+	defer b.roomsMutex.RUnlock()
+	return memberIDs(b.rooms[room])
+}
+
+// Rooms returns the sorted names of all rooms with at least one member
+func (b *Broker) Rooms() []string {
+	b.roomsMutex.RLock()
+	defer b.roomsMutex.RUnlock()
+	rooms := make([]string, 0, len(b.rooms))
+	for room := range b.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// UserRooms returns the sorted names of the rooms a user has joined
+func (b *Broker) UserRooms(userID string) []string {
+	b.roomsMutex.RLock()
+	defer b.roomsMutex.RUnlock()
+	var rooms []string
+	for room, members := range b.rooms {
+		if _, ok := members[userID]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// roomSnapshot returns the members of a room if userID is one of them
+func (b *Broker) roomSnapshot(room, userID string) ([]string, bool) {
+	b.roomsMutex.RLock()
+	defer b.roomsMutex.RUnlock()
+	members := b.rooms[room]
+	if _, ok := members[userID]; !ok {
+		return nil, false
+	}
+	return memberIDs(members), true
+}
+
+// isMember reports whether userID is a member of room
+func (b *Broker) isMember(room, userID string) bool {
+	b.roomsMutex.RLock()
+	defer b.roomsMutex.RUnlock()
+	_, ok := b.rooms[room][userID]
+	return ok
+}
+
+// memberIDs returns the sorted IDs of a member set, never nil
+func memberIDs(members map[string]struct{}) []string {
+	ids := make([]string, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
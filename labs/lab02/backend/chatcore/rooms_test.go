@@ -0,0 +1,264 @@
+package chatcore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRoomTestUser(id string) *testUser {
+	return &testUser{ID: id, Recv: make(chan Message, 200)}
+}
+
+// expectMessage waits for the next message on u and checks it
+func expectMessage(t *testing.T, u *testUser, check func(Message) bool, what string) Message {
+	t.Helper()
+	select {
+	case m := <-u.Recv:
+		if !check(m) {
+			t.Fatalf("%s: expected %s, got %+v", u.ID, what, m)
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatalf("%s: did not receive %s", u.ID, what)
+	}
+	return Message{}
+}
+
+func expectNoMessage(t *testing.T, u *testUser) {
+	t.Helper()
+	select {
+	case m := <-u.Recv:
+		t.Errorf("%s: expected no message, got %+v", u.ID, m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func isSystem(content, sender, room string) func(Message) bool {
+	return func(m Message) bool {
+		return m.System && m.Content == content && m.Sender == sender && m.Room == room
+	}
+}
+
+func TestBrokerRoomDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	a, b, c := newRoomTestUser("A"), newRoomTestUser("B"), newRoomTestUser("C")
+	for _, u := range []*testUser{a, b, c} {
+		broker.RegisterUser(u.ID, u.Recv)
+	}
+	if err := broker.JoinRoom(a.ID, "go"); err != nil {
+		t.Fatalf("JoinRoom failed: %v", err)
+	}
+	expectMessage(t, a, isSystem(SystemJoined, "A", "go"), "own join")
+	if err := broker.JoinRoom(b.ID, "go"); err != nil {
+		t.Fatalf("JoinRoom failed: %v", err)
+	}
+	expectMessage(t, a, isSystem(SystemJoined, "B", "go"), "B's join")
+	expectMessage(t, b, isSystem(SystemJoined, "B", "go"), "own join")
+
+	if err := broker.SendMessage(Message{Sender: a.ID, Room: "go", Content: "hi room"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	for _, u := range []*testUser{a, b} {
+		expectMessage(t, u, func(m Message) bool { return !m.System && m.Content == "hi room" && m.Room == "go" }, "room message")
+	}
+	expectNoMessage(t, c)
+
+	if got := broker.RoomMembers("go"); fmt.Sprint(got) != "[A B]" {
+		t.Errorf("Expected members [A B], got %v", got)
+	}
+}
+
+func TestBrokerRoomLeave(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	for _, u := range []*testUser{a, b} {
+		broker.RegisterUser(u.ID, u.Recv)
+		broker.JoinRoom(u.ID, "go")
+	}
+	// Joining twice is a no-op
+	if err := broker.JoinRoom(a.ID, "go"); err != nil {
+		t.Fatalf("JoinRoom failed: %v", err)
+	}
+	expectMessage(t, a, isSystem(SystemJoined, "A", "go"), "own join")
+	expectMessage(t, a, isSystem(SystemJoined, "B", "go"), "B's join")
+	expectMessage(t, b, isSystem(SystemJoined, "B", "go"), "own join")
+
+	if err := broker.LeaveRoom(b.ID, "go"); err != nil {
+		t.Fatalf("LeaveRoom failed: %v", err)
+	}
+	expectMessage(t, a, isSystem(SystemLeft, "B", "go"), "B's leave")
+
+	broker.SendMessage(Message{Sender: a.ID, Room: "go", Content: "still here?"})
+	expectMessage(t, a, func(m Message) bool { return m.Content == "still here?" }, "own room message")
+	expectNoMessage(t, b)
+
+	if err := broker.LeaveRoom(b.ID, "go"); !errors.Is(err, ErrNotMember) {
+		t.Errorf("Expected ErrNotMember, got %v", err)
+	}
+	broker.LeaveRoom(a.ID, "go")
+	if rooms := broker.Rooms(); len(rooms) != 0 {
+		t.Errorf("Expected empty room to be removed, got %v", rooms)
+	}
+}
+
+func TestBrokerRoomErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	a := newRoomTestUser("A")
+	broker.RegisterUser(a.ID, a.Recv)
+
+	if err := broker.JoinRoom("ghost", "go"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := broker.JoinRoom(a.ID, ""); !errors.Is(err, ErrEmptyRoom) {
+		t.Errorf("Expected ErrEmptyRoom, got %v", err)
+	}
+	if err := broker.SendMessage(Message{Sender: a.ID, Room: "go", Content: "hi"}); !errors.Is(err, ErrNotMember) {
+		t.Errorf("Expected ErrNotMember, got %v", err)
+	}
+	expectNoMessage(t, a)
+}
+
+func TestUnregisterUserLeavesRooms(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	a, b := newRoomTestUser("A"), newRoomTestUser("B")
+	for _, u := range []*testUser{a, b} {
+		broker.RegisterUser(u.ID, u.Recv)
+	}
+	broker.JoinRoom(a.ID, "go")
+	broker.JoinRoom(a.ID, "rust")
+	broker.JoinRoom(b.ID, "go")
+	broker.UnregisterUser(b.ID)
+
+	if rooms := broker.UserRooms(b.ID); len(rooms) != 0 {
+		t.Errorf("Expected B in no rooms, got %v", rooms)
+	}
+	if got := fmt.Sprint(broker.UserRooms(a.ID)); got != "[go rust]" {
+		t.Errorf("Expected A in [go rust], got %v", got)
+	}
+	expectMessage(t, a, isSystem(SystemJoined, "A", "go"), "own join")
+	expectMessage(t, a, isSystem(SystemJoined, "A", "rust"), "own join")
+	expectMessage(t, a, isSystem(SystemJoined, "B", "go"), "B's join")
+	expectMessage(t, a, isSystem(SystemLeft, "B", "go"), "B's leave")
+}
+
+func TestBrokerConcurrentRoomDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	n := 10
+	members := make([]*testUser, n)
+	outsider := newRoomTestUser("outsider")
+	broker.RegisterUser(outsider.ID, outsider.Recv)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		members[i] = newRoomTestUser(string(rune('A' + i)))
+		broker.RegisterUser(members[i].ID, members[i].Recv)
+		wg.Add(1)
+		go func(u *testUser) {
+			defer wg.Done()
+			if err := broker.JoinRoom(u.ID, "lobby"); err != nil {
+				t.Errorf("JoinRoom failed: %v", err)
+			}
+		}(members[i])
+	}
+	wg.Wait()
+	if got := len(broker.RoomMembers("lobby")); got != n {
+		t.Fatalf("Expected %d members, got %d", n, got)
+	}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(sender *testUser) {
+			defer wg.Done()
+			msg := Message{Sender: sender.ID, Room: "lobby", Content: "hello"}
+			if err := broker.SendMessage(msg); err != nil {
+				t.Errorf("SendMessage failed: %v", err)
+			}
+		}(members[i])
+	}
+	wg.Wait()
+
+	// Each member receives every chat message; the joins that happened after it are mixed in
+	for _, u := range members {
+		received := 0
+		deadline := time.After(time.Second)
+		for received < n {
+			select {
+			case <-deadline:
+				t.Fatalf("User %s received %d of %d room messages", u.ID, received, n)
+			case m := <-u.Recv:
+				if !m.System {
+					received++
+				}
+			}
+		}
+	}
+	expectNoMessage(t, outsider)
+}
+
+func TestBrokerConcurrentJoinLeaveAndSend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewBroker(ctx)
+	go broker.Run()
+
+	n := 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		u := newRoomTestUser(fmt.Sprintf("user%d", i))
+		broker.RegisterUser(u.ID, u.Recv)
+		wg.Add(2)
+		go func() { // drain so delivery never blocks
+			defer wg.Done()
+			for {
+				select {
+				case <-u.Recv:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				room := fmt.Sprintf("room%d", j%3)
+				broker.JoinRoom(u.ID, room)
+				broker.SendMessage(Message{Sender: u.ID, Room: room, Content: "ping"})
+				broker.RoomMembers(room)
+				broker.LeaveRoom(u.ID, room)
+			}
+			if j := len(broker.UserRooms(u.ID)); j != 0 {
+				t.Errorf("%s still in %d rooms", u.ID, j)
+			}
+		}()
+	}
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	if rooms := broker.Rooms(); len(rooms) != 0 {
+		t.Errorf("Expected no rooms left, got %v", rooms)
+	}
+}
@@ -0,0 +1,137 @@
+package chatcore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// dedupWindow is how many recent transport message IDs a broker remembers
+const dedupWindow = 4096
+
+// Transport carries messages between brokers, so that several backend replicas can
+// serve one chat. Every broker publishes the messages sent through it and receives the
+// messages of all brokers, including its own. Messages published one after another must
+// be received in the same order.
+type Transport interface {
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe returns the published messages until ctx is done; the subscription
+	// is active when Subscribe returns
+	Subscribe(ctx context.Context) (<-chan Message, error)
+}
+
+// SetTransport connects the broker to a Transport. It must be called before Run and
+// before any message is sent. Room membership and mailboxes stay local to each broker:
+// a room message reaches the members registered with every broker, and a direct
+// message is kept in the mailbox of every broker until the recipient acknowledges it
+// on any of them.
+func (b *Broker) SetTransport(t Transport) error {
+	remote, err := t.Subscribe(b.ctx)
+	if err != nil {
+		return err
+	}
+	b.transport = t
+	b.remote = remote
+	return nil
+}
+
+// receive delivers a message from the transport to the local recipients, once.
+// Acks are applied to the local mailbox instead.
+func (b *Broker) receive(msg Message) {
+	if !b.seen.add(msg.ID) {
+		return
+	}
+	if msg.Type == EventAck {
+		b.unstore(msg.Sender, msg.Ref)
+		return
+	}
+	env := envelope{msg: msg}
+	switch {
+	case msg.Room != "":
+		env.targets = b.RoomMembers(msg.Room)
+	case !msg.Broadcast:
+		env.targets = []string{msg.Recipient}
+	}
+	b.deliver(env)
+}
+
+// recentIDs is a bounded set of the most recently added IDs
+type recentIDs struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+func newRecentIDs(size int) recentIDs {
+	return recentIDs{ids: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+// add records id and reports whether it was new, forgetting the oldest ID when full
+func (r *recentIDs) add(id string) bool {
+	if _, ok := r.ids[id]; ok {
+		return false
+	}
+	delete(r.ids, r.ring[r.next])
+	r.ring[r.next] = id
+	r.ids[id] = struct{}{}
+	r.next = (r.next + 1) % len(r.ring)
+	return true
+}
+
+// newNodeID returns a random prefix for message IDs
+func newNodeID() string {
+	var buf [6]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// MemoryTransport connects brokers within one process, mostly for tests
+type MemoryTransport struct {
+	mutex  sync.Mutex
+	subs   map[*memorySubscription]struct{}
+	buffer int
+}
+
+type memorySubscription struct {
+	ch   chan Message
+	done <-chan struct{}
+}
+
+// NewMemoryTransport creates an in-memory transport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{subs: make(map[*memorySubscription]struct{}), buffer: 100}
+}
+
+// Publish hands msg to every subscriber, waiting for room in their buffers
+func (t *MemoryTransport) Publish(ctx context.Context, msg Message) error {
+	// Holding the mutex for the whole fan-out keeps the order the same for every subscriber
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for sub := range t.subs {
+		select {
+		case sub.ch <- msg:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the messages published from now on until ctx is done
+func (t *MemoryTransport) Subscribe(ctx context.Context) (<-chan Message, error) {
+	sub := &memorySubscription{ch: make(chan Message, t.buffer), done: ctx.Done()}
+	t.mutex.Lock()
+	t.subs[sub] = struct{}{}
+	t.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mutex.Lock()
+		delete(t.subs, sub)
+		close(sub.ch)
+		t.mutex.Unlock()
+	}()
+	return sub.ch, nil
+}
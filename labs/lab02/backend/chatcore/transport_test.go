@@ -0,0 +1,162 @@
+package chatcore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// transports returns a factory per Transport implementation; each call of a factory
+// returns a transport connected to the same bus
+func transports(t *testing.T) map[string]func() Transport {
+	memory := NewMemoryTransport()
+	server := miniredis.RunT(t)
+	return map[string]func() Transport{
+		"memory": func() Transport { return memory },
+		"redis": func() Transport {
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+			return NewRedisTransport(client, "chat")
+		},
+	}
+}
+
+// newReplica starts a broker connected to a transport
+func newReplica(t *testing.T, transport Transport) *Broker {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	broker := NewBroker(ctx)
+	if err := broker.SetTransport(transport); err != nil {
+		t.Fatalf("SetTransport failed: %v", err)
+	}
+	go broker.Run()
+	return broker
+}
+
+func TestTransportAcrossBrokers(t *testing.T) {
+	for name, open := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := newReplica(t, open()), newReplica(t, open())
+			a, b := newRoomTestUser("A"), newRoomTestUser("B")
+			first.RegisterUser(a.ID, a.Recv)
+			second.RegisterUser(b.ID, b.Recv)
+
+			if err := first.SendMessage(Message{Sender: "A", Recipient: "B", Content: "direct"}); err != nil {
+				t.Fatalf("SendMessage failed: %v", err)
+			}
+			expectContents(t, b, "direct")
+
+			if err := second.SendMessage(Message{Sender: "B", Content: "all", Broadcast: true}); err != nil {
+				t.Fatalf("SendMessage failed: %v", err)
+			}
+			expectContents(t, a, "all")
+			expectContents(t, b, "all")
+
+			first.JoinRoom(a.ID, "go")
+			expectMessage(t, a, isSystem(SystemJoined, "A", "go"), "own join")
+			// Messages from one broker stay ordered, so B joins after the second broker saw A join
+			first.SendMessage(Message{Sender: "A", Recipient: "B", Content: "sync"})
+			expectContents(t, b, "sync")
+			second.JoinRoom(b.ID, "go")
+			expectMessage(t, a, isSystem(SystemJoined, "B", "go"), "remote join")
+			expectMessage(t, b, isSystem(SystemJoined, "B", "go"), "own join")
+			if err := second.SendMessage(Message{Sender: "B", Room: "go", Content: "room"}); err != nil {
+				t.Fatalf("SendMessage failed: %v", err)
+			}
+			expectContents(t, a, "room")
+			expectContents(t, b, "room")
+			expectNoMessage(t, a)
+			expectNoMessage(t, b)
+		})
+	}
+}
+
+func TestTransportPreservesSenderOrder(t *testing.T) {
+	for name, open := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := newReplica(t, open()), newReplica(t, open())
+			b := newRoomTestUser("B")
+			second.RegisterUser(b.ID, b.Recv)
+
+			contents := make([]string, 100)
+			for i := range contents {
+				contents[i] = fmt.Sprintf("msg-%d", i)
+				if err := first.SendMessage(Message{Sender: "A", Recipient: "B", Content: contents[i]}); err != nil {
+					t.Fatalf("SendMessage failed: %v", err)
+				}
+			}
+			expectContents(t, b, contents...)
+		})
+	}
+}
+
+func TestTransportDeduplicatesByID(t *testing.T) {
+	for name, open := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			transport := open()
+			broker := newReplica(t, transport)
+			b := newRoomTestUser("B")
+			broker.RegisterUser(b.ID, b.Recv)
+
+			msg := Message{ID: "retry-1", Sender: "A", Recipient: "B", Content: "once", Timestamp: 1}
+			for i := 0; i < 3; i++ {
+				if err := transport.Publish(context.Background(), msg); err != nil {
+					t.Fatalf("Publish failed: %v", err)
+				}
+			}
+			broker.SendMessage(Message{Sender: "A", Recipient: "B", Content: "next"})
+			expectContents(t, b, "once", "next")
+			expectNoMessage(t, b)
+		})
+	}
+}
+
+func TestTransportAckReachesEveryReplica(t *testing.T) {
+	for name, open := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := newReplica(t, open()), newReplica(t, open())
+			syncer := newRoomTestUser("sync")
+			second.RegisterUser(syncer.ID, syncer.Recv)
+			b := newRoomTestUser("B")
+			first.RegisterUser(b.ID, b.Recv)
+			sendDirect(t, first, "B", "one", "two")
+			msgs := expectContents(t, b, "one", "two")
+
+			if err := first.Ack("B", msgs[0].ID); err != nil {
+				t.Fatalf("Ack failed: %v", err)
+			}
+			// The ack was published before the sync message, so the second replica has applied it
+			sendDirect(t, first, "sync", "sync")
+			expectContents(t, syncer, "sync")
+
+			first.UnregisterUser("B")
+			reconnected := newRoomTestUser("B")
+			second.RegisterUser(reconnected.ID, reconnected.Recv)
+			again := expectContents(t, reconnected, "two")
+			if again[0].ID != msgs[1].ID {
+				t.Errorf("Expected redelivered ID %q, got %q", msgs[1].ID, again[0].ID)
+			}
+			expectNoMessage(t, reconnected)
+		})
+	}
+}
+
+func TestRecentIDs(t *testing.T) {
+	ids := newRecentIDs(2)
+	for _, id := range []string{"a", "b"} {
+		if !ids.add(id) {
+			t.Errorf("Expected %q to be new", id)
+		}
+	}
+	if ids.add("a") {
+		t.Error("Expected a duplicate of a")
+	}
+	ids.add("c") // Forgets a
+	if !ids.add("a") {
+		t.Error("Expected a to be forgotten")
+	}
+}
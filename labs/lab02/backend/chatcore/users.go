@@ -0,0 +1,47 @@
+package chatcore
+
+import (
+	"sync"
+
+	"lab02/user"
+)
+
+// FollowUsers registers every user of m with the broker, using channel to create their
+// delivery channels, and keeps the broker in step as users are added and removed.
+// Calling the returned function stops following; registered users stay registered.
+func (b *Broker) FollowUsers(m *user.UserManager, channel func(u user.User) chan Message) (stop func()) {
+	var (
+		mutex      sync.Mutex
+		registered = make(map[string]bool)
+	)
+	register := func(u user.User) {
+		if !registered[u.ID] {
+			registered[u.ID] = true
+			b.RegisterUser(u.ID, channel(u))
+		}
+	}
+
+	// Subscribe before listing so that no user added in between is missed; the mutex
+	// holds back hooks until the existing users are registered
+	mutex.Lock()
+	stopAdded := m.OnUserAdded(func(u user.User) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		register(u)
+	})
+	stopRemoved := m.OnUserRemoved(func(u user.User) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delete(registered, u.ID)
+		b.UnregisterUser(u.ID)
+	})
+	for _, u := range m.ListUsers("") {
+		register(u)
+	}
+	mutex.Unlock()
+
+	return func() {
+		stopAdded()
+		stopRemoved()
+	}
+}
@@ -0,0 +1,44 @@
+package chatcore
+
+import (
+	"testing"
+
+	"lab02/user"
+)
+
+func TestFollowUsers(t *testing.T) {
+	broker, _ := newMailboxBroker(t)
+	mgr := user.NewUserManager()
+	mgr.AddUser(user.User{Name: "Alice", Email: "alice@example.com", ID: "alice"})
+
+	channels := make(map[string]chan Message)
+	stop := broker.FollowUsers(mgr, func(u user.User) chan Message {
+		ch := make(chan Message, 10)
+		channels[u.ID] = ch
+		return ch
+	})
+	mgr.AddUser(user.User{Name: "Bob", Email: "bob@example.com", ID: "bob"})
+	if broker.Presence("alice") != Online || broker.Presence("bob") != Online {
+		t.Fatalf("Expected existing and new users registered, got %s and %s", broker.Presence("alice"), broker.Presence("bob"))
+	}
+
+	if err := broker.SendMessage(Message{Sender: "alice", Recipient: "bob", Content: "hi"}); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	bob := &testUser{ID: "bob", Recv: channels["bob"]}
+	expectMessage(t, bob, func(m Message) bool { return m.Content == "hi" }, "message")
+
+	mgr.RemoveUser("alice")
+	if broker.Presence("alice") != Offline {
+		t.Errorf("Expected a removed user unregistered, got %s", broker.Presence("alice"))
+	}
+
+	stop()
+	mgr.AddUser(user.User{Name: "Carol", Email: "carol@example.com", ID: "carol"})
+	if broker.Presence("carol") != Offline {
+		t.Errorf("Expected no registration after stop, got %s", broker.Presence("carol"))
+	}
+	if len(channels) != 2 {
+		t.Errorf("Expected one channel per followed user, got %d", len(channels))
+	}
+}
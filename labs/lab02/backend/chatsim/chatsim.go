@@ -0,0 +1,303 @@
+// Package chatsim simulates chat users on a chatcore.Broker to measure how much load
+// the broker, and optionally a message store, can sustain.
+package chatsim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lab02/chatcore"
+	"lab02/message"
+)
+
+// ErrInvalidConfig is returned by Run for configurations that cannot be simulated
+var ErrInvalidConfig = errors.New("invalid simulation config")
+
+// Message stores the simulation can write every sent message to
+const (
+	StoreNone   = "none"
+	StoreMemory = "memory" // message.MessageStore
+)
+
+// Config describes a simulation
+type Config struct {
+	Users           int
+	Rate            float64       // Messages per second sent by each user; 0 sends as fast as possible
+	Duration        time.Duration // How long users send; 0 when MessagesPerUser is set
+	MessagesPerUser int           // Stop each user after this many messages; 0 for no limit
+	BroadcastRatio  float64       // Share of broadcasts, the rest are direct messages to a random user
+	Buffer          int           // Capacity of every user channel
+	Delivery        chatcore.DeliveryOptions
+	Store           string        // StoreNone or StoreMemory
+	DrainTimeout    time.Duration // How long Close may take to deliver queued messages
+	Seed            int64
+}
+
+// DefaultConfig is a small mixed workload
+var DefaultConfig = Config{
+	Users:          100,
+	Rate:           10,
+	Duration:       5 * time.Second,
+	BroadcastRatio: 0.1,
+	Buffer:         100,
+	Delivery:       chatcore.DeliveryOptions{Policy: chatcore.BlockWithTimeout, Timeout: chatcore.DefaultDeliveryTimeout},
+	Store:          StoreNone,
+	DrainTimeout:   10 * time.Second,
+	Seed:           1,
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Users < 2:
+		return fmt.Errorf("%w: at least 2 users are needed", ErrInvalidConfig)
+	case c.Duration <= 0 && c.MessagesPerUser <= 0:
+		return fmt.Errorf("%w: a duration or a message count is needed", ErrInvalidConfig)
+	case c.Rate < 0, c.Buffer < 0, c.MessagesPerUser < 0:
+		return fmt.Errorf("%w: negative rate, buffer or message count", ErrInvalidConfig)
+	case c.BroadcastRatio < 0 || c.BroadcastRatio > 1:
+		return fmt.Errorf("%w: broadcast ratio must be between 0 and 1", ErrInvalidConfig)
+	case c.Store != "" && c.Store != StoreNone && c.Store != StoreMemory:
+		return fmt.Errorf("%w: unknown store %q", ErrInvalidConfig, c.Store)
+	}
+	return nil
+}
+
+// Report is the outcome of a simulation
+type Report struct {
+	Users          int     `json:"users"`
+	Policy         string  `json:"policy"`
+	Store          string  `json:"store"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"` // From the first send until every message was delivered
+
+	Sent       uint64 `json:"sent"`
+	Broadcasts uint64 `json:"broadcasts"`
+	SendErrors uint64 `json:"send_errors"`
+	Expected   uint64 `json:"expected"` // Deliveries the sent messages call for
+	Received   uint64 `json:"received"`
+	Dropped    uint64 `json:"dropped"`
+	Lost       uint64 `json:"lost"` // Expected but neither received nor counted as dropped
+
+	Disconnected uint64 `json:"disconnected"`
+	StoreWrites  uint64 `json:"store_writes"`
+	StoreErrors  uint64 `json:"store_errors"`
+
+	SendThroughput     float64 `json:"send_throughput"`     // Messages sent per second
+	DeliveryThroughput float64 `json:"delivery_throughput"` // Messages received per second
+	StoreThroughput    float64 `json:"store_throughput"`    // Messages stored per second
+
+	Latency Latency `json:"latency_ms"` // From SendMessage until the receiver read the message
+}
+
+// Latency summarizes delivery latencies in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// counters are updated by the sender goroutines
+type counters struct {
+	sent, broadcasts, sendErrors, expected atomic.Uint64
+	storeWrites, storeErrors               atomic.Uint64
+}
+
+// Run simulates cfg and reports the results. Canceling ctx stops the users early;
+// the messages already sent are still delivered and reported.
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if err := cfg.validate(); err != nil {
+		return Report{}, err
+	}
+	if cfg.Store == "" {
+		cfg.Store = StoreNone
+	}
+	var store *message.MessageStore
+	if cfg.Store == StoreMemory {
+		store = message.NewMessageStore()
+	}
+
+	broker := chatcore.NewBroker(context.Background())
+	broker.SetDeliveryOptions(cfg.Delivery)
+	go broker.Run()
+
+	// Every user reads its channel until Close closes it, recording latencies
+	ids := make([]string, cfg.Users)
+	latencies := make([][]int64, cfg.Users)
+	var receivers sync.WaitGroup
+	for i := range ids {
+		ids[i] = "user" + strconv.Itoa(i)
+		ch := make(chan chatcore.Message, cfg.Buffer)
+		broker.RegisterUser(ids[i], ch)
+		receivers.Add(1)
+		go func(i int) {
+			defer receivers.Done()
+			for msg := range ch {
+				if msg.Type == chatcore.EventMessage && !msg.System {
+					latencies[i] = append(latencies[i], time.Now().UnixNano()-msg.Timestamp)
+				}
+			}
+		}(i)
+	}
+
+	sendCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	var (
+		c       counters
+		senders sync.WaitGroup
+	)
+	start := time.Now()
+	for i := range ids {
+		senders.Add(1)
+		go func(i int) {
+			defer senders.Done()
+			simulateUser(sendCtx, cfg, broker, store, ids, i, &c)
+		}(i)
+	}
+	senders.Wait()
+	sendElapsed := time.Since(start)
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	closeErr := broker.Close(closeCtx)
+	receivers.Wait()
+	elapsed := time.Since(start)
+
+	stats := broker.Stats()
+	report := Report{
+		Users:          cfg.Users,
+		Policy:         cfg.Delivery.Policy.String(),
+		Store:          cfg.Store,
+		ElapsedSeconds: elapsed.Seconds(),
+		Sent:           c.sent.Load(),
+		Broadcasts:     c.broadcasts.Load(),
+		SendErrors:     c.sendErrors.Load(),
+		Expected:       c.expected.Load(),
+		Dropped:        stats.Dropped,
+		Disconnected:   stats.Disconnected,
+		StoreWrites:    c.storeWrites.Load(),
+		StoreErrors:    c.storeErrors.Load(),
+	}
+	all := slices.Concat(latencies...)
+	report.Received = uint64(len(all))
+	if accounted := report.Received + report.Dropped; report.Expected > accounted {
+		report.Lost = report.Expected - accounted
+	}
+	report.SendThroughput = perSecond(report.Sent, sendElapsed)
+	report.DeliveryThroughput = perSecond(report.Received, elapsed)
+	report.StoreThroughput = perSecond(report.StoreWrites, sendElapsed)
+	report.Latency = summarize(all)
+	if closeErr != nil {
+		return report, fmt.Errorf("drain broker: %w", closeErr)
+	}
+	return report, nil
+}
+
+// simulateUser sends messages from user i until ctx is done or its message count is reached
+func simulateUser(ctx context.Context, cfg Config, broker *chatcore.Broker, store *message.MessageStore, ids []string, i int, c *counters) {
+	rng := rand.New(rand.NewSource(cfg.Seed + int64(i)))
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		// Start at a random phase so users do not send in lockstep
+		interval := time.Duration(float64(time.Second) / cfg.Rate)
+		select {
+		case <-time.After(time.Duration(rng.Int63n(int64(interval) + 1))):
+		case <-ctx.Done():
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for n := 0; cfg.MessagesPerUser == 0 || n < cfg.MessagesPerUser; n++ {
+		if n > 0 && tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		msg := chatcore.Message{Sender: ids[i], Content: "message " + strconv.Itoa(n)}
+		expected := uint64(1)
+		if rng.Float64() < cfg.BroadcastRatio {
+			msg.Broadcast = true
+			expected = uint64(len(ids))
+		} else {
+			// Any user but the sender
+			to := rng.Intn(len(ids) - 1)
+			if to >= i {
+				to++
+			}
+			msg.Recipient = ids[to]
+		}
+		msg.Timestamp = time.Now().UnixNano()
+		if err := broker.SendMessageContext(ctx, msg); err != nil {
+			c.sendErrors.Add(1)
+			continue
+		}
+		c.sent.Add(1)
+		c.expected.Add(expected)
+		if msg.Broadcast {
+			c.broadcasts.Add(1)
+		}
+
+		if store != nil {
+			err := store.AddMessage(message.Message{Sender: msg.Sender, Content: msg.Content, Timestamp: msg.Timestamp})
+			if err != nil {
+				c.storeErrors.Add(1)
+			} else {
+				c.storeWrites.Add(1)
+			}
+		}
+	}
+}
+
+func perSecond(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// summarize computes latency percentiles with the nearest-rank method
+func summarize(nanos []int64) Latency {
+	if len(nanos) == 0 {
+		return Latency{}
+	}
+	slices.Sort(nanos)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(nanos)))) - 1
+		return ms(nanos[max(i, 0)])
+	}
+	var sum float64
+	for _, n := range nanos {
+		sum += float64(n)
+	}
+	return Latency{
+		Mean: sum / float64(len(nanos)) / 1e6,
+		P50:  rank(0.50),
+		P90:  rank(0.90),
+		P99:  rank(0.99),
+		Max:  ms(nanos[len(nanos)-1]),
+	}
+}
+
+func ms(nanos int64) float64 {
+	return float64(nanos) / 1e6
+}
@@ -0,0 +1,176 @@
+package chatsim
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"lab02/chatcore"
+)
+
+// smallConfig sends a fixed number of messages as fast as possible
+func smallConfig() Config {
+	cfg := DefaultConfig
+	cfg.Users = 10
+	cfg.Rate = 0
+	cfg.Duration = 0
+	cfg.MessagesPerUser = 50
+	cfg.BroadcastRatio = 0.2
+	return cfg
+}
+
+func TestRunDeliversEverything(t *testing.T) {
+	for _, store := range []string{StoreNone, StoreMemory} {
+		t.Run(store, func(t *testing.T) {
+			cfg := smallConfig()
+			cfg.Store = store
+			report, err := Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if report.Sent != 500 || report.SendErrors != 0 {
+				t.Errorf("Expected 500 messages sent without errors, got %d and %d errors", report.Sent, report.SendErrors)
+			}
+			// Each broadcast reaches all 10 users, each direct message one
+			if expected := report.Sent + 9*report.Broadcasts; report.Expected != expected {
+				t.Errorf("Expected %d deliveries, got %d", expected, report.Expected)
+			}
+			if report.Received != report.Expected || report.Dropped != 0 || report.Lost != 0 {
+				t.Errorf("Expected every message received, got %+v", report)
+			}
+			if store != StoreNone && report.StoreWrites != report.Sent {
+				t.Errorf("Expected %d store writes, got %d", report.Sent, report.StoreWrites)
+			}
+			l := report.Latency
+			if l.P50 <= 0 || l.P50 > l.P90 || l.P90 > l.P99 || l.P99 > l.Max {
+				t.Errorf("Expected ordered positive percentiles, got %+v", l)
+			}
+		})
+	}
+}
+
+func TestRunAccountsForDrops(t *testing.T) {
+	cfg := smallConfig()
+	cfg.Buffer = 1
+	cfg.BroadcastRatio = 1
+	cfg.Delivery = chatcore.DeliveryOptions{Policy: chatcore.DropNewest}
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Received+report.Dropped+report.Lost != report.Expected {
+		t.Errorf("Expected received, dropped and lost to add up to %d, got %+v", report.Expected, report)
+	}
+	if report.Policy != "drop-newest" {
+		t.Errorf("Expected policy drop-newest, got %s", report.Policy)
+	}
+}
+
+func TestRunRateAndDuration(t *testing.T) {
+	cfg := smallConfig()
+	cfg.MessagesPerUser = 0
+	cfg.Rate = 50
+	cfg.Duration = 200 * time.Millisecond
+	report, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// About 10 messages per user, allowing for scheduling
+	if report.Sent < 50 || report.Sent > 150 {
+		t.Errorf("Expected about 100 messages at the configured rate, got %d", report.Sent)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	cfg := smallConfig()
+	cfg.MessagesPerUser = 0
+	cfg.Duration = time.Hour
+	cfg.Rate = 100
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report, err := Run(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Run to stop soon after cancel, took %v", elapsed)
+	}
+	if report.Received != report.Expected {
+		t.Errorf("Expected the messages sent before cancel delivered, got %+v", report)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+	}{
+		{"one user", func(c *Config) { c.Users = 1 }},
+		{"no stop condition", func(c *Config) { c.Duration, c.MessagesPerUser = 0, 0 }},
+		{"negative rate", func(c *Config) { c.Rate = -1 }},
+		{"broadcast ratio", func(c *Config) { c.BroadcastRatio = 1.5 }},
+		{"unknown store", func(c *Config) { c.Store = "redis" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := smallConfig()
+			tt.change(&cfg)
+			if _, err := Run(context.Background(), cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	nanos := make([]int64, 100)
+	for i := range nanos {
+		nanos[i] = int64(100-i) * 1e6 // 100ms down to 1ms
+	}
+	l := summarize(nanos)
+	if l.P50 != 50 || l.P90 != 90 || l.P99 != 99 || l.Max != 100 || l.Mean != 50.5 {
+		t.Errorf("Expected p50 50, p90 90, p99 99, max 100, mean 50.5; got %+v", l)
+	}
+	if summarize(nil) != (Latency{}) {
+		t.Error("Expected zero latencies without samples")
+	}
+}
+
+// BenchmarkScenarios runs the simulation with b.N messages spread over the users;
+// ns/op is the cost of one sent message including its deliveries
+func BenchmarkScenarios(b *testing.B) {
+	scenarios := []struct {
+		name      string
+		users     int
+		broadcast float64
+		store     string
+	}{
+		{"direct", 100, 0, StoreNone},
+		{"mixed", 100, 0.1, StoreNone},
+		{"broadcast-heavy", 100, 0.5, StoreNone},
+		{"many-users", 1000, 0.01, StoreNone},
+		{"mixed-memory-store", 100, 0.1, StoreMemory},
+	}
+	for _, s := range scenarios {
+		b.Run(s.name+"/users="+strconv.Itoa(s.users), func(b *testing.B) {
+			cfg := DefaultConfig
+			cfg.Users = s.users
+			cfg.Rate = 0
+			cfg.Duration = 0
+			cfg.MessagesPerUser = max(b.N/s.users, 1)
+			cfg.BroadcastRatio = s.broadcast
+			cfg.Store = s.store
+			b.ResetTimer()
+			report, err := Run(context.Background(), cfg)
+			if err != nil {
+				b.Fatalf("Run: %v", err)
+			}
+			b.ReportMetric(report.DeliveryThroughput, "deliveries/s")
+			b.ReportMetric(report.Latency.P99, "p99-ms")
+			b.ReportMetric(float64(report.Dropped), "dropped")
+		})
+	}
+}
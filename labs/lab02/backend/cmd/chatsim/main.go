@@ -0,0 +1,103 @@
+// Command chatsim load-tests the chat core: it simulates users sending direct messages
+// and broadcasts through a chatcore.Broker and prints a JSON report of throughput,
+// drops and delivery latency percentiles.
+//
+//	chatsim [-users 100] [-rate 10] [-duration 5s] [-messages n] [-broadcast 0.1]
+//	        [-buffer 100] [-policy block] [-timeout 1s] [-store none] [-o report.json]
+//
+// Interrupting the simulation stops the users early and still reports the messages sent so far.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"lab02/chatcore"
+	"lab02/chatsim"
+)
+
+// errUsage is returned for invalid command lines; the usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+// policies maps the -policy values to delivery policies
+var policies = map[string]chatcore.DeliveryPolicy{}
+
+func init() {
+	for _, p := range []chatcore.DeliveryPolicy{chatcore.BlockWithTimeout, chatcore.DropNewest, chatcore.DropOldest, chatcore.Disconnect} {
+		policies[p.String()] = p
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "chatsim:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run simulates the command line args and writes the report to stdout or the -o file
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	cfg := chatsim.DefaultConfig
+	fs := flag.NewFlagSet("chatsim", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.IntVar(&cfg.Users, "users", cfg.Users, "number of simulated users")
+	fs.Float64Var(&cfg.Rate, "rate", cfg.Rate, "messages per second per user, 0 for as fast as possible")
+	fs.DurationVar(&cfg.Duration, "duration", cfg.Duration, "how long users send, 0 to rely on -messages")
+	fs.IntVar(&cfg.MessagesPerUser, "messages", cfg.MessagesPerUser, "messages per user, 0 for no limit")
+	fs.Float64Var(&cfg.BroadcastRatio, "broadcast", cfg.BroadcastRatio, "share of broadcasts between 0 and 1")
+	fs.IntVar(&cfg.Buffer, "buffer", cfg.Buffer, "capacity of each user channel")
+	policy := fs.String("policy", cfg.Delivery.Policy.String(), "slow consumer policy: block, drop-newest, drop-oldest or disconnect")
+	fs.DurationVar(&cfg.Delivery.Timeout, "timeout", cfg.Delivery.Timeout, "how long the block policy waits for a full channel")
+	fs.StringVar(&cfg.Store, "store", cfg.Store, "also store every message: none or memory")
+	fs.DurationVar(&cfg.DrainTimeout, "drain", cfg.DrainTimeout, "how long to wait for queued messages at the end")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "random seed")
+	output := fs.String("o", "", "write the report to this file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+	var ok bool
+	if cfg.Delivery.Policy, ok = policies[*policy]; !ok {
+		fmt.Fprintf(stderr, "unknown policy %q\n", *policy)
+		fs.Usage()
+		return errUsage
+	}
+
+	report, err := chatsim.Run(ctx, cfg)
+	if err != nil && errors.Is(err, chatsim.ErrInvalidConfig) {
+		return err
+	}
+	// A failed drain still produced a report worth writing
+	if writeErr := writeReport(report, *output, stdout); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// writeReport encodes the report as indented JSON to path, or to stdout if path is empty
+func writeReport(report chatsim.Report, path string, stdout io.Writer) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
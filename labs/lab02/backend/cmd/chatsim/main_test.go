@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lab02/chatsim"
+)
+
+func TestRunWritesReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	var stdout, stderr bytes.Buffer
+	args := []string{"-users", "5", "-rate", "0", "-duration", "0", "-messages", "20", "-policy", "drop-oldest", "-store", "memory", "-o", path}
+	if err := run(context.Background(), args, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v (%s)", err, stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var report chatsim.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %v:\n%s", err, data)
+	}
+	if report.Users != 5 || report.Sent != 100 || report.Policy != "drop-oldest" || report.StoreWrites != 100 {
+		t.Errorf("Expected the report of the configured run, got %+v", report)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout with -o, got %q", stdout.String())
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  error
+	}{
+		{"unknown flag", []string{"-nope"}, errUsage},
+		{"unknown policy", []string{"-policy", "maybe"}, errUsage},
+		{"extra argument", []string{"now"}, errUsage},
+		{"invalid config", []string{"-users", "1"}, chatsim.ErrInvalidConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(context.Background(), tt.args, &stdout, &stderr); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package message
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the GIF decoder for thumbnails
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attachment errors
+var (
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrUnsupportedType    = errors.New("attachment type is not allowed")
+	ErrInvalidAttachment  = errors.New("attachment must reference a blob by SHA-256")
+)
+
+// Attachment limits used until SetLimits is called
+const (
+	DefaultMaxAttachmentSize = 10 << 20
+	DefaultMaxImagePixels    = 25_000_000 // About 5000x5000; decoding takes up to 8 bytes per pixel
+	ThumbnailSize            = 128        // Longest side of a thumbnail in pixels
+)
+
+// DefaultAttachmentTypes are the MIME types accepted until SetLimits is called
+var DefaultAttachmentTypes = []string{"image/*", "text/plain", "application/pdf", "application/zip"}
+
+// Attachment is a file carried by a message; its content lives in a BlobStore
+type Attachment struct {
+	Hash      string `json:"hash"` // Hex SHA-256 of the content
+	Name      string `json:"name"`
+	MIMEType  string `json:"mime_type"` // Detected from the content, not the name
+	Size      int64  `json:"size"`
+	Thumbnail string `json:"thumbnail,omitempty"` // Hash of a PNG preview for images
+}
+
+// hashes returns the blobs the attachment references
+func (a Attachment) hashes() []string {
+	if a.Thumbnail == "" {
+		return []string{a.Hash}
+	}
+	return []string{a.Hash, a.Thumbnail}
+}
+
+// AttachmentLimits restricts what can be uploaded
+type AttachmentLimits struct {
+	MaxSize   int64    // In bytes
+	Types     []string // Allowed MIME types; "image/*" allows every image type
+	MaxPixels int64    // Largest image area, checked before decoding; 0 uses DefaultMaxImagePixels
+}
+
+// allows reports whether the limits accept a MIME type
+func (l AttachmentLimits) allows(mimeType string) bool {
+	for _, t := range l.Types {
+		if t == mimeType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mimeType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachmentStore checks uploads against its limits and stores them in a BlobStore
+type AttachmentStore struct {
+	blobs  BlobStore
+	mutex  sync.RWMutex // Guards limits
+	limits AttachmentLimits
+}
+
+// NewAttachmentStore creates an AttachmentStore with the default limits
+func NewAttachmentStore(blobs BlobStore) *AttachmentStore {
+	return &AttachmentStore{
+		blobs:  blobs,
+		limits: AttachmentLimits{MaxSize: DefaultMaxAttachmentSize, Types: DefaultAttachmentTypes},
+	}
+}
+
+// SetLimits replaces the upload limits
+func (s *AttachmentStore) SetLimits(limits AttachmentLimits) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limits = limits
+}
+
+// Upload stores the content of r as an attachment named name. The MIME type is sniffed from
+// the content, images larger than the pixel limit are rejected and those that can be decoded
+// get a thumbnail. Attach the result to a message
+// with MessageStore.Add; blobs that no message references are removed by CollectBlobs.
+func (s *AttachmentStore) Upload(name string, r io.Reader) (Attachment, error) {
+	s.mutex.RLock()
+	limits := s.limits
+	s.mutex.RUnlock()
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxSize+1))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("read attachment: %w", err)
+	}
+	if int64(len(data)) > limits.MaxSize {
+		return Attachment{}, fmt.Errorf("%w: more than %d bytes", ErrAttachmentTooLarge, limits.MaxSize)
+	}
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil || !limits.allows(mimeType) {
+		return Attachment{}, fmt.Errorf("%w: %s", ErrUnsupportedType, mimeType)
+	}
+
+	// A small file can declare huge dimensions, so check them before anything decodes it
+	decodable := false
+	if strings.HasPrefix(mimeType, "image/") {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			maxPixels := cmp.Or(limits.MaxPixels, DefaultMaxImagePixels)
+			if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+				return Attachment{}, fmt.Errorf("%w: %dx%d image, at most %d pixels",
+					ErrAttachmentTooLarge, cfg.Width, cfg.Height, maxPixels)
+			}
+			decodable = true
+		}
+	}
+
+	att := Attachment{Name: name, MIMEType: mimeType}
+	if att.Hash, att.Size, err = s.blobs.Put(bytes.NewReader(data)); err != nil {
+		return Attachment{}, err
+	}
+	if decodable {
+		if thumb, ok := thumbnail(data); ok {
+			if att.Thumbnail, _, err = s.blobs.Put(bytes.NewReader(thumb)); err != nil {
+				return Attachment{}, err
+			}
+		}
+	}
+	return att, nil
+}
+
+// Open returns the content of an attachment or thumbnail
+func (s *AttachmentStore) Open(hash string) (io.ReadCloser, error) {
+	return s.blobs.Open(hash)
+}
+
+// thumbnail decodes an image and encodes a PNG scaled to fit ThumbnailSize,
+// reporting false for formats it cannot decode
+func thumbnail(data []byte) ([]byte, bool) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil, false
+	}
+	scale := min(1, float64(ThumbnailSize)/float64(max(w, h)))
+	tw, th := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+
+	// Box filter: every thumbnail pixel averages the source pixels it covers
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r, g, b, a = r+uint64(c.R), g+uint64(c.G), b+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// CollectBlobs deletes the blobs that no stored message references and returns their hashes.
+// Blobs stored within the grace period are kept, so uploads whose message has not been
+// added yet survive.
+func (s *MessageStore) CollectBlobs(blobs BlobStore, grace time.Duration) ([]string, error) {
+	// Holding the lock keeps messages from referencing a blob between the scan and the delete
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	page, err := s.backend.Query(Query{})
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool)
+	for _, msg := range page.Messages {
+		for _, att := range msg.Attachments {
+			for _, hash := range att.hashes() {
+				referenced[hash] = true
+			}
+		}
+	}
+
+	stored, err := blobs.List()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-grace)
+	var removed []string
+	for _, blob := range stored {
+		if referenced[blob.Hash] || blob.ModTime.After(cutoff) {
+			continue
+		}
+		// The blob may have been stored again since List
+		deleted, err := blobs.DeleteIfOlder(blob.Hash, cutoff)
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return removed, err
+		}
+		if deleted {
+			removed = append(removed, blob.Hash)
+		}
+	}
+	return removed, nil
+}
+
+// checkBlobs verifies that the blobs of attachments exist, if the store has a BlobStore.
+// Callers must hold s.mutex.
+func (s *MessageStore) checkBlobs(attachments []Attachment) error {
+	if s.blobs == nil {
+		return nil
+	}
+	for _, att := range attachments {
+		for _, hash := range att.hashes() {
+			if _, err := s.blobs.Stat(hash); errors.Is(err, ErrBlobNotFound) {
+				return fmt.Errorf("%w: blob %s is not stored", ErrInvalidAttachment, hash)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBlobStore(t *testing.T) *FSBlobStore {
+	t.Helper()
+	blobs, err := NewFSBlobStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatalf("NewFSBlobStore: %v", err)
+	}
+	return blobs
+}
+
+func readBlob(t *testing.T, blobs BlobStore, hash string) []byte {
+	t.Helper()
+	r, err := blobs.Open(hash)
+	if err != nil {
+		t.Fatalf("Open %s: %v", hash, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read %s: %v", hash, err)
+	}
+	return data
+}
+
+func pngImage(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// pngBomb returns a tiny PNG whose header declares w x h pixels
+func pngBomb(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	data := pngImage(t, 1, 1)
+	// The IHDR chunk follows the 8-byte signature: length, type, width, height, ..., CRC
+	binary.BigEndian.PutUint32(data[16:], w)
+	binary.BigEndian.PutUint32(data[20:], h)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestFSBlobStore(t *testing.T) {
+	blobs := newBlobStore(t)
+	content := []byte("hello, blobs")
+	sum := sha256.Sum256(content)
+
+	hash, size, err := blobs.Put(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if hash != hex.EncodeToString(sum[:]) || size != int64(len(content)) {
+		t.Errorf("Expected hash %x and size %d, got %s and %d", sum, len(content), hash, size)
+	}
+	if again, _, _ := blobs.Put(bytes.NewReader(content)); again != hash {
+		t.Errorf("Expected the same hash for the same content, got %s", again)
+	}
+	if got := readBlob(t, blobs, hash); !bytes.Equal(got, content) {
+		t.Errorf("Expected %q, got %q", content, got)
+	}
+	if list, _ := blobs.List(); len(list) != 1 || list[0].Hash != hash {
+		t.Errorf("Expected one blob, got %+v", list)
+	}
+	if info, err := blobs.Stat(hash); err != nil || info.Size != size {
+		t.Errorf("Expected a %d byte blob, got %+v (%v)", size, info, err)
+	}
+
+	if err := blobs.Delete(hash); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := blobs.Open(hash); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+	if _, err := blobs.Stat(hash); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+	if err := blobs.Delete(hash); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+	if _, err := blobs.Open("../../etc/passwd"); !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("Expected ErrInvalidHash, got %v", err)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	attachments := NewAttachmentStore(newBlobStore(t))
+	attachments.SetLimits(AttachmentLimits{MaxSize: 1024, Types: []string{"image/*", "text/plain"}})
+
+	tests := []struct {
+		name    string
+		content []byte
+		mime    string
+		err     error
+	}{
+		{"text", []byte("meeting notes"), "text/plain", nil},
+		{"image", pngImage(t, 4, 4), "image/png", nil},
+		{"at the limit", bytes.Repeat([]byte("a"), 1024), "text/plain", nil},
+		{"too large", bytes.Repeat([]byte("a"), 1025), "", ErrAttachmentTooLarge},
+		{"pdf not allowed", []byte("%PDF-1.4 fake"), "", ErrUnsupportedType},
+		{"binary not allowed", []byte{0, 1, 2, 3, 0xff}, "", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The name does not decide the type
+			att, err := attachments.Upload("file.txt", bytes.NewReader(tt.content))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if err == nil && (att.MIMEType != tt.mime || att.Size != int64(len(tt.content)) || att.Name != "file.txt") {
+				t.Errorf("Expected %s of %d bytes, got %+v", tt.mime, len(tt.content), att)
+			}
+		})
+	}
+}
+
+func TestUploadRejectsDecompressionBomb(t *testing.T) {
+	blobs := newBlobStore(t)
+	attachments := NewAttachmentStore(blobs)
+	bomb := pngBomb(t, 100_000, 100_000)
+	if _, err := attachments.Upload("bomb.png", bytes.NewReader(bomb)); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("Expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if list, _ := blobs.List(); len(list) != 0 {
+		t.Errorf("Expected nothing stored, got %+v", list)
+	}
+
+	attachments.SetLimits(AttachmentLimits{MaxSize: 1 << 20, Types: []string{"image/*"}, MaxPixels: 100})
+	if _, err := attachments.Upload("ok.png", bytes.NewReader(pngImage(t, 10, 10))); err != nil {
+		t.Errorf("Expected an image at the pixel limit to pass, got %v", err)
+	}
+	if _, err := attachments.Upload("big.png", bytes.NewReader(pngImage(t, 11, 10))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("Expected ErrAttachmentTooLarge, got %v", err)
+	}
+}
+
+func TestUploadThumbnail(t *testing.T) {
+	blobs := newBlobStore(t)
+	attachments := NewAttachmentStore(blobs)
+	tests := []struct {
+		name           string
+		w, h           int
+		thumbW, thumbH int
+	}{
+		{"landscape", 512, 256, ThumbnailSize, ThumbnailSize / 2},
+		{"portrait", 100, 300, 42, ThumbnailSize},
+		{"small", 20, 10, 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att, err := attachments.Upload("photo.png", bytes.NewReader(pngImage(t, tt.w, tt.h)))
+			if err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+			if att.Thumbnail == "" {
+				t.Fatal("Expected a thumbnail")
+			}
+			thumb, err := png.Decode(bytes.NewReader(readBlob(t, blobs, att.Thumbnail)))
+			if err != nil {
+				t.Fatalf("Decode thumbnail: %v", err)
+			}
+			if b := thumb.Bounds(); b.Dx() != tt.thumbW || b.Dy() != tt.thumbH {
+				t.Errorf("Expected a %dx%d thumbnail, got %dx%d", tt.thumbW, tt.thumbH, b.Dx(), b.Dy())
+			}
+		})
+	}
+
+	text, _ := attachments.Upload("notes.txt", strings.NewReader("no preview"))
+	if text.Thumbnail != "" {
+		t.Errorf("Expected no thumbnail for text, got %s", text.Thumbnail)
+	}
+}
+
+func TestCollectBlobs(t *testing.T) {
+	blobs := newBlobStore(t)
+	attachments := NewAttachmentStore(blobs)
+	store := NewMessageStore()
+
+	photo, _ := attachments.Upload("photo.png", bytes.NewReader(pngImage(t, 200, 200)))
+	notes, _ := attachments.Upload("notes.txt", strings.NewReader("keep me"))
+	orphan, _ := attachments.Upload("draft.txt", strings.NewReader("never sent"))
+	msg, err := store.Add(Message{Sender: "alice", Content: "see attached", Attachments: []Attachment{photo}})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	store.Add(Message{Sender: "bob", Content: "mine too", Attachments: []Attachment{notes}})
+
+	// Fresh uploads are within the grace period
+	if removed, _ := store.CollectBlobs(blobs, time.Hour); len(removed) != 0 {
+		t.Errorf("Expected nothing removed within the grace period, got %v", removed)
+	}
+	removed, err := store.CollectBlobs(blobs, -time.Second)
+	if err != nil {
+		t.Fatalf("CollectBlobs: %v", err)
+	}
+	if !slices.Equal(removed, []string{orphan.Hash}) {
+		t.Errorf("Expected only the orphan %s removed, got %v", orphan.Hash, removed)
+	}
+
+	// Deleting the message releases the image and its thumbnail
+	store.DeleteMessage(msg.ID, "alice")
+	removed, _ = store.CollectBlobs(blobs, -time.Second)
+	slices.Sort(removed)
+	expected := []string{photo.Hash, photo.Thumbnail}
+	slices.Sort(expected)
+	if !slices.Equal(removed, expected) {
+		t.Errorf("Expected %v removed, got %v", expected, removed)
+	}
+	readBlob(t, blobs, notes.Hash)
+}
+
+// staleList lists every blob as stored long ago, as a List made before a blob was stored again would
+type staleList struct {
+	*FSBlobStore
+}
+
+func (s staleList) List() ([]BlobInfo, error) {
+	blobs, err := s.FSBlobStore.List()
+	for i := range blobs {
+		blobs[i].ModTime = time.Time{}
+	}
+	return blobs, err
+}
+
+func TestCollectBlobsKeepsBlobsStoredAgain(t *testing.T) {
+	blobs := newBlobStore(t)
+	attachments := NewAttachmentStore(blobs)
+	store := NewMessageStore()
+	draft, _ := attachments.Upload("draft.txt", strings.NewReader("uploaded again"))
+
+	removed, err := store.CollectBlobs(staleList{blobs}, time.Hour)
+	if err != nil {
+		t.Fatalf("CollectBlobs: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected the fresh blob to be kept, got %v removed", removed)
+	}
+	readBlob(t, blobs, draft.Hash)
+
+	if deleted, err := blobs.DeleteIfOlder(draft.Hash, time.Now().Add(time.Second)); !deleted || err != nil {
+		t.Errorf("Expected the blob to be deleted once older than the cutoff, got %v (%v)", deleted, err)
+	}
+	if _, err := blobs.DeleteIfOlder(draft.Hash, time.Now()); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func TestSetLimitsDuringUploads(t *testing.T) {
+	attachments := NewAttachmentStore(newBlobStore(t))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			attachments.SetLimits(AttachmentLimits{MaxSize: int64(100 + i), Types: []string{"text/plain"}})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := attachments.Upload("notes.txt", strings.NewReader("short notes")); err != nil {
+			t.Errorf("Upload: %v", err)
+		}
+	}
+	<-done
+}
+
+func TestAddRejectsInvalidAttachments(t *testing.T) {
+	store := NewMessageStore()
+	for _, att := range []Attachment{{Hash: "abc"}, {Hash: strings.Repeat("A", 64)}} {
+		if _, err := store.Add(Message{Sender: "alice", Attachments: []Attachment{att}}); !errors.Is(err, ErrInvalidAttachment) {
+			t.Errorf("Expected ErrInvalidAttachment for %q, got %v", att.Hash, err)
+		}
+	}
+}
+
+func TestAddRequiresStoredBlobs(t *testing.T) {
+	blobs := newBlobStore(t)
+	attachments := NewAttachmentStore(blobs)
+	store := NewMessageStore()
+	store.SetBlobStore(blobs)
+
+	photo, _ := attachments.Upload("photo.png", bytes.NewReader(pngImage(t, 200, 200)))
+	if _, err := store.Add(Message{Sender: "alice", Attachments: []Attachment{photo}}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	missing := Attachment{Hash: strings.Repeat("ab", 32), Name: "gone.txt"}
+	if _, err := store.Add(Message{Sender: "alice", Attachments: []Attachment{missing}}); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment for a missing blob, got %v", err)
+	}
+	noThumb := photo
+	noThumb.Thumbnail = strings.Repeat("cd", 32)
+	if _, err := store.Add(Message{Sender: "alice", Attachments: []Attachment{noThumb}}); !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("Expected ErrInvalidAttachment for a missing thumbnail, got %v", err)
+	}
+}
+
+func TestAttachmentsPersist(t *testing.T) {
+	att := Attachment{Hash: strings.Repeat("ab", 32), Name: "a.txt", MIMEType: "text/plain", Size: 3}
+	for _, name := range []string{"file", "sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages")
+			store := NewMessageStoreWithBackend(backends[name](t, path))
+			store.Add(Message{Sender: "alice", Content: "file", Attachments: []Attachment{att}})
+			store.Close()
+
+			store = NewMessageStoreWithBackend(backends[name](t, path))
+			defer store.Close()
+			msgs, _ := store.GetMessages("")
+			if len(msgs) != 1 || len(msgs[0].Attachments) != 1 || msgs[0].Attachments[0] != att {
+				t.Errorf("Expected the attachment after reopen, got %+v", msgs)
+			}
+		})
+	}
+}
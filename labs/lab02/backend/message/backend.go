@@ -0,0 +1,133 @@
+package message
+
+import (
+	"slices"
+	"sort"
+)
+
+// Backend persists messages for a MessageStore.
+// Implementations assign IDs starting at 1, one greater than the last assigned ID,
+// and never reuse them. MessageStore serializes writes, so a backend only has to
+// tolerate concurrent reads.
+type Backend interface {
+	// Append stores a new message, ignoring msg.ID, and returns it with its assigned ID
+	Append(msg Message) (Message, error)
+	// Get returns the message with the given ID, ErrMessageNotFound if there is none
+	Get(id int64) (Message, error)
+	// Query returns the messages matching q ordered by ID; q is already validated
+	Query(q Query) (Page, error)
+	// Update replaces a stored message with msg, ErrMessageNotFound if there is none with msg.ID
+	Update(msg Message) error
+	// DeleteBefore removes every message with an ID below id
+	DeleteBefore(id int64) error
+	// LastID returns the last assigned ID, 0 if none was assigned yet
+	LastID() (int64, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// BatchAppender is implemented by backends that can store several new messages with one
+// write, such as one sync or one transaction. MessageStore uses it for the adds it commits
+// together; the batch is stored entirely or not at all.
+type BatchAppender interface {
+	// AppendBatch is Append for several messages, which get consecutive IDs in order
+	AppendBatch(msgs []Message) ([]Message, error)
+}
+
+// MemoryBackend keeps messages in a slice ordered by ID; everything is lost when the process exits
+type MemoryBackend struct {
+	messages []Message
+	lastID   int64
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{messages: make([]Message, 0, 100)}
+}
+
+// Append stores a new message with the next ID
+func (b *MemoryBackend) Append(msg Message) (Message, error) {
+	b.lastID++
+	msg.ID = b.lastID
+	b.messages = append(b.messages, msg)
+	return msg, nil
+}
+
+// Get finds a message by binary search
+func (b *MemoryBackend) Get(id int64) (Message, error) {
+	i := b.search(id)
+	if i == len(b.messages) || b.messages[i].ID != id {
+		return Message{}, ErrMessageNotFound
+	}
+	return b.messages[i], nil
+}
+
+// Query scans the messages between the cursors, from the end for backward pages
+func (b *MemoryBackend) Query(q Query) (Page, error) {
+	lo, hi := 0, len(b.messages)
+	if q.AfterID > 0 {
+		lo = b.search(q.AfterID + 1)
+	}
+	if q.BeforeID > 0 {
+		hi = b.search(q.BeforeID)
+	}
+
+	page := Page{Messages: []Message{}}
+	if q.backward() {
+		for i := hi - 1; i >= lo; i-- {
+			if !q.matches(b.messages[i]) {
+				continue
+			}
+			if q.Limit > 0 && len(page.Messages) == q.Limit {
+				page.HasMore = true
+				break
+			}
+			page.Messages = append(page.Messages, b.messages[i])
+		}
+		slices.Reverse(page.Messages)
+		return page, nil
+	}
+	for i := lo; i < hi; i++ {
+		if !q.matches(b.messages[i]) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Messages) == q.Limit {
+			page.HasMore = true
+			break
+		}
+		page.Messages = append(page.Messages, b.messages[i])
+	}
+	return page, nil
+}
+
+// Update replaces the message in place
+func (b *MemoryBackend) Update(msg Message) error {
+	i := b.search(msg.ID)
+	if i == len(b.messages) || b.messages[i].ID != msg.ID {
+		return ErrMessageNotFound
+	}
+	b.messages[i] = msg
+	return nil
+}
+
+// DeleteBefore drops the messages with smaller IDs
+func (b *MemoryBackend) DeleteBefore(id int64) error {
+	i := b.search(id)
+	b.messages = append(make([]Message, 0, len(b.messages)-i), b.messages[i:]...)
+	return nil
+}
+
+// LastID returns the last assigned ID
+func (b *MemoryBackend) LastID() (int64, error) {
+	return b.lastID, nil
+}
+
+// Close is a no-op
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+// search returns the index of the first message with an ID of at least id
+func (b *MemoryBackend) search(id int64) int {
+	return sort.Search(len(b.messages), func(i int) bool { return b.messages[i].ID >= id })
+}
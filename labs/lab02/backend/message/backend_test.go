@@ -0,0 +1,249 @@
+package message
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// backendFactory opens a backend; calling it twice with the same path must return
+// a backend over the same data for persistent backends
+type backendFactory func(t testing.TB, path string) Backend
+
+var backends = map[string]backendFactory{
+	"memory": func(t testing.TB, path string) Backend { return NewMemoryBackend() },
+	"file": func(t testing.TB, path string) Backend {
+		b, err := NewFileBackend(path + ".jsonl")
+		if err != nil {
+			t.Fatalf("NewFileBackend: %v", err)
+		}
+		return b
+	},
+	"sqlite": func(t testing.TB, path string) Backend {
+		b, err := NewSQLiteBackend(path + ".db")
+		if err != nil {
+			t.Fatalf("NewSQLiteBackend: %v", err)
+		}
+		return b
+	},
+}
+
+// newHistory stores 10 messages alternating between alice and bob, with timestamps 10, 20, ... 100
+func newHistory(t *testing.T, backend Backend) *MessageStore {
+	t.Helper()
+	store := NewMessageStoreWithBackend(backend)
+	for i := 1; i <= 10; i++ {
+		sender := "alice"
+		if i%2 == 0 {
+			sender = "bob"
+		}
+		if err := store.AddMessage(Message{Sender: sender, Content: "msg", Timestamp: int64(i * 10)}); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+	return store
+}
+
+func ids(msgs []Message) []int64 {
+	result := make([]int64, len(msgs))
+	for i, m := range msgs {
+		result[i] = m.ID
+	}
+	return result
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBackendQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   Query
+		ids     []int64
+		hasMore bool
+	}{
+		{"all", Query{}, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, false},
+		{"first page", Query{Limit: 3}, []int64{1, 2, 3}, true},
+		{"after cursor", Query{AfterID: 3, Limit: 3}, []int64{4, 5, 6}, true},
+		{"last page", Query{AfterID: 8, Limit: 3}, []int64{9, 10}, false},
+		{"before cursor", Query{BeforeID: 8, Limit: 3}, []int64{5, 6, 7}, true},
+		{"before start", Query{BeforeID: 3, Limit: 3}, []int64{1, 2}, false},
+		{"between cursors", Query{AfterID: 2, BeforeID: 9, Limit: 3}, []int64{3, 4, 5}, true},
+		{"by sender", Query{Sender: "bob", Limit: 2}, []int64{2, 4}, true},
+		{"sender before cursor", Query{Sender: "alice", BeforeID: 9, Limit: 2}, []int64{5, 7}, true},
+		{"time range", Query{Since: 30, Until: 60}, []int64{3, 4, 5}, false},
+		{"time range with limit", Query{Since: 30, Until: 60, Limit: 2}, []int64{3, 4}, true},
+		{"no match", Query{Sender: "carol"}, []int64{}, false},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := newHistory(t, open(t, filepath.Join(t.TempDir(), "messages")))
+			defer store.Close()
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					page, err := store.Query(tt.query)
+					if err != nil {
+						t.Fatalf("Query: %v", err)
+					}
+					if got := ids(page.Messages); !equalIDs(got, tt.ids) {
+						t.Errorf("Expected IDs %v, got %v", tt.ids, got)
+					}
+					if page.HasMore != tt.hasMore {
+						t.Errorf("Expected HasMore %v, got %v", tt.hasMore, page.HasMore)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestBackendRetention(t *testing.T) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := newHistory(t, open(t, filepath.Join(t.TempDir(), "messages")))
+			defer store.Close()
+			if err := store.SetRetention(4); err != nil {
+				t.Fatalf("SetRetention: %v", err)
+			}
+			msgs, _ := store.GetMessages("")
+			if got := ids(msgs); !equalIDs(got, []int64{7, 8, 9, 10}) {
+				t.Errorf("Expected IDs 7-10, got %v", got)
+			}
+
+			msg, err := store.Add(Message{Sender: "alice", Content: "new"})
+			if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if msg.ID != 11 || msg.Timestamp == 0 {
+				t.Errorf("Expected ID 11 with a timestamp, got %+v", msg)
+			}
+			msgs, _ = store.GetMessages("")
+			if got := ids(msgs); !equalIDs(got, []int64{8, 9, 10, 11}) {
+				t.Errorf("Expected IDs 8-11, got %v", got)
+			}
+		})
+	}
+}
+
+func TestPersistentBackendsSurviveReopen(t *testing.T) {
+	for _, name := range []string{"file", "sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages")
+			store := newHistory(t, backends[name](t, path))
+			store.SetRetention(3)
+			if err := store.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			store = NewMessageStoreWithBackend(backends[name](t, path))
+			defer store.Close()
+			msgs, _ := store.GetMessages("")
+			if got := ids(msgs); !equalIDs(got, []int64{8, 9, 10}) {
+				t.Errorf("Expected IDs 8-10 after reopen, got %v", got)
+			}
+			msg, err := store.Add(Message{Sender: "alice", Content: "new"})
+			if err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if msg.ID != 11 {
+				t.Errorf("Expected ID 11 after reopen, got %d", msg.ID)
+			}
+		})
+	}
+}
+
+func TestFileBackendCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	backend, err := NewFileBackend(path)
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+	backend.compactAfter = 5
+	store := NewMessageStoreWithBackend(backend)
+	store.SetRetention(2)
+	for i := 0; i < 20; i++ {
+		store.AddMessage(Message{Sender: "alice", Content: "msg"})
+	}
+	store.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	// Without compaction the log would hold 20 adds and 18 deletions
+	if lines := strings.Count(string(data), "\n"); lines > 12 {
+		t.Errorf("Expected a compacted log, got %d lines", lines)
+	}
+
+	backend, err = NewFileBackend(path)
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+	defer backend.Close()
+	page, _ := backend.Query(Query{})
+	if got := ids(page.Messages); !equalIDs(got, []int64{19, 20}) {
+		t.Errorf("Expected IDs 19 and 20, got %v", got)
+	}
+
+	// Compacting everything away keeps the ID counter
+	backend.DeleteBefore(21)
+	if err := backend.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	backend.Close()
+	backend, _ = NewFileBackend(path)
+	defer backend.Close()
+	if msg, _ := backend.Append(Message{Sender: "alice"}); msg.ID != 21 {
+		t.Errorf("Expected ID 21, got %d", msg.ID)
+	}
+}
+
+func TestFileBackendDiscardsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	backend, _ := NewFileBackend(path)
+	backend.Append(Message{Sender: "alice", Content: "kept"})
+	backend.Close()
+
+	// Simulate a crash in the middle of writing the second record
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`{"op":"add","message":{"id":2,"sen`)
+	f.Close()
+
+	backend, err := NewFileBackend(path)
+	if err != nil {
+		t.Fatalf("NewFileBackend: %v", err)
+	}
+	msg, err := backend.Append(Message{Sender: "bob", Content: "after crash"})
+	if err != nil || msg.ID != 2 {
+		t.Fatalf("Expected ID 2, got %+v (%v)", msg, err)
+	}
+	backend.Close()
+
+	backend, err = NewFileBackend(path)
+	if err != nil {
+		t.Fatalf("Expected a clean log after recovery, got %v", err)
+	}
+	defer backend.Close()
+	page, _ := backend.Query(Query{})
+	if len(page.Messages) != 2 || page.Messages[1].Content != "after crash" {
+		t.Errorf("Unexpected messages: %+v", page.Messages)
+	}
+}
+
+func TestFileBackendRejectsCorruptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	os.WriteFile(path, []byte("not json\n{\"op\":\"add\",\"message\":{\"id\":1}}\n"), 0o644)
+	if _, err := NewFileBackend(path); err == nil {
+		t.Error("Expected an error for a corrupt line in the middle of the log")
+	}
+}
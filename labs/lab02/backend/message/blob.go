@@ -0,0 +1,188 @@
+package message
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Blob store errors
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidHash  = errors.New("invalid blob hash")
+)
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time // When the blob was last stored
+}
+
+// BlobStore keeps content addressed by the hex SHA-256 of the content, so storing
+// the same content twice keeps one copy
+type BlobStore interface {
+	// Put stores the content of r and returns its hash and size
+	Put(r io.Reader) (hash string, size int64, err error)
+	// Open returns the content of a blob, ErrBlobNotFound if there is none
+	Open(hash string) (io.ReadCloser, error)
+	// Stat describes a blob, ErrBlobNotFound if there is none
+	Stat(hash string) (BlobInfo, error)
+	// Delete removes a blob, ErrBlobNotFound if there is none
+	Delete(hash string) error
+	// DeleteIfOlder removes a blob last stored before cutoff and reports whether it did.
+	// A Put of the same content cannot land between the check and the removal.
+	DeleteIfOlder(hash string, cutoff time.Time) (bool, error)
+	// List returns every stored blob in no particular order
+	List() ([]BlobInfo, error)
+}
+
+// FSBlobStore keeps blobs as files in a directory, fanned out by the first two hex digits
+type FSBlobStore struct {
+	dir   string
+	mutex sync.Mutex // Orders the renames of Put with DeleteIfOlder
+}
+
+// NewFSBlobStore creates a blob store in dir, creating the directory if needed
+func NewFSBlobStore(dir string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create blob directory: %w", err)
+	}
+	return &FSBlobStore{dir: dir}, nil
+}
+
+// Put writes r to a temporary file while hashing it, then renames it into place
+func (s *FSBlobStore) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(s.dir, "blob.*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("store blob: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once the rename has succeeded
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("store blob: %w", err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	path := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, fmt.Errorf("store blob: %w", err)
+	}
+	// Renaming over an existing blob is harmless, its content is the same
+	s.mutex.Lock()
+	err = os.Rename(tmpName, path)
+	s.mutex.Unlock()
+	if err != nil {
+		return "", 0, fmt.Errorf("store blob: %w", err)
+	}
+	return hash, size, nil
+}
+
+// Open opens the blob's file
+func (s *FSBlobStore) Open(hash string) (io.ReadCloser, error) {
+	if !validHash(hash) {
+		return nil, ErrInvalidHash
+	}
+	f, err := os.Open(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+// Stat stats the blob's file
+func (s *FSBlobStore) Stat(hash string) (BlobInfo, error) {
+	if !validHash(hash) {
+		return BlobInfo{}, ErrInvalidHash
+	}
+	info, err := os.Stat(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Hash: hash, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the blob's file
+func (s *FSBlobStore) Delete(hash string) error {
+	if !validHash(hash) {
+		return ErrInvalidHash
+	}
+	err := os.Remove(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+// DeleteIfOlder stats and removes the blob's file without letting Put rename over it in between
+func (s *FSBlobStore) DeleteIfOlder(hash string, cutoff time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info, err := s.Stat(hash)
+	if err != nil {
+		return false, err
+	}
+	if !info.ModTime.Before(cutoff) {
+		return false, nil
+	}
+	return true, s.Delete(hash)
+}
+
+// List walks the directory, skipping temporary files of unfinished puts
+func (s *FSBlobStore) List() ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !validHash(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, BlobInfo{Hash: d.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list blobs: %w", err)
+	}
+	return blobs, nil
+}
+
+func (s *FSBlobStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// validHash reports whether hash is a lowercase hex SHA-256 digest
+func validHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package message
+
+import (
+	"maps"
+	"slices"
+	"time"
+	"unicode"
+)
+
+// DeletedContent replaces the content of deleted messages
+const DeletedContent = "message deleted"
+
+// Revision is a previous content of an edited message
+type Revision struct {
+	Content  string `json:"content"`
+	EditedAt int64  `json:"edited_at"` // When this content was replaced
+}
+
+// ReactionCounts returns how many users reacted with each emoji
+func (m Message) ReactionCounts() map[string]int {
+	counts := make(map[string]int, len(m.Reactions))
+	for emoji, users := range m.Reactions {
+		counts[emoji] = len(users)
+	}
+	return counts
+}
+
+// EditMessage replaces the content of a message sent by editor, keeping the old content as a revision
+func (s *MessageStore) EditMessage(id int64, editor, content string) (Message, error) {
+	return s.change(id, func(msg *Message) error {
+		if msg.Sender != editor {
+			return ErrNotAuthor
+		}
+		now := time.Now().UnixNano()
+		msg.Revisions = append(slices.Clip(msg.Revisions), Revision{Content: msg.Content, EditedAt: now})
+		msg.Content = content
+		msg.EditedAt = now
+		return nil
+	})
+}
+
+// DeleteMessage turns a message sent by user into a tombstone. The message keeps its ID,
+// sender and place in history, but its content, revisions, reactions and attachments are removed.
+func (s *MessageStore) DeleteMessage(id int64, user string) (Message, error) {
+	return s.change(id, func(msg *Message) error {
+		if msg.Sender != user {
+			return ErrNotAuthor
+		}
+		msg.Content = DeletedContent
+		msg.Deleted = true
+		msg.Revisions = nil
+		msg.Reactions = nil
+		msg.Attachments = nil
+		return nil
+	})
+}
+
+// ToggleReaction adds user's emoji reaction to a message, or removes it if already present
+func (s *MessageStore) ToggleReaction(id int64, user, emoji string) (Message, error) {
+	if !isEmoji(emoji) {
+		return Message{}, ErrInvalidReaction
+	}
+	return s.change(id, func(msg *Message) error {
+		// Copy on write: readers may still hold the previous map
+		reactions := maps.Clone(msg.Reactions)
+		if reactions == nil {
+			reactions = make(map[string][]string)
+		}
+		users := reactions[emoji]
+		if i, found := slices.BinarySearch(users, user); found {
+			users = slices.Delete(slices.Clone(users), i, i+1)
+		} else {
+			users = slices.Insert(slices.Clone(users), i, user)
+		}
+		if len(users) == 0 {
+			delete(reactions, emoji)
+		} else {
+			reactions[emoji] = users
+		}
+		if len(reactions) == 0 {
+			reactions = nil
+		}
+		msg.Reactions = reactions
+		return nil
+	})
+}
+
+// Replies returns a page of the replies to a message, see Query
+func (s *MessageStore) Replies(id int64, q Query) (Page, error) {
+	q.ReplyTo = id
+	return s.Query(q)
+}
+
+// change applies fn to a stored message that is not deleted and saves the result
+func (s *MessageStore) change(id int64, fn func(msg *Message) error) (Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	msg, err := s.backend.Get(id)
+	if err != nil {
+		return Message{}, err
+	}
+	if msg.Deleted {
+		return Message{}, ErrMessageDeleted
+	}
+	if err := fn(&msg); err != nil {
+		return Message{}, err
+	}
+	if err := s.backend.Update(msg); err != nil {
+		return Message{}, err
+	}
+	if s.index != nil {
+		s.index.remove(id)
+		s.index.add(msg)
+	}
+	return msg, nil
+}
+
+// isEmoji reports whether s consists of emoji: symbols with optional skin tone modifiers,
+// variation selectors and zero width joiners
+func isEmoji(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	symbol := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbol = true
+		case unicode.Is(unicode.Sk, r), r == '‍', r == '️', r == '⃣':
+		default:
+			return false
+		}
+	}
+	return symbol
+}
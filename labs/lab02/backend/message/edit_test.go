@@ -0,0 +1,197 @@
+package message
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEditMessage(t *testing.T) {
+	store := NewMessageStore()
+	msg, _ := store.Add(Message{Sender: "alice", Content: "helo"})
+
+	if _, err := store.EditMessage(msg.ID, "bob", "hacked"); !errors.Is(err, ErrNotAuthor) {
+		t.Errorf("Expected ErrNotAuthor, got %v", err)
+	}
+	if _, err := store.EditMessage(42, "alice", "hello"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+	store.EditMessage(msg.ID, "alice", "hello")
+	edited, err := store.EditMessage(msg.ID, "alice", "hello!")
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if edited.Content != "hello!" || edited.EditedAt == 0 {
+		t.Errorf("Expected edited content %q, got %+v", "hello!", edited)
+	}
+	if len(edited.Revisions) != 2 || edited.Revisions[0].Content != "helo" || edited.Revisions[1].Content != "hello" {
+		t.Errorf("Expected revisions helo, hello; got %+v", edited.Revisions)
+	}
+	msgs, _ := store.GetMessages("")
+	if msgs[0].Content != "hello!" {
+		t.Errorf("Expected stored content %q, got %q", "hello!", msgs[0].Content)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	store := NewMessageStore()
+	msg, _ := store.Add(Message{Sender: "alice", Content: "secret plans"})
+	store.Add(Message{Sender: "bob", Content: "after"})
+	store.ToggleReaction(msg.ID, "bob", "👍")
+
+	if _, err := store.DeleteMessage(msg.ID, "bob"); !errors.Is(err, ErrNotAuthor) {
+		t.Errorf("Expected ErrNotAuthor, got %v", err)
+	}
+	deleted, err := store.DeleteMessage(msg.ID, "alice")
+	if err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if !deleted.Deleted || deleted.Content != DeletedContent || deleted.Reactions != nil {
+		t.Errorf("Expected a tombstone, got %+v", deleted)
+	}
+
+	// The tombstone keeps its place in history but cannot be changed or found
+	msgs, _ := store.GetMessages("")
+	if len(msgs) != 2 || msgs[0].ID != msg.ID || msgs[0].Content != DeletedContent {
+		t.Errorf("Expected the tombstone first in history, got %+v", msgs)
+	}
+	if _, err := store.EditMessage(msg.ID, "alice", "again"); !errors.Is(err, ErrMessageDeleted) {
+		t.Errorf("Expected ErrMessageDeleted, got %v", err)
+	}
+	if _, err := store.ToggleReaction(msg.ID, "bob", "👍"); !errors.Is(err, ErrMessageDeleted) {
+		t.Errorf("Expected ErrMessageDeleted, got %v", err)
+	}
+	if results, _ := store.Search("secret", Query{}); len(results) != 0 {
+		t.Errorf("Expected no search results for deleted content, got %+v", results)
+	}
+	if results, _ := store.Search("deleted", Query{}); len(results) != 0 {
+		t.Errorf("Expected tombstones not to be searchable, got %+v", results)
+	}
+}
+
+func TestEditUpdatesSearchIndex(t *testing.T) {
+	store := NewMessageStore()
+	msg, _ := store.Add(Message{Sender: "alice", Content: "meet at noon"})
+	if results, _ := store.Search("noon", Query{}); len(results) != 1 {
+		t.Fatalf("Expected 1 result before the edit, got %d", len(results))
+	}
+	store.EditMessage(msg.ID, "alice", "meet at midnight")
+	if results, _ := store.Search("noon", Query{}); len(results) != 0 {
+		t.Errorf("Expected no results for the old content, got %d", len(results))
+	}
+	if results, _ := store.Search("midnight", Query{}); len(results) != 1 {
+		t.Errorf("Expected 1 result for the new content, got %d", len(results))
+	}
+}
+
+func TestToggleReaction(t *testing.T) {
+	store := NewMessageStore()
+	msg, _ := store.Add(Message{Sender: "alice", Content: "release is out"})
+
+	for _, emoji := range []string{"", "ok", "👍x", ":)"} {
+		if _, err := store.ToggleReaction(msg.ID, "bob", emoji); !errors.Is(err, ErrInvalidReaction) {
+			t.Errorf("Expected ErrInvalidReaction for %q, got %v", emoji, err)
+		}
+	}
+	store.ToggleReaction(msg.ID, "carol", "🎉")
+	store.ToggleReaction(msg.ID, "bob", "🎉")
+	store.ToggleReaction(msg.ID, "bob", "👍🏽")
+	before, _ := store.ToggleReaction(msg.ID, "dave", "❤️")
+	after, err := store.ToggleReaction(msg.ID, "dave", "❤️")
+	if err != nil {
+		t.Fatalf("ToggleReaction: %v", err)
+	}
+
+	expected := map[string][]string{"🎉": {"bob", "carol"}, "👍🏽": {"bob"}}
+	if !reflect.DeepEqual(after.Reactions, expected) {
+		t.Errorf("Expected reactions %v, got %v", expected, after.Reactions)
+	}
+	if counts := after.ReactionCounts(); counts["🎉"] != 2 || counts["👍🏽"] != 1 || len(counts) != 2 {
+		t.Errorf("Expected counts 🎉:2 👍🏽:1, got %v", counts)
+	}
+	// Earlier results are not changed by later toggles
+	if len(before.Reactions["❤️"]) != 1 {
+		t.Errorf("Expected the earlier result to keep dave's reaction, got %v", before.Reactions)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	store := NewMessageStore()
+	parent, _ := store.Add(Message{Sender: "alice", Content: "lunch?"})
+	store.Add(Message{Sender: "carol", Content: "unrelated"})
+	first, _ := store.Add(Message{Sender: "bob", Content: "yes", ReplyTo: parent.ID})
+	second, _ := store.Add(Message{Sender: "carol", Content: "me too", ReplyTo: parent.ID})
+
+	if _, err := store.Add(Message{Sender: "bob", Content: "?", ReplyTo: 42}); !errors.Is(err, ErrInvalidReply) {
+		t.Errorf("Expected ErrInvalidReply, got %v", err)
+	}
+	page, err := store.Replies(parent.ID, Query{})
+	if err != nil {
+		t.Fatalf("Replies: %v", err)
+	}
+	if got := ids(page.Messages); !equalIDs(got, []int64{first.ID, second.ID}) {
+		t.Errorf("Expected replies %d, %d; got %v", first.ID, second.ID, got)
+	}
+	if _, err := store.Query(Query{ReplyTo: -1}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+}
+
+func TestConcurrentReactions(t *testing.T) {
+	store := NewMessageStore()
+	msg, _ := store.Add(Message{Sender: "alice", Content: "vote"})
+
+	var wg sync.WaitGroup
+	users := []string{"u0", "u1", "u2", "u3", "u4", "u5", "u6", "u7"}
+	for _, user := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// An odd number of toggles leaves the reaction in place
+			for i := 0; i < 21; i++ {
+				store.ToggleReaction(msg.ID, user, "👍")
+				store.GetMessages("")
+			}
+		}()
+	}
+	wg.Wait()
+
+	msgs, _ := store.GetMessages("")
+	if !reflect.DeepEqual(msgs[0].Reactions["👍"], users) {
+		t.Errorf("Expected every user to have reacted, got %v", msgs[0].Reactions)
+	}
+}
+
+func TestBackendUpdates(t *testing.T) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages")
+			store := NewMessageStoreWithBackend(open(t, path))
+			parent, _ := store.Add(Message{Sender: "alice", Content: "first"})
+			reply, _ := store.Add(Message{Sender: "bob", Content: "second", ReplyTo: parent.ID})
+			store.EditMessage(parent.ID, "alice", "first, edited")
+			store.ToggleReaction(parent.ID, "bob", "🔥")
+			store.DeleteMessage(reply.ID, "bob")
+			if err := store.backend.Update(Message{ID: 42}); !errors.Is(err, ErrMessageNotFound) {
+				t.Errorf("Expected ErrMessageNotFound, got %v", err)
+			}
+			expected, _ := store.GetMessages("")
+
+			if name != "memory" {
+				store.Close()
+				store = NewMessageStoreWithBackend(open(t, path))
+			}
+			defer store.Close()
+			got, _ := store.GetMessages("")
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, got)
+			}
+			if len(got) != 2 || got[0].Revisions[0].Content != "first" || got[0].Reactions["🔥"][0] != "bob" ||
+				got[1].ReplyTo != parent.ID || !got[1].Deleted {
+				t.Errorf("Expected the edit, reaction, reply and tombstone to be stored, got %+v", got)
+			}
+		})
+	}
+}
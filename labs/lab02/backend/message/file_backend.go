@@ -0,0 +1,248 @@
+package message
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"shared/fsutil"
+)
+
+// defaultCompactAfter is how many obsolete log records a FileBackend tolerates
+// before compacting, as long as they also outnumber the live messages
+const defaultCompactAfter = 1000
+
+// Log record operations
+const (
+	opAdd          = "add"
+	opUpdate       = "update"
+	opDeleteBefore = "delete_before"
+	opLastID       = "last_id" // Written by compaction, so IDs are not reused after deleting everything
+)
+
+// logRecord is one line of the append-only log
+type logRecord struct {
+	Op      string   `json:"op"`
+	Message *Message `json:"message,omitempty"`
+	ID      int64    `json:"id,omitempty"`
+}
+
+// FileBackend appends every change as a JSON line to a log file and keeps the
+// messages in memory. The log is rewritten with only the live messages once the
+// obsolete records outnumber them, see Compact.
+type FileBackend struct {
+	path         string
+	file         *os.File
+	size         int64 // Offset after the last complete record
+	mem          *MemoryBackend
+	obsolete     int // Records in the log that no longer describe a live message
+	compactAfter int
+}
+
+// NewFileBackend opens the log at path, creating it if it does not exist, and replays it.
+// A partially written last line, left by a crash, is discarded.
+func NewFileBackend(path string) (*FileBackend, error) {
+	b := &FileBackend{path: path, mem: NewMemoryBackend(), compactAfter: defaultCompactAfter}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open message log: %w", err)
+	}
+	good, err := b.replay(file)
+	if err == nil {
+		// Drop a torn last line and continue appending after the last good record
+		if err = file.Truncate(good); err == nil {
+			_, err = file.Seek(good, io.SeekStart)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	b.file = file
+	b.size = good
+	return b, nil
+}
+
+// replay applies the records of the log and returns the offset after the last complete one
+func (b *FileBackend) replay(r io.Reader) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return offset, nil // Incomplete or empty last line
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read message log: %w", err)
+		}
+		var rec logRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return 0, fmt.Errorf("decode message log line %d: %w", line, err)
+		}
+		if err := b.apply(rec); err != nil {
+			return 0, fmt.Errorf("message log line %d: %w", line, err)
+		}
+		offset += int64(len(data))
+	}
+}
+
+// apply changes the in-memory state according to a log record
+func (b *FileBackend) apply(rec logRecord) error {
+	switch rec.Op {
+	case opAdd:
+		if rec.Message == nil {
+			return errors.New("add record without message")
+		}
+		b.mem.messages = append(b.mem.messages, *rec.Message)
+		b.mem.lastID = max(b.mem.lastID, rec.Message.ID)
+	case opUpdate:
+		if rec.Message == nil {
+			return errors.New("update record without message")
+		}
+		if err := b.mem.Update(*rec.Message); err != nil {
+			return err
+		}
+		b.obsolete++ // The previous record of the message
+	case opDeleteBefore:
+		before := len(b.mem.messages)
+		b.mem.DeleteBefore(rec.ID)
+		b.obsolete += before - len(b.mem.messages) + 1
+	case opLastID:
+		b.mem.lastID = max(b.mem.lastID, rec.ID)
+		b.obsolete++
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+	return nil
+}
+
+// Append logs a new message with the next ID
+func (b *FileBackend) Append(msg Message) (Message, error) {
+	msg.ID = b.mem.lastID + 1
+	if err := b.write(logRecord{Op: opAdd, Message: &msg}); err != nil {
+		return Message{}, err
+	}
+	b.mem.Append(msg)
+	return msg, nil
+}
+
+// AppendBatch logs several new messages with one write and one sync
+func (b *FileBackend) AppendBatch(msgs []Message) ([]Message, error) {
+	stored := make([]Message, len(msgs))
+	recs := make([]logRecord, len(msgs))
+	for i, msg := range msgs {
+		msg.ID = b.mem.lastID + int64(i) + 1
+		stored[i] = msg
+		recs[i] = logRecord{Op: opAdd, Message: &stored[i]}
+	}
+	if err := b.write(recs...); err != nil {
+		return nil, err
+	}
+	for _, msg := range stored {
+		b.mem.Append(msg)
+	}
+	return stored, nil
+}
+
+// Get reads from memory
+func (b *FileBackend) Get(id int64) (Message, error) {
+	return b.mem.Get(id)
+}
+
+// Query reads from memory
+func (b *FileBackend) Query(q Query) (Page, error) {
+	return b.mem.Query(q)
+}
+
+// Update logs the new state of a message
+func (b *FileBackend) Update(msg Message) error {
+	if _, err := b.mem.Get(msg.ID); err != nil {
+		return err
+	}
+	if err := b.write(logRecord{Op: opUpdate, Message: &msg}); err != nil {
+		return err
+	}
+	return b.apply(logRecord{Op: opUpdate, Message: &msg})
+}
+
+// DeleteBefore logs the deletion and compacts the log if it is mostly obsolete
+func (b *FileBackend) DeleteBefore(id int64) error {
+	if err := b.write(logRecord{Op: opDeleteBefore, ID: id}); err != nil {
+		return err
+	}
+	return b.apply(logRecord{Op: opDeleteBefore, ID: id})
+}
+
+// LastID returns the last assigned ID
+func (b *FileBackend) LastID() (int64, error) {
+	return b.mem.LastID()
+}
+
+// Close closes the log file
+func (b *FileBackend) Close() error {
+	return b.file.Close()
+}
+
+// write appends records to the log and syncs it, compacting first when due
+func (b *FileBackend) write(recs ...logRecord) error {
+	if b.obsolete >= b.compactAfter && b.obsolete > len(b.mem.messages) {
+		if err := b.Compact(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("encode message log record: %w", err)
+		}
+	}
+	data := buf.Bytes()
+	if _, err := b.file.Write(data); err != nil {
+		b.rewind()
+		return fmt.Errorf("write message log: %w", err)
+	}
+	if err := b.file.Sync(); err != nil {
+		b.rewind()
+		return fmt.Errorf("sync message log: %w", err)
+	}
+	b.size += int64(len(data))
+	return nil
+}
+
+// rewind discards a partially written record, so later records are not appended after it
+func (b *FileBackend) rewind() {
+	if b.file.Truncate(b.size) == nil {
+		b.file.Seek(b.size, io.SeekStart)
+	}
+}
+
+// Compact rewrites the log with only the live messages. The new log replaces the old one
+// atomically, so a crash during compaction leaves the old log intact.
+func (b *FileBackend) Compact() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(logRecord{Op: opLastID, ID: b.mem.lastID}); err != nil {
+		return fmt.Errorf("encode message log record: %w", err)
+	}
+	for i := range b.mem.messages {
+		if err := enc.Encode(logRecord{Op: opAdd, Message: &b.mem.messages[i]}); err != nil {
+			return fmt.Errorf("encode message log record: %w", err)
+		}
+	}
+	// The new log is kept open from before it replaces the old one, so there is no
+	// reopening that could fail and leave writes going to the replaced file
+	file, err := fsutil.ReplaceFile(b.path, buf.Bytes(), 0o644)
+	if err != nil {
+		return fmt.Errorf("compact message log: %w", err)
+	}
+	b.file.Close()
+	b.file = file
+	b.size = int64(buf.Len())
+	b.obsolete = 1 // The last_id header
+	return nil
+}
@@ -3,42 +3,341 @@ package message
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store errors
+var (
+	ErrInvalidQuery    = errors.New("invalid message query")
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidReply    = errors.New("reply to an unknown message")
+	ErrNotAuthor       = errors.New("only the sender can change a message")
+	ErrMessageDeleted  = errors.New("message is deleted")
+	ErrInvalidReaction = errors.New("reaction must be an emoji")
 )
 
 // Message represents a chat message
-// TODO: Add more fields if needed
+// ID is assigned by the store, Timestamp and the other times are Unix nanoseconds.
+// Messages returned by the store must not be modified in place; their maps and slices are shared.
 
 type Message struct {
-	Sender    string
-	Content   string
-	Timestamp int64
+	ID          int64               `json:"id"`
+	Sender      string              `json:"sender"`
+	Content     string              `json:"content"`
+	Timestamp   int64               `json:"timestamp"`
+	ReplyTo     int64               `json:"reply_to,omitempty"`    // ID of the message this one answers
+	EditedAt    int64               `json:"edited_at,omitempty"`   // Time of the last edit
+	Revisions   []Revision          `json:"revisions,omitempty"`   // Previous contents, oldest first
+	Deleted     bool                `json:"deleted,omitempty"`     // Tombstone, Content is DeletedContent
+	Reactions   map[string][]string `json:"reactions,omitempty"`   // Emoji -> sorted IDs of the users who reacted
+	Attachments []Attachment        `json:"attachments,omitempty"` // See AttachmentStore.Upload
+}
+
+// Query selects a page of messages. IDs increase in the order messages were added,
+// so BeforeID and AfterID act as cursors: pass the first ID of a page as BeforeID to
+// page back through history, or the last ID as AfterID to page forward.
+type Query struct {
+	Sender   string // Only messages from this sender; empty for all
+	AfterID  int64  // Only messages with a greater ID; 0 for no bound
+	BeforeID int64  // Only messages with a smaller ID; 0 for no bound
+	Since    int64  // Only messages with Timestamp >= Since; 0 for no bound
+	Until    int64  // Only messages with Timestamp < Until; 0 for no bound
+	ReplyTo  int64  // Only replies to this message; 0 for all
+	Limit    int    // At most this many messages; 0 for no limit
+}
+
+// Page is the result of a Query, ordered by ID
+type Page struct {
+	Messages []Message
+	HasMore  bool // More messages match beyond the limit, in the paging direction
+}
+
+// backward reports whether the query pages back from BeforeID, so the limit keeps
+// the newest matches rather than the oldest
+func (q Query) backward() bool {
+	return q.BeforeID > 0 && q.AfterID == 0
+}
+
+// matches reports whether msg passes every filter of q except the limit
+func (q Query) matches(msg Message) bool {
+	return (q.Sender == "" || msg.Sender == q.Sender) &&
+		(q.AfterID == 0 || msg.ID > q.AfterID) &&
+		(q.BeforeID == 0 || msg.ID < q.BeforeID) &&
+		(q.Since == 0 || msg.Timestamp >= q.Since) &&
+		(q.Until == 0 || msg.Timestamp < q.Until) &&
+		(q.ReplyTo == 0 || msg.ReplyTo == q.ReplyTo)
+}
+
+func (q Query) validate() error {
+	if q.Limit < 0 || q.AfterID < 0 || q.BeforeID < 0 || q.ReplyTo < 0 {
+		return ErrInvalidQuery
+	}
+	if q.AfterID > 0 && q.BeforeID > 0 && q.AfterID >= q.BeforeID {
+		return ErrInvalidQuery
+	}
+	if q.Since > 0 && q.Until > 0 && q.Since >= q.Until {
+		return ErrInvalidQuery
+	}
+	return nil
 }
 
 // MessageStore stores chat messages
-// Contains a slice of messages and a mutex for concurrency
+// Contains a backend for persistence and a mutex for concurrency
+//
+// Concurrent adds are committed in batches: each Add pushes its message onto a lock-free
+// queue, and one of the waiting callers takes the whole queue and stores it under a single
+// hold of the write lock. Writers therefore do not contend for the lock one by one, while
+// IDs stay contiguous and in commit order, as cursors and retention rely on. Backends that
+// implement BatchAppender write each batch at once, paying for one sync per batch.
 
 type MessageStore struct {
-	messages []Message
-	mutex    sync.RWMutex
-	// TODO: Add more fields if needed
+	backend    Backend
+	mutex      sync.RWMutex
+	retention  int                        // Newest messages kept, 0 keeps everything
+	index      *searchIndex               // Built by the first Search, then kept up to date
+	blobs      BlobStore                  // Holds attachment content, see SetBlobStore
+	pending    atomic.Pointer[addRequest] // Adds waiting for a commit, newest first
+	committing atomic.Bool                // A caller is committing a batch, see commit
+}
+
+// addRequest is a message waiting in MessageStore.pending
+type addRequest struct {
+	msg    Message
+	next   *addRequest // Pushed before this one while pending, the next one in a batch
+	result Message
+	err    error
+	done   chan *addRequest // Receives nil once committed, or the first add of the next batch to commit
 }
 
-// NewMessageStore creates a new MessageStore
+// addRequests are reused, so that batching costs no allocations
+var addRequests = sync.Pool{
+	New: func() any { return &addRequest{done: make(chan *addRequest, 1)} },
+}
+
+// NewMessageStore creates a new MessageStore that keeps messages in memory
 func NewMessageStore() *MessageStore {
-	// TODO: Initialize MessageStore fields
-	return &MessageStore{
-		messages: make([]Message, 0, 100),
+	return NewMessageStoreWithBackend(NewMemoryBackend())
+}
+
+// NewMessageStoreWithBackend creates a MessageStore persisting messages in backend
+func NewMessageStoreWithBackend(backend Backend) *MessageStore {
+	return &MessageStore{backend: backend}
+}
+
+// SetRetention keeps only the newest n messages, deleting older ones now and on every add.
+// n <= 0 keeps everything.
+func (s *MessageStore) SetRetention(n int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.retention = max(n, 0)
+	last, err := s.backend.LastID()
+	if err != nil {
+		return err
 	}
+	return s.trim(last)
+}
+
+// SetBlobStore makes Add reject attachments whose blobs are not in blobs.
+// Without a blob store only the format of attachment hashes is checked.
+func (s *MessageStore) SetBlobStore(blobs BlobStore) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.blobs = blobs
 }
 
-// AddMessage stores a new message
+// AddMessage stores a new message, assigning its ID and, if zero, its Timestamp
 func (s *MessageStore) AddMessage(msg Message) error {
-	// TODO: Add message to storage (concurrent safe)
+	_, err := s.Add(msg)
+	return err
+}
+
+// Add stores a new message and returns it with its assigned ID. A reply must refer
+// to a stored message; edits, deletion and reactions go through their own methods.
+func (s *MessageStore) Add(msg Message) (Message, error) {
+	if msg.Timestamp == 0 {
+		msg.Timestamp = time.Now().UnixNano()
+	}
+	msg.EditedAt, msg.Revisions, msg.Deleted, msg.Reactions = 0, nil, false, nil
+	for _, att := range msg.Attachments {
+		if !validHash(att.Hash) || att.Thumbnail != "" && !validHash(att.Thumbnail) {
+			return Message{}, ErrInvalidAttachment
+		}
+	}
+	req := addRequests.Get().(*addRequest)
+	req.msg = msg
+	defer func() {
+		*req = addRequest{done: req.done}
+		addRequests.Put(req)
+	}()
+	for {
+		req.next = s.pending.Load()
+		if s.pending.CompareAndSwap(req.next, req) {
+			break
+		}
+	}
+	if s.committing.CompareAndSwap(false, true) {
+		s.commit(s.take())
+	}
+	for {
+		batch := <-req.done
+		if batch == nil {
+			return req.result, req.err
+		}
+		s.commit(batch)
+	}
+}
+
+// take removes every pending add and returns the first of them, each linked to the
+// next one in the order they were pushed. Only the committer calls it.
+func (s *MessageStore) take() *addRequest {
+	var first *addRequest
+	for req := s.pending.Swap(nil); req != nil; {
+		next := req.next
+		req.next = first
+		first, req = req, next
+	}
+	return first
+}
+
+// commit stores a batch under one hold of the write lock, then hands the committer role
+// to the first caller of the next batch or, when nothing is pending, gives it up. So no
+// caller keeps committing the adds of others for more than one batch.
+func (s *MessageStore) commit(batch *addRequest) {
+	s.mutex.Lock()
+	s.addBatch(batch)
+	s.mutex.Unlock()
+
+	next := s.take()
+	for next == nil {
+		s.committing.Store(false)
+		// An add pushed just before the role was given up found it taken, so look again
+		if s.pending.Load() == nil || !s.committing.CompareAndSwap(false, true) {
+			break
+		}
+		next = s.take()
+	}
+	if next != nil {
+		next.done <- next
+	}
+	for req := batch; req != nil; {
+		following := req.next // req is reused once its caller sees it is done
+		req.done <- nil
+		req = following
+	}
+}
+
+// addBatch stores the messages of a batch, with a single backend write if the backend is
+// a BatchAppender. Callers must hold the write lock.
+func (s *MessageStore) addBatch(batch *addRequest) {
+	appender, ok := s.backend.(BatchAppender)
+	if !ok {
+		for req := batch; req != nil; req = req.next {
+			req.result, req.err = s.add(req.msg)
+		}
+		return
+	}
+
+	var (
+		valid []*addRequest
+		msgs  []Message
+	)
+	for req := batch; req != nil; req = req.next {
+		if req.err = s.check(req.msg); req.err == nil {
+			valid = append(valid, req)
+			msgs = append(msgs, req.msg)
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	stored, err := appender.AppendBatch(msgs)
+	if err == nil {
+		for _, msg := range stored {
+			if s.index != nil {
+				s.index.add(msg)
+			}
+		}
+		err = s.trim(stored[len(stored)-1].ID)
+	}
+	for i, req := range valid {
+		if stored != nil {
+			req.result = stored[i]
+		}
+		req.err = err
+	}
+}
+
+// add stores one message. Callers must hold the write lock.
+func (s *MessageStore) add(msg Message) (Message, error) {
+	if err := s.check(msg); err != nil {
+		return Message{}, err
+	}
+	msg, err := s.backend.Append(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	if s.index != nil {
+		s.index.add(msg)
+	}
+	return msg, s.trim(msg.ID)
+}
+
+// check verifies that the attachments and the message replied to of a new message are
+// stored. Callers must hold the write lock, so CollectBlobs cannot remove a blob between
+// the check and the append.
+func (s *MessageStore) check(msg Message) error {
+	if err := s.checkBlobs(msg.Attachments); err != nil {
+		return err
+	}
+	if msg.ReplyTo != 0 {
+		if _, err := s.backend.Get(msg.ReplyTo); errors.Is(err, ErrMessageNotFound) {
+			return ErrInvalidReply
+		} else if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// GetMessages retrieves messages (optionally by user)
+// trim applies the retention cap given the newest ID; IDs are contiguous, so the
+// messages to keep are exactly those above last-retention
+func (s *MessageStore) trim(last int64) error {
+	if s.retention == 0 || last <= int64(s.retention) {
+		return nil
+	}
+	first := last - int64(s.retention) + 1
+	if err := s.backend.DeleteBefore(first); err != nil {
+		return err
+	}
+	if s.index != nil {
+		s.index.removeBefore(first)
+	}
+	return nil
+}
+
+// GetMessages retrieves messages (all or by sender), ordered by ID
 func (s *MessageStore) GetMessages(user string) ([]Message, error) {
-	// TODO: Retrieve messages (all or by user)
-	return nil, errors.New("not implemented")
+	page, err := s.Query(Query{Sender: user})
+	if err != nil {
+		return nil, err
+	}
+	return page.Messages, nil
+}
+
+// Query returns a page of messages, see Query
+func (s *MessageStore) Query(q Query) (Page, error) {
+	if err := q.validate(); err != nil {
+		return Page{}, err
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.backend.Query(q)
+}
+
+// Close releases the backend
+func (s *MessageStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.backend.Close()
 }
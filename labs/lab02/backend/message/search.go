@@ -0,0 +1,381 @@
+package message
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Markers around highlighted words in SearchResult.Snippet
+const (
+	HighlightStart = "«"
+	HighlightEnd   = "»"
+)
+
+// snippetRadius is how many characters of context a snippet keeps around the first match
+const snippetRadius = 40
+
+// BM25 ranking parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Span is a byte range [Start, End) of a message's Content
+type Span struct {
+	Start, End int
+}
+
+// SearchResult is a message matching a search, with its relevance score
+type SearchResult struct {
+	Message    Message
+	Score      float64
+	Highlights []Span // Matched words in Message.Content
+	Snippet    string // Context around the first match, with matches between HighlightStart and HighlightEnd
+}
+
+// Search finds the messages containing every term of text, ranked by relevance, newest first
+// among equally relevant ones. Words are matched by stem, ignoring case, so "posted" finds
+// "posting"; "quoted phrases" match consecutive words and "prefix*" matches any word starting
+// with the prefix. The filters of q restrict the results, and q.Limit caps their number.
+func (s *MessageStore) Search(text string, q Query) ([]SearchResult, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	clauses := parseSearch(text)
+	if len(clauses) == 0 {
+		return []SearchResult{}, nil
+	}
+	s.mutex.RLock()
+	if s.index == nil {
+		s.mutex.RUnlock()
+		if err := s.buildIndex(); err != nil {
+			return nil, err
+		}
+		s.mutex.RLock()
+	}
+	defer s.mutex.RUnlock()
+	scores := s.index.match(clauses)
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		msg, err := s.backend.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if !q.matches(msg) {
+			continue
+		}
+		highlights := highlight(msg.Content, clauses)
+		results = append(results, SearchResult{
+			Message:    msg,
+			Score:      score,
+			Highlights: highlights,
+			Snippet:    snippet(msg.Content, highlights),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Message.ID > results[j].Message.ID
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results, nil
+}
+
+// buildIndex builds the search index from the backend on first use. Once built, the index
+// is kept up to date by every change and never dropped, so searches only take the read lock.
+func (s *MessageStore) buildIndex() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.index != nil {
+		return nil
+	}
+	page, err := s.backend.Query(Query{})
+	if err != nil {
+		return err
+	}
+	index := newSearchIndex()
+	for _, msg := range page.Messages {
+		index.add(msg)
+	}
+	s.index = index
+	return nil
+}
+
+// clause is one condition of a search, all of which must match
+type clause struct {
+	stems  []string // One stem for a word, several for a phrase
+	prefix string   // Folded prefix for prefix clauses
+}
+
+// parseSearch splits a search into words, "quoted phrases" and prefix* words
+func parseSearch(text string) []clause {
+	var clauses []clause
+	for i, part := range strings.Split(text, `"`) {
+		if i%2 == 1 { // Inside quotes
+			var stems []string
+			for _, tok := range tokenize(part) {
+				stems = append(stems, tok.stem)
+			}
+			if len(stems) > 0 {
+				clauses = append(clauses, clause{stems: stems})
+			}
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			if prefix, ok := strings.CutSuffix(field, "*"); ok {
+				if tokens := tokenize(prefix); len(tokens) == 1 {
+					clauses = append(clauses, clause{prefix: tokens[0].word})
+					continue
+				}
+			}
+			for _, tok := range tokenize(field) {
+				clauses = append(clauses, clause{stems: []string{tok.stem}})
+			}
+		}
+	}
+	return clauses
+}
+
+// searchIndex is an inverted index from stems to the positions they occur at in each message
+type searchIndex struct {
+	postings map[string]map[int64][]int    // stem -> message ID -> word positions
+	words    map[string]map[int64]struct{} // folded word -> message IDs, for prefix clauses
+	docs     map[int64][]token             // message ID -> tokens, to remove the message again
+	oldest   int64                         // No message below this ID is indexed
+	totalLen int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[int64][]int),
+		words:    make(map[string]map[int64]struct{}),
+		docs:     make(map[int64][]token),
+	}
+}
+
+// add indexes a message; deleted messages are not searchable
+func (ix *searchIndex) add(msg Message) {
+	if msg.Deleted {
+		return
+	}
+	tokens := tokenize(msg.Content)
+	if len(ix.docs) == 0 {
+		ix.oldest = msg.ID
+	}
+	ix.docs[msg.ID] = tokens
+	ix.totalLen += len(tokens)
+	for pos, tok := range tokens {
+		if ix.postings[tok.stem] == nil {
+			ix.postings[tok.stem] = make(map[int64][]int)
+		}
+		ix.postings[tok.stem][msg.ID] = append(ix.postings[tok.stem][msg.ID], pos)
+		if ix.words[tok.word] == nil {
+			ix.words[tok.word] = make(map[int64]struct{})
+		}
+		ix.words[tok.word][msg.ID] = struct{}{}
+	}
+}
+
+// remove drops a message from the index
+func (ix *searchIndex) remove(id int64) {
+	tokens, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for _, tok := range tokens {
+		delete(ix.postings[tok.stem], id)
+		if len(ix.postings[tok.stem]) == 0 {
+			delete(ix.postings, tok.stem)
+		}
+		delete(ix.words[tok.word], id)
+		if len(ix.words[tok.word]) == 0 {
+			delete(ix.words, tok.word)
+		}
+	}
+	ix.totalLen -= len(tokens)
+	delete(ix.docs, id)
+}
+
+// removeBefore drops every message with an ID below id; IDs are contiguous,
+// so only the range from the oldest indexed ID needs to be visited
+func (ix *searchIndex) removeBefore(id int64) {
+	for ; ix.oldest < id; ix.oldest++ {
+		ix.remove(ix.oldest)
+	}
+}
+
+// match returns the BM25 score of every message matching all clauses
+func (ix *searchIndex) match(clauses []clause) map[int64]float64 {
+	var scores map[int64]float64
+	for _, c := range clauses {
+		freqs := ix.frequencies(c)
+		next := make(map[int64]float64, len(freqs))
+		idf := ix.idf(len(freqs))
+		for id, tf := range freqs {
+			if scores != nil {
+				if _, ok := scores[id]; !ok {
+					continue
+				}
+			}
+			next[id] = scores[id] + idf*ix.saturate(float64(tf), len(ix.docs[id]))
+		}
+		scores = next
+		if len(scores) == 0 {
+			break
+		}
+	}
+	return scores
+}
+
+// frequencies returns how often a clause occurs in each message containing it
+func (ix *searchIndex) frequencies(c clause) map[int64]int {
+	freqs := make(map[int64]int)
+	if c.prefix != "" {
+		for word, ids := range ix.words {
+			if !strings.HasPrefix(word, c.prefix) {
+				continue
+			}
+			for id := range ids {
+				freqs[id]++
+			}
+		}
+		return freqs
+	}
+
+	// A phrase occurs where each following stem is at the next position
+	for id, starts := range ix.postings[c.stems[0]] {
+		n := 0
+		for _, start := range starts {
+			if ix.phraseAt(id, c.stems[1:], start+1) {
+				n++
+			}
+		}
+		if n > 0 {
+			freqs[id] = n
+		}
+	}
+	return freqs
+}
+
+func (ix *searchIndex) phraseAt(id int64, stems []string, pos int) bool {
+	for i, stem := range stems {
+		positions := ix.postings[stem][id]
+		j := sort.SearchInts(positions, pos+i)
+		if j == len(positions) || positions[j] != pos+i {
+			return false
+		}
+	}
+	return true
+}
+
+// idf is the BM25 inverse document frequency of a clause matching df messages
+func (ix *searchIndex) idf(df int) float64 {
+	n := float64(len(ix.docs))
+	return math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// saturate is the BM25 term frequency component, normalized by message length
+func (ix *searchIndex) saturate(tf float64, length int) float64 {
+	avg := float64(ix.totalLen) / float64(max(len(ix.docs), 1))
+	norm := 1 - bm25B + bm25B*float64(length)/max(avg, 1)
+	return tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+// highlight returns the spans of the words of content that match any clause
+func highlight(content string, clauses []clause) []Span {
+	stems := make(map[string]bool)
+	for _, c := range clauses {
+		for _, s := range c.stems {
+			stems[s] = true
+		}
+	}
+	var spans []Span
+	for _, tok := range tokenize(content) {
+		matched := stems[tok.stem]
+		for _, c := range clauses {
+			if c.prefix != "" && strings.HasPrefix(tok.word, c.prefix) {
+				matched = true
+			}
+		}
+		if matched {
+			spans = append(spans, Span{tok.start, tok.end})
+		}
+	}
+	return spans
+}
+
+// snippet cuts content around the first highlight and marks the highlights in it
+func snippet(content string, highlights []Span) string {
+	if len(highlights) == 0 {
+		return ""
+	}
+	from := backRunes(content, highlights[0].Start, snippetRadius)
+	to := forwardRunes(content, highlights[0].End, snippetRadius)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, h := range highlights {
+		if h.Start < from || h.End > to {
+			continue
+		}
+		b.WriteString(content[pos:h.Start])
+		b.WriteString(HighlightStart)
+		b.WriteString(content[h.Start:h.End])
+		b.WriteString(HighlightEnd)
+		pos = h.End
+	}
+	b.WriteString(content[pos:to])
+	if to < len(content) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// backRunes returns the offset n runes before i, moved forward to the start of a word
+func backRunes(s string, i, n int) int {
+	start := i
+	for ; n > 0 && start > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:start])
+		start -= size
+	}
+	if start == 0 {
+		return 0
+	}
+	// Do not cut a word in half
+	for start < i {
+		r, size := utf8.DecodeRuneInString(s[start:])
+		if !isWordRune(r) {
+			return start + size
+		}
+		start += size
+	}
+	return start
+}
+
+// forwardRunes returns the offset n runes after i, moved back to the end of a word
+func forwardRunes(s string, i, n int) int {
+	end := i
+	for ; n > 0 && end < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	if end == len(s) {
+		return end
+	}
+	for end > i {
+		r, size := utf8.DecodeLastRuneInString(s[:end])
+		if !isWordRune(r) {
+			return end - size
+		}
+		end -= size
+	}
+	return end
+}
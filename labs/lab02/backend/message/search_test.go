@@ -0,0 +1,189 @@
+package message
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text  string
+		words []string
+		stems []string
+	}{
+		{"Running RUNS", []string{"running", "runs"}, []string{"run", "run"}},
+		{"https://example.com/report", []string{"https", "example", "com", "report"}, []string{"https", "exampl", "com", "report"}},
+		{"Ссылки, ссылку!", []string{"ссылки", "ссылку"}, []string{"ссылк", "ссылк"}},
+		{"Ёлка ёлки", []string{"елка", "елки"}, []string{"елк", "елк"}},
+		{"v2 404", []string{"v2", "404"}, []string{"v2", "404"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tokens := tokenize(tt.text)
+			if len(tokens) != len(tt.words) {
+				t.Fatalf("Expected %d tokens, got %+v", len(tt.words), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.word != tt.words[i] || tok.stem != tt.stems[i] {
+					t.Errorf("Token %d: expected %q/%q, got %q/%q", i, tt.words[i], tt.stems[i], tok.word, tok.stem)
+				}
+			}
+		})
+	}
+}
+
+// newSearchFixture stores messages with timestamps 10, 20, ...
+func newSearchFixture(t *testing.T, store *MessageStore) {
+	t.Helper()
+	messages := []Message{
+		{Sender: "alice", Content: "Check out this link: https://example.com/report"},
+		{Sender: "bob", Content: "The report is ready"},
+		{Sender: "alice", Content: "Ссылка на отчёт: https://example.ru/otchet"},
+		{Sender: "bob", Content: "Posting the final reports tomorrow, report report"},
+		{Sender: "carol", Content: "New York is big"},
+		{Sender: "carol", Content: "York, new and old"},
+	}
+	for i, msg := range messages {
+		msg.Timestamp = int64((i + 1) * 10)
+		if err := store.AddMessage(msg); err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+	}
+}
+
+func resultIDs(results []SearchResult) []int64 {
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.Message.ID
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	store := NewMessageStore()
+	newSearchFixture(t, store)
+	tests := []struct {
+		name  string
+		text  string
+		query Query
+		ids   []int64
+	}{
+		{"stemmed word, ranked", "reports", Query{}, []int64{4, 2, 1}},
+		{"several words", "report ready", Query{}, []int64{2}},
+		{"phrase", `"new york"`, Query{}, []int64{5}},
+		{"phrase across punctuation", `"example.com"`, Query{}, []int64{1}},
+		{"prefix", "exam*", Query{}, []int64{3, 1}},
+		{"russian stem", "ссылки", Query{}, []int64{3}},
+		{"folded ё", "отчет", Query{}, []int64{3}},
+		{"case folding", "CHECK", Query{}, []int64{1}},
+		{"sender filter", "report", Query{Sender: "bob"}, []int64{4, 2}},
+		{"time filter", "report", Query{Since: 15, Until: 35}, []int64{2}},
+		{"limit", "report", Query{Limit: 1}, []int64{4}},
+		{"no match", "missing", Query{}, []int64{}},
+		{"empty", "  ", Query{}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Search(tt.text, tt.query)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if got := resultIDs(results); !equalIDs(got, tt.ids) {
+				t.Errorf("Expected IDs %v, got %v", tt.ids, got)
+			}
+		})
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	store := NewMessageStore()
+	store.AddMessage(Message{Sender: "alice", Content: "Links: " + strings.Repeat("filler words here ", 5) +
+		"the deployment link is https://ci.example.com/runs/42 " + strings.Repeat("and more filler ", 5)})
+	results, err := store.Search("link", Query{})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected one result, got %+v (%v)", results, err)
+	}
+	r := results[0]
+	if len(r.Highlights) != 2 {
+		t.Fatalf("Expected 2 highlights, got %v", r.Highlights)
+	}
+	if got := r.Message.Content[r.Highlights[0].Start:r.Highlights[0].End]; got != "Links" {
+		t.Errorf("Expected first highlight %q, got %q", "Links", got)
+	}
+	if !strings.HasPrefix(r.Snippet, "«Links»: filler") || !strings.HasSuffix(r.Snippet, "…") {
+		t.Errorf("Unexpected snippet %q", r.Snippet)
+	}
+
+	results, _ = store.Search("deployment", Query{})
+	expected := "…words here filler words here the «deployment» link is https://ci.example.com/runs/42…"
+	if s := results[0].Snippet; s != expected {
+		t.Errorf("Expected snippet %q, got %q", expected, s)
+	}
+}
+
+func TestSearchIndexFollowsStore(t *testing.T) {
+	store := NewMessageStore()
+	store.AddMessage(Message{Sender: "alice", Content: "first report"})
+	if results, _ := store.Search("report", Query{}); len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	// Messages added after the index was built are found, trimmed ones are not
+	store.AddMessage(Message{Sender: "bob", Content: "second report"})
+	store.SetRetention(1)
+	results, _ := store.Search("report", Query{})
+	if got := resultIDs(results); !equalIDs(got, []int64{2}) {
+		t.Errorf("Expected only ID 2, got %v", got)
+	}
+	store.AddMessage(Message{Sender: "bob", Content: "third report"})
+	results, _ = store.Search("report", Query{})
+	if got := resultIDs(results); !equalIDs(got, []int64{3}) {
+		t.Errorf("Expected only ID 3, got %v", got)
+	}
+}
+
+func TestSearchesShareTheReadLock(t *testing.T) {
+	store := NewMessageStore()
+	newSearchFixture(t, store)
+	store.Search("report", Query{}) // Builds the index
+
+	// Another reader holds the lock, as a concurrent Search or Query would
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	done := make(chan []SearchResult)
+	go func() {
+		results, _ := store.Search("report", Query{})
+		done <- results
+	}()
+	select {
+	case results := <-done:
+		if len(results) != 3 {
+			t.Errorf("Expected 3 results, got %d", len(results))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Search not to wait for the write lock once the index is built")
+	}
+}
+
+func TestSearchPersistentBackends(t *testing.T) {
+	for _, name := range []string{"file", "sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages")
+			store := NewMessageStoreWithBackend(backends[name](t, path))
+			newSearchFixture(t, store)
+			store.Close()
+
+			store = NewMessageStoreWithBackend(backends[name](t, path))
+			defer store.Close()
+			results, err := store.Search(`"final reports"`, Query{})
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if got := resultIDs(results); !equalIDs(got, []int64{4}) {
+				t.Errorf("Expected ID 4, got %v", got)
+			}
+		})
+	}
+}
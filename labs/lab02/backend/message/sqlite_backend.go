@@ -0,0 +1,350 @@
+package message
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const createMessagesTable = `
+CREATE TABLE IF NOT EXISTS messages (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	sender      TEXT    NOT NULL,
+	content     TEXT    NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	reply_to    INTEGER NOT NULL DEFAULT 0,
+	edited_at   INTEGER NOT NULL DEFAULT 0,
+	revisions   TEXT    NOT NULL DEFAULT '[]',
+	deleted     INTEGER NOT NULL DEFAULT 0,
+	reactions   TEXT    NOT NULL DEFAULT '{}',
+	attachments TEXT    NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS messages_sender ON messages (sender, id);
+CREATE INDEX IF NOT EXISTS messages_timestamp ON messages (timestamp)`
+
+// createMessagesIndexes runs after the migration, since it needs the added columns
+const createMessagesIndexes = `
+CREATE INDEX IF NOT EXISTS messages_reply_to ON messages (reply_to, id)`
+
+// messageColumns are added to messages tables created by older versions of the backend
+var messageColumns = []struct{ name, definition string }{
+	{"reply_to", "INTEGER NOT NULL DEFAULT 0"},
+	{"edited_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"revisions", "TEXT NOT NULL DEFAULT '[]'"},
+	{"deleted", "INTEGER NOT NULL DEFAULT 0"},
+	{"reactions", "TEXT NOT NULL DEFAULT '{}'"},
+	{"attachments", "TEXT NOT NULL DEFAULT '[]'"},
+}
+
+// selectMessages lists the columns in the order scanMessage expects them
+const selectMessages = `SELECT id, sender, content, timestamp,
+	reply_to, edited_at, revisions, deleted, reactions, attachments FROM messages`
+
+// SQLiteBackend keeps messages in a SQLite database
+type SQLiteBackend struct {
+	db *sql.DB
+}
+
+// NewSQLiteBackend opens (or creates) the SQLite database at path and prepares the messages table
+func NewSQLiteBackend(path string) (*SQLiteBackend, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open message database: %w", err)
+	}
+	if _, err := db.Exec(createMessagesTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create messages table: %w", err)
+	}
+	if err := migrateMessagesTable(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate messages table: %w", err)
+	}
+	if _, err := db.Exec(createMessagesIndexes); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create messages indexes: %w", err)
+	}
+	return &SQLiteBackend{db: db}, nil
+}
+
+// migrateMessagesTable adds any column from messageColumns that the existing table lacks
+func migrateMessagesTable(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('messages')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range messageColumns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE messages ADD COLUMN ` + col.name + ` ` + col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertMessage is the statement Append and AppendBatch run for every message
+const insertMessage = `INSERT INTO messages (sender, content, timestamp, reply_to, edited_at, revisions, deleted, reactions, attachments)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Append inserts a new message; AUTOINCREMENT guarantees IDs are never reused
+func (b *SQLiteBackend) Append(msg Message) (Message, error) {
+	return insert(b.db, msg)
+}
+
+// AppendBatch inserts several new messages in one transaction
+func (b *SQLiteBackend) AppendBatch(msgs []Message) ([]Message, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("insert messages: %w", err)
+	}
+	defer tx.Rollback() // no-op once committed
+	stored := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		if stored[i], err = insert(tx, msg); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("insert messages: %w", err)
+	}
+	return stored, nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insert runs insertMessage and returns msg with its ID
+func insert(db execer, msg Message) (Message, error) {
+	args, err := messageArgs(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	res, err := db.Exec(insertMessage, args...)
+	if err != nil {
+		return Message{}, fmt.Errorf("insert message: %w", err)
+	}
+	if msg.ID, err = res.LastInsertId(); err != nil {
+		return Message{}, fmt.Errorf("insert message: %w", err)
+	}
+	return msg, nil
+}
+
+// Get retrieves a message by ID, returns ErrMessageNotFound if there is none
+func (b *SQLiteBackend) Get(id int64) (Message, error) {
+	msg, err := scanMessage(b.db.QueryRow(selectMessages+` WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("get message: %w", err)
+	}
+	return msg, nil
+}
+
+// Query translates q into SQL, reading one extra row to tell whether more messages match
+func (b *SQLiteBackend) Query(q Query) (Page, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+	if q.Sender != "" {
+		add("sender = ?", q.Sender)
+	}
+	if q.AfterID > 0 {
+		add("id > ?", q.AfterID)
+	}
+	if q.BeforeID > 0 {
+		add("id < ?", q.BeforeID)
+	}
+	if q.Since > 0 {
+		add("timestamp >= ?", q.Since)
+	}
+	if q.Until > 0 {
+		add("timestamp < ?", q.Until)
+	}
+	if q.ReplyTo > 0 {
+		add("reply_to = ?", q.ReplyTo)
+	}
+
+	query := selectMessages
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if q.backward() {
+		query += " ORDER BY id DESC"
+	} else {
+		query += " ORDER BY id"
+	}
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return Page{}, fmt.Errorf("query messages: %w", err)
+	}
+	defer rows.Close()
+	page := Page{Messages: []Message{}}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return Page{}, fmt.Errorf("query messages: %w", err)
+		}
+		page.Messages = append(page.Messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, fmt.Errorf("query messages: %w", err)
+	}
+
+	if q.Limit > 0 && len(page.Messages) > q.Limit {
+		page.Messages = page.Messages[:q.Limit]
+		page.HasMore = true
+	}
+	if q.backward() {
+		slices.Reverse(page.Messages)
+	}
+	return page, nil
+}
+
+// Update replaces the stored columns of the message with msg.ID
+func (b *SQLiteBackend) Update(msg Message) error {
+	args, err := messageArgs(msg)
+	if err != nil {
+		return err
+	}
+	res, err := b.db.Exec(
+		`UPDATE messages SET sender = ?, content = ?, timestamp = ?,
+			reply_to = ?, edited_at = ?, revisions = ?, deleted = ?, reactions = ?, attachments = ?
+		WHERE id = ?`,
+		append(args, msg.ID)...,
+	)
+	if err != nil {
+		return fmt.Errorf("update message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update message: %w", err)
+	}
+	if n == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// DeleteBefore removes the messages with smaller IDs
+func (b *SQLiteBackend) DeleteBefore(id int64) error {
+	if _, err := b.db.Exec(`DELETE FROM messages WHERE id < ?`, id); err != nil {
+		return fmt.Errorf("delete messages: %w", err)
+	}
+	return nil
+}
+
+// LastID reads the AUTOINCREMENT counter, which survives deleting every row
+func (b *SQLiteBackend) LastID() (int64, error) {
+	var id int64
+	err := b.db.QueryRow(`SELECT seq FROM sqlite_sequence WHERE name = 'messages'`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read last message ID: %w", err)
+	}
+	return id, nil
+}
+
+// Close closes the database connection
+func (b *SQLiteBackend) Close() error {
+	return b.db.Close()
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(sc scanner) (Message, error) {
+	var (
+		msg                               Message
+		revisions, reactions, attachments string
+	)
+	err := sc.Scan(&msg.ID, &msg.Sender, &msg.Content, &msg.Timestamp,
+		&msg.ReplyTo, &msg.EditedAt, &revisions, &msg.Deleted, &reactions, &attachments)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := json.Unmarshal([]byte(revisions), &msg.Revisions); err != nil {
+		return Message{}, fmt.Errorf("parse revisions: %w", err)
+	}
+	if len(msg.Revisions) == 0 {
+		msg.Revisions = nil
+	}
+	if err := json.Unmarshal([]byte(reactions), &msg.Reactions); err != nil {
+		return Message{}, fmt.Errorf("parse reactions: %w", err)
+	}
+	if len(msg.Reactions) == 0 {
+		msg.Reactions = nil
+	}
+	if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+		return Message{}, fmt.Errorf("parse attachments: %w", err)
+	}
+	if len(msg.Attachments) == 0 {
+		msg.Attachments = nil
+	}
+	return msg, nil
+}
+
+// messageArgs returns the column values of msg in the order used by Append and Update
+func messageArgs(msg Message) ([]any, error) {
+	revisions, err := json.Marshal(msg.Revisions)
+	if err != nil {
+		return nil, fmt.Errorf("encode revisions: %w", err)
+	}
+	if msg.Revisions == nil {
+		revisions = []byte("[]")
+	}
+	reactions, err := json.Marshal(msg.Reactions)
+	if err != nil {
+		return nil, fmt.Errorf("encode reactions: %w", err)
+	}
+	if msg.Reactions == nil {
+		reactions = []byte("{}")
+	}
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return nil, fmt.Errorf("encode attachments: %w", err)
+	}
+	if msg.Attachments == nil {
+		attachments = []byte("[]")
+	}
+	return []any{
+		msg.Sender, msg.Content, msg.Timestamp,
+		msg.ReplyTo, msg.EditedAt, string(revisions), msg.Deleted, string(reactions), string(attachments),
+	}, nil
+}
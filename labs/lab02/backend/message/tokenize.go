@@ -0,0 +1,75 @@
+package message
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/kljensen/snowball/russian"
+)
+
+// token is a word of a message: letters and digits between any other characters
+type token struct {
+	word       string // Case folded
+	stem       string // Stemmed word, see stem
+	start, end int    // Byte offsets in the original text
+}
+
+// tokenize splits text into case folded, stemmed words. Punctuation separates words,
+// so "example.com/page" yields "example", "com" and "page".
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	word := fold(text[start:end])
+	return token{word: word, stem: stem(word), start: start, end: end}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// fold lowercases a word and treats ё as е, as Russian text often omits the diaeresis
+func fold(word string) string {
+	return strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+}
+
+// stem reduces a folded word to its Snowball stem: Russian for Cyrillic words, English for
+// ASCII letters. Other words, including numbers and mixed scripts, are kept as they are.
+func stem(word string) string {
+	cyrillic, ascii := true, true
+	for _, r := range word {
+		if !unicode.Is(unicode.Cyrillic, r) {
+			cyrillic = false
+		}
+		if r >= utf8.RuneSelf || !unicode.IsLetter(r) {
+			ascii = false
+		}
+	}
+	switch {
+	case cyrillic:
+		return russian.Stem(word, true)
+	case ascii:
+		return english.Stem(word, true)
+	}
+	return word
+}
@@ -1,9 +1,29 @@
 package user
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+
+	"shared/email"
+)
+
+// Validation errors
+var (
+	ErrEmptyName    = errors.New("name is required")
+	ErrInvalidEmail = errors.New("invalid email")
+	ErrEmptyID      = errors.New("id is required")
+)
+
+// UserManager errors
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrDuplicateID    = errors.New("user already exists")
+	ErrDuplicateEmail = errors.New("email is already in use")
 )
 
 // User represents a chat user
@@ -15,53 +35,362 @@ type User struct {
 	ID    string
 }
 
-// Validate checks if the user data is valid
+// Validate checks if the user data is valid: name and id must be set and
+// email must be an RFC 5322 / RFC 6531 address
 func (u *User) Validate() error {
-	// TODO: Validate name, email, id
+	if strings.TrimSpace(u.Name) == "" {
+		return ErrEmptyName
+	}
+	if _, err := email.Parse(u.Email); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	if u.ID == "" {
+		return ErrEmptyID
+	}
 	return nil
 }
 
+// UserPatch describes a partial update of a user; nil fields are left unchanged
+type UserPatch struct {
+	Name  *string
+	Email *string
+}
+
 // UserManager manages users
-// Contains a map of users, a mutex, and a context
+// Contains a map of users, an email index, a mutex, a context and the subscribed hooks
 
 type UserManager struct {
-	ctx   context.Context
-	users map[string]User // userID -> User
-	mutex sync.RWMutex    // Protects users map
-	// TODO: Add more fields if needed
+	ctx    context.Context
+	users  map[string]User   // userID -> User
+	emails map[string]string // email key -> userID, see email.Address.Key
+	mutex  sync.RWMutex      // Protects users, emails, hooks, nextID and nextSeq
+	writer chan struct{}     // Holds a token while a change is in progress, see lock
+	hooks  []hook
+	nextID int // Identifies the next hook, for unsubscribing
+
+	// Every change takes a sequence number under mutex and runs its hooks once the
+	// hooks of the previous change are done, so hooks see changes in order
+	nextSeq uint64
+	notify  sync.Mutex // Protects turn
+	turn    uint64     // Sequence number of the change whose hooks run next
+	turned  *sync.Cond // Broadcast when turn advances
+}
+
+// hook holds the callbacks of one subscription; only one of them is set
+type hook struct {
+	id      int
+	added   func(User)
+	removed func(User)
+	updated func(old, updated User)
 }
 
 // NewUserManager creates a new UserManager
 func NewUserManager() *UserManager {
-	// TODO: Initialize UserManager fields
-	return &UserManager{
-		users: make(map[string]User),
-	}
+	return NewUserManagerWithContext(context.Background())
 }
 
-// NewUserManagerWithContext creates a new UserManager with context
+// NewUserManagerWithContext creates a new UserManager whose operations fail once ctx is done
 func NewUserManagerWithContext(ctx context.Context) *UserManager {
-	// TODO: Initialize UserManager with context
-	return &UserManager{
-		ctx:   ctx,
-		users: make(map[string]User),
+	m := &UserManager{
+		ctx:    ctx,
+		users:  make(map[string]User),
+		emails: make(map[string]string),
+		writer: make(chan struct{}, 1),
 	}
+	m.turned = sync.NewCond(&m.notify)
+	return m
 }
 
-// AddUser adds a user
+// AddUser validates and adds a user. IDs and emails must be unique; emails are
+// compared case-insensitively.
 func (m *UserManager) AddUser(u User) error {
-	// TODO: Add user to map, check context
+	return m.AddUserContext(context.Background(), u)
+}
+
+// AddUserContext is AddUser that fails with ctx.Err() once ctx is done
+func (m *UserManager) AddUserContext(ctx context.Context, u User) error {
+	if err := m.ctxErr(ctx); err != nil {
+		return err
+	}
+	if err := u.Validate(); err != nil {
+		return err
+	}
+	key := emailKey(u.Email)
+
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	if _, ok := m.users[u.ID]; ok {
+		m.unlock()
+		return ErrDuplicateID
+	}
+	if _, ok := m.emails[key]; ok {
+		m.unlock()
+		return ErrDuplicateEmail
+	}
+	m.users[u.ID] = u
+	m.emails[key] = u.ID
+	m.notifyUnlock(func(h hook) {
+		if h.added != nil {
+			h.added(u)
+		}
+	})
+	return nil
+}
+
+// AddUsers adds all users or, if any of them is invalid, a duplicate or ctx is done, none.
+// The error names the first user that was rejected.
+func (m *UserManager) AddUsers(ctx context.Context, users []User) error {
+	if err := m.ctxErr(ctx); err != nil {
+		return err
+	}
+	keys := make([]string, len(users))
+	for i, u := range users {
+		if err := u.Validate(); err != nil {
+			return fmt.Errorf("user %d (%s): %w", i, u.ID, err)
+		}
+		keys[i] = emailKey(u.Email)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(users))
+	emails := make(map[string]bool, len(users))
+	for i, u := range users {
+		var err error
+		if _, ok := m.users[u.ID]; ok || ids[u.ID] {
+			err = ErrDuplicateID
+		} else if _, ok := m.emails[keys[i]]; ok || emails[keys[i]] {
+			err = ErrDuplicateEmail
+		}
+		if err != nil {
+			m.unlock()
+			return fmt.Errorf("user %d (%s): %w", i, u.ID, err)
+		}
+		ids[u.ID] = true
+		emails[keys[i]] = true
+	}
+	for i, u := range users {
+		m.users[u.ID] = u
+		m.emails[keys[i]] = u.ID
+	}
+	m.notifyUnlock(func(h hook) {
+		if h.added == nil {
+			return
+		}
+		for _, u := range users {
+			h.added(u)
+		}
+	})
 	return nil
 }
 
 // RemoveUser removes a user
 func (m *UserManager) RemoveUser(id string) error {
-	// TODO: Remove user from map
+	return m.RemoveUserContext(context.Background(), id)
+}
+
+// RemoveUserContext is RemoveUser that fails with ctx.Err() once ctx is done
+func (m *UserManager) RemoveUserContext(ctx context.Context, id string) error {
+	if err := m.ctxErr(ctx); err != nil {
+		return err
+	}
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	u, ok := m.users[id]
+	if !ok {
+		m.unlock()
+		return ErrUserNotFound
+	}
+	delete(m.users, id)
+	delete(m.emails, emailKey(u.Email))
+	m.notifyUnlock(func(h hook) {
+		if h.removed != nil {
+			h.removed(u)
+		}
+	})
 	return nil
 }
 
 // GetUser retrieves a user by id
 func (m *UserManager) GetUser(id string) (User, error) {
-	// TODO: Get user from map
-	return User{}, errors.New("not found")
+	return m.GetUserContext(context.Background(), id)
+}
+
+// GetUserContext is GetUser that fails with ctx.Err() once ctx is done
+func (m *UserManager) GetUserContext(ctx context.Context, id string) (User, error) {
+	if err := m.ctxErr(ctx); err != nil {
+		return User{}, err
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if err := m.ctxErr(ctx); err != nil {
+		return User{}, err
+	}
+	u, ok := m.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// UpdateUser applies a patch to a user and returns the updated user
+func (m *UserManager) UpdateUser(id string, patch UserPatch) (User, error) {
+	return m.UpdateUserContext(context.Background(), id, patch)
+}
+
+// UpdateUserContext is UpdateUser that fails with ctx.Err() once ctx is done
+func (m *UserManager) UpdateUserContext(ctx context.Context, id string, patch UserPatch) (User, error) {
+	if err := m.ctxErr(ctx); err != nil {
+		return User{}, err
+	}
+	if err := m.lock(ctx); err != nil {
+		return User{}, err
+	}
+	old, ok := m.users[id]
+	if !ok {
+		m.unlock()
+		return User{}, ErrUserNotFound
+	}
+	u := old
+	if patch.Name != nil {
+		u.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		u.Email = *patch.Email
+	}
+	if err := u.Validate(); err != nil {
+		m.unlock()
+		return User{}, err
+	}
+	oldKey, key := emailKey(old.Email), emailKey(u.Email)
+	if owner, ok := m.emails[key]; ok && owner != id {
+		m.unlock()
+		return User{}, ErrDuplicateEmail
+	}
+	delete(m.emails, oldKey)
+	m.emails[key] = id
+	m.users[id] = u
+	m.notifyUnlock(func(h hook) {
+		if h.updated != nil {
+			h.updated(old, u)
+		}
+	})
+	return u, nil
+}
+
+// ctxErr returns the error of the call's context or, failing that, of the manager's
+func (m *UserManager) ctxErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.ctx.Err()
+}
+
+// lock takes the write lock unless a context is done first, so that an operation whose deadline
+// passes while another change is in progress gives up waiting and changes nothing. Changes wait
+// for each other on the writer token; mutex itself is only held while the maps are read or written.
+func (m *UserManager) lock(ctx context.Context) error {
+	select {
+	case m.writer <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.ctx.Done():
+		return m.ctx.Err()
+	}
+	m.mutex.Lock()
+	if err := m.ctxErr(ctx); err != nil {
+		m.unlock()
+		return err
+	}
+	return nil
+}
+
+// unlock releases the write lock taken by lock
+func (m *UserManager) unlock() {
+	m.mutex.Unlock()
+	<-m.writer
+}
+
+// ListUsers returns the users whose name starts with prefix, ignoring case,
+// ordered by name and then ID. An empty prefix lists every user.
+func (m *UserManager) ListUsers(prefix string) []User {
+	prefix = strings.ToLower(prefix)
+	m.mutex.RLock()
+	result := []User{}
+	for _, u := range m.users {
+		if strings.HasPrefix(strings.ToLower(u.Name), prefix) {
+			result = append(result, u)
+		}
+	}
+	m.mutex.RUnlock()
+	slices.SortFunc(result, func(a, b User) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.ID, b.ID))
+	})
+	return result
+}
+
+// OnUserAdded calls fn with every user added from now on, until the returned function is called
+func (m *UserManager) OnUserAdded(fn func(User)) (unsubscribe func()) {
+	return m.subscribe(hook{added: fn})
+}
+
+// OnUserRemoved calls fn with every user removed from now on, until the returned function is called
+func (m *UserManager) OnUserRemoved(fn func(User)) (unsubscribe func()) {
+	return m.subscribe(hook{removed: fn})
+}
+
+// OnUserUpdated calls fn with the old and new state of every user updated from now on,
+// until the returned function is called
+func (m *UserManager) OnUserUpdated(fn func(old, updated User)) (unsubscribe func()) {
+	return m.subscribe(hook{updated: fn})
+}
+
+// subscribe registers a hook. Hooks run synchronously in the goroutine that made the change,
+// one change at a time and in the order of the changes; they may read the manager but must
+// not change it.
+func (m *UserManager) subscribe(h hook) func() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nextID++
+	h.id = m.nextID
+	m.hooks = append(m.hooks, h)
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		// Copy, a change in progress may still be running the old hooks
+		m.hooks = slices.DeleteFunc(slices.Clone(m.hooks), func(other hook) bool { return other.id == h.id })
+	}
+}
+
+// notifyUnlock releases the write lock held by the caller and runs call for every hook
+// once the hooks of earlier changes have run. The lock is released first, so hooks
+// can read the manager while other changes wait for their turn.
+func (m *UserManager) notifyUnlock(call func(h hook)) {
+	hooks, seq := m.hooks, m.nextSeq
+	m.nextSeq++
+	m.unlock()
+
+	m.notify.Lock()
+	for m.turn != seq {
+		m.turned.Wait()
+	}
+	m.notify.Unlock()
+	defer func() {
+		m.notify.Lock()
+		m.turn++
+		m.turned.Broadcast()
+		m.notify.Unlock()
+	}()
+	for _, h := range hooks {
+		call(h)
+	}
+}
+
+// emailKey returns the case-insensitive form of an already validated address
+func emailKey(s string) string {
+	addr, _ := email.Parse(s)
+	return addr.Key()
 }
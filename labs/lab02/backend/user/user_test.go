@@ -2,7 +2,14 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestUserValidation(t *testing.T) {
@@ -56,3 +63,370 @@ func TestUserContextCancellation(t *testing.T) {
 		t.Error("expected error after context cancel, got nil")
 	}
 }
+
+func newTestManager(t *testing.T, users ...User) *UserManager {
+	t.Helper()
+	mgr := NewUserManager()
+	for _, u := range users {
+		if err := mgr.AddUser(u); err != nil {
+			t.Fatalf("AddUser %s failed: %v", u.ID, err)
+		}
+	}
+	return mgr
+}
+
+func TestUserUniqueness(t *testing.T) {
+	mgr := newTestManager(t, User{Name: "Alice", Email: "Alice@Example.com", ID: "alice"})
+	tests := []struct {
+		name string
+		user User
+		err  error
+	}{
+		{"same id", User{Name: "Other", Email: "other@example.com", ID: "alice"}, ErrDuplicateID},
+		{"same email", User{Name: "Other", Email: "Alice@Example.com", ID: "other"}, ErrDuplicateEmail},
+		{"email in other case", User{Name: "Other", Email: "aLiCe@EXAMPLE.COM", ID: "other"}, ErrDuplicateEmail},
+		{"different email", User{Name: "Other", Email: "alice+chat@example.com", ID: "other"}, nil},
+		{"invalid", User{Name: "", Email: "x@example.com", ID: "x"}, ErrEmptyName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := mgr.AddUser(tt.user); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// A removed user's email becomes available again
+	if err := mgr.RemoveUser("alice"); err != nil {
+		t.Fatalf("RemoveUser failed: %v", err)
+	}
+	if err := mgr.AddUser(User{Name: "New Alice", Email: "alice@example.com", ID: "alice2"}); err != nil {
+		t.Errorf("Expected the email to be free after removal, got %v", err)
+	}
+	if err := mgr.RemoveUser("alice"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	mgr := newTestManager(t,
+		User{Name: "Alice", Email: "alice@example.com", ID: "alice"},
+		User{Name: "Bob", Email: "bob@example.com", ID: "bob"},
+	)
+	name, taken, fresh, invalid := "Alice Smith", "BOB@example.com", "alice.smith@example.com", "nope"
+
+	updated, err := mgr.UpdateUser("alice", UserPatch{Name: &name})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if updated.Name != name || updated.Email != "alice@example.com" {
+		t.Errorf("Expected only the name to change, got %+v", updated)
+	}
+	if _, err := mgr.UpdateUser("alice", UserPatch{Email: &taken}); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+	if _, err := mgr.UpdateUser("alice", UserPatch{Email: &invalid}); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Expected ErrInvalidEmail, got %v", err)
+	}
+	if _, err := mgr.UpdateUser("carol", UserPatch{Name: &name}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := mgr.UpdateUser("alice", UserPatch{Email: &fresh}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	// The old email is released, changing only its case is not a conflict
+	if err := mgr.AddUser(User{Name: "Other", Email: "alice@example.com", ID: "other"}); err != nil {
+		t.Errorf("Expected the old email to be free, got %v", err)
+	}
+	upper := "ALICE.SMITH@example.com"
+	if _, err := mgr.UpdateUser("alice", UserPatch{Email: &upper}); err != nil {
+		t.Errorf("Expected a case change of the own email to succeed, got %v", err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	mgr := newTestManager(t,
+		User{Name: "bob", Email: "bob@example.com", ID: "b"},
+		User{Name: "Alice", Email: "alice@example.com", ID: "a2"},
+		User{Name: "alice", Email: "alice2@example.com", ID: "a1"},
+		User{Name: "Alfred", Email: "alfred@example.com", ID: "f"},
+		User{Name: "Борис", Email: "boris@example.com", ID: "r"},
+	)
+	tests := []struct {
+		prefix string
+		ids    []string
+	}{
+		{"", []string{"f", "a1", "a2", "b", "r"}},
+		{"al", []string{"f", "a1", "a2"}},
+		{"ALI", []string{"a1", "a2"}},
+		{"бор", []string{"r"}},
+		{"z", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			users := mgr.ListUsers(tt.prefix)
+			ids := make([]string, len(users))
+			for i, u := range users {
+				ids[i] = u.ID
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("Expected %v, got %v", tt.ids, ids)
+			}
+		})
+	}
+}
+
+func TestUserHooks(t *testing.T) {
+	mgr := NewUserManager()
+	var events []string
+	stop := mgr.OnUserAdded(func(u User) { events = append(events, "added "+u.ID) })
+	mgr.OnUserRemoved(func(u User) {
+		// Hooks may read the manager, the user is already gone
+		_, err := mgr.GetUser(u.ID)
+		events = append(events, fmt.Sprintf("removed %s %v", u.ID, errors.Is(err, ErrUserNotFound)))
+	})
+	mgr.OnUserUpdated(func(old, updated User) { events = append(events, "updated "+old.Name+" -> "+updated.Name) })
+
+	mgr.AddUser(User{Name: "Alice", Email: "alice@example.com", ID: "alice"})
+	mgr.AddUser(User{Name: "Alice", Email: "alice@example.com", ID: "dup"}) // Rejected, no event
+	name := "Alicia"
+	mgr.UpdateUser("alice", UserPatch{Name: &name})
+	mgr.RemoveUser("alice")
+	stop()
+	mgr.AddUser(User{Name: "Bob", Email: "bob@example.com", ID: "bob"})
+
+	expected := []string{"added alice", "updated Alice -> Alicia", "removed alice true"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("Expected %v, got %v", expected, events)
+	}
+}
+
+func TestUserHooksOrderUnderConcurrency(t *testing.T) {
+	mgr := NewUserManager()
+	var (
+		mutex  sync.Mutex
+		online = make(map[string]bool)
+		errs   []string
+	)
+	mgr.OnUserAdded(func(u User) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if online[u.ID] {
+			errs = append(errs, "added twice "+u.ID)
+		}
+		online[u.ID] = true
+	})
+	mgr.OnUserRemoved(func(u User) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !online[u.ID] {
+			errs = append(errs, "removed before added "+u.ID)
+		}
+		delete(online, u.ID)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("u%d", i%5) // Several goroutines fight over each ID
+			for j := 0; j < 50; j++ {
+				if mgr.AddUser(User{Name: "User", Email: id + "@example.com", ID: id}) == nil {
+					mgr.RemoveUser(id)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(errs) > 0 || len(online) != 0 {
+		t.Errorf("Expected hooks in change order, got errors %v and %d users left", errs, len(online))
+	}
+}
+
+func TestHooksReadDuringConcurrentWrites(t *testing.T) {
+	mgr := NewUserManager()
+	var found atomic.Int64
+	var wg sync.WaitGroup
+	mgr.OnUserAdded(func(u User) {
+		if u.ID == "first" {
+			// Give another writer time to take the lock while this hook runs
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mgr.AddUser(User{Name: "Second", Email: "second@example.com", ID: "second"})
+			}()
+			time.Sleep(50 * time.Millisecond)
+		}
+		if _, err := mgr.GetUser(u.ID); err == nil {
+			found.Add(1)
+		}
+		mgr.ListUsers("")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mgr.AddUser(User{Name: "First", Email: "first@example.com", ID: "first"})
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					id := fmt.Sprintf("u%d-%d", i, j)
+					mgr.AddUser(User{Name: "User", Email: id + "@example.com", ID: id})
+				}
+			}(i)
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected concurrent writers with a reading hook to finish, they deadlocked")
+	}
+	if found.Load() != 402 {
+		t.Errorf("Expected every hook to find its user, got %d", found.Load())
+	}
+}
+
+func TestContextOperations(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	stopped, stop := context.WithCancel(context.Background())
+
+	alice := User{Name: "Alice", Email: "alice@example.com", ID: "alice"}
+	bob := User{Name: "Bob", Email: "bob@example.com", ID: "bob"}
+	mgr := newTestManager(t, alice)
+	stoppedMgr := NewUserManagerWithContext(stopped)
+	stop()
+
+	tests := []struct {
+		name string
+		call func() error
+		err  error
+	}{
+		{"add canceled", func() error { return mgr.AddUserContext(canceled, bob) }, context.Canceled},
+		{"add expired", func() error { return mgr.AddUserContext(expired, bob) }, context.DeadlineExceeded},
+		{"add manager stopped", func() error { return stoppedMgr.AddUserContext(context.Background(), bob) }, context.Canceled},
+		{"remove canceled", func() error { return mgr.RemoveUserContext(canceled, "alice") }, context.Canceled},
+		{"remove expired", func() error { return mgr.RemoveUserContext(expired, "alice") }, context.DeadlineExceeded},
+		{"get canceled", func() error { _, err := mgr.GetUserContext(canceled, "alice"); return err }, context.Canceled},
+		{"get expired", func() error { _, err := mgr.GetUserContext(expired, "alice"); return err }, context.DeadlineExceeded},
+		{"update expired", func() error {
+			_, err := mgr.UpdateUserContext(expired, "alice", UserPatch{})
+			return err
+		}, context.DeadlineExceeded},
+		{"add users canceled", func() error { return mgr.AddUsers(canceled, []User{bob}) }, context.Canceled},
+		{"get", func() error { _, err := mgr.GetUserContext(context.Background(), "alice"); return err }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+	if users := mgr.ListUsers(""); len(users) != 1 || users[0].ID != "alice" {
+		t.Errorf("Expected failed calls to change nothing, got %+v", users)
+	}
+}
+
+func TestDeadlineWhileWaitingForLock(t *testing.T) {
+	mgr := NewUserManager()
+	if err := mgr.lock(context.Background()); err != nil { // Held by a slow operation
+		t.Fatalf("lock failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- mgr.AddUserContext(ctx, User{Name: "Bob", Email: "bob@example.com", ID: "bob"})
+	}()
+
+	// The waiting caller gives up at its deadline, without the lock being released
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected AddUserContext to return at its deadline while the lock is held")
+	}
+	mgr.unlock()
+	if _, err := mgr.GetUser("bob"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected the user not added after the deadline, got %v", err)
+	}
+}
+
+func TestCancelWhileWaitingForLock(t *testing.T) {
+	mgr := newTestManager(t, User{Name: "Alice", Email: "alice@example.com", ID: "alice"})
+	if err := mgr.lock(context.Background()); err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- mgr.RemoveUserContext(ctx, "alice")
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected RemoveUserContext to return once canceled while the lock is held")
+	}
+	mgr.unlock()
+	if _, err := mgr.GetUser("alice"); err != nil {
+		t.Errorf("Expected alice kept, got %v", err)
+	}
+}
+
+func TestAddUsersAllOrNothing(t *testing.T) {
+	existing := User{Name: "Alice", Email: "alice@example.com", ID: "alice"}
+	bob := User{Name: "Bob", Email: "bob@example.com", ID: "bob"}
+	carol := User{Name: "Carol", Email: "carol@example.com", ID: "carol"}
+	tests := []struct {
+		name  string
+		users []User
+		err   error
+	}{
+		{"invalid", []User{bob, {Name: "", Email: "x@example.com", ID: "x"}}, ErrEmptyName},
+		{"existing id", []User{bob, {Name: "A", Email: "a@example.com", ID: "alice"}}, ErrDuplicateID},
+		{"existing email", []User{bob, {Name: "A", Email: "ALICE@example.com", ID: "a"}}, ErrDuplicateEmail},
+		{"id twice in batch", []User{bob, {Name: "B", Email: "b@example.com", ID: "bob"}}, ErrDuplicateID},
+		{"email twice in batch", []User{bob, {Name: "B", Email: "Bob@Example.com", ID: "b"}}, ErrDuplicateEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := newTestManager(t, existing)
+			added := 0
+			mgr.OnUserAdded(func(User) { added++ })
+			err := mgr.AddUsers(context.Background(), tt.users)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if !strings.Contains(err.Error(), "user 1") {
+				t.Errorf("Expected the error to name the second user, got %v", err)
+			}
+			if users := mgr.ListUsers(""); len(users) != 1 || added != 0 {
+				t.Errorf("Expected nothing added, got %d users and %d events", len(users), added)
+			}
+		})
+	}
+
+	mgr := newTestManager(t, existing)
+	var events []string
+	mgr.OnUserAdded(func(u User) { events = append(events, u.ID) })
+	if err := mgr.AddUsers(context.Background(), []User{bob, carol}); err != nil {
+		t.Fatalf("AddUsers failed: %v", err)
+	}
+	if len(mgr.ListUsers("")) != 3 || !slices.Equal(events, []string{"bob", "carol"}) {
+		t.Errorf("Expected bob and carol added in order, got events %v", events)
+	}
+}
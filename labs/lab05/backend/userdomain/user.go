@@ -2,9 +2,10 @@ package userdomain
 
 import (
 	"errors"
-	_ "regexp"
 	"strings"
 	"time"
+
+	"shared/email"
 )
 
 // User represents a user entity in the domain
@@ -38,13 +39,21 @@ func (u *User) Validate() error {
 	return errors.New("not implemented")
 }
 
-// TODO: Implement ValidateEmail function
-// ValidateEmail checks if email format is valid
-func ValidateEmail(email string) error {
-	// TODO: Implement email validation
-	// Use regex pattern to validate email format
-	// Email should not be empty and should match standard email pattern
-	return errors.New("not implemented")
+// ValidateEmail checks if email format is valid according to RFC 5322 and RFC 6531,
+// ignoring surrounding whitespace
+func ValidateEmail(address string) error {
+	_, err := email.Parse(strings.TrimSpace(address))
+	return err
+}
+
+// NormalizeEmail returns the canonical form of an address: trimmed, lowercased and with
+// an ASCII (punycode) domain, returns an error if the address is not valid
+func NormalizeEmail(address string) (string, error) {
+	addr, err := email.Parse(strings.TrimSpace(address))
+	if err != nil {
+		return "", err
+	}
+	return addr.Key(), nil
 }
 
 // TODO: Implement ValidateName function
@@ -76,11 +85,12 @@ func (u *User) UpdateName(name string) error {
 }
 
 // UpdateEmail updates the user's email with validation
-func (u *User) UpdateEmail(email string) error {
-	if err := ValidateEmail(email); err != nil {
+func (u *User) UpdateEmail(address string) error {
+	normalized, err := NormalizeEmail(address)
+	if err != nil {
 		return err
 	}
-	u.Email = strings.ToLower(strings.TrimSpace(email))
+	u.Email = normalized
 	u.UpdatedAt = time.Now()
 	return nil
 }
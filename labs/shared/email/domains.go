@@ -0,0 +1,88 @@
+package email
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DomainList is a set of domains, such as disposable email providers.
+// A domain in the list also covers all of its subdomains.
+type DomainList struct {
+	domains map[string]struct{}
+}
+
+// NewDomainList creates a list from domain names, returns an error if one is not a valid domain
+func NewDomainList(domains ...string) (*DomainList, error) {
+	l := &DomainList{domains: make(map[string]struct{}, len(domains))}
+	for _, domain := range domains {
+		if err := l.add(domain); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// LoadDomainList reads a list file with one domain per line; blank lines and lines starting with # are ignored
+func LoadDomainList(path string) (*DomainList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open domain list: %w", err)
+	}
+	defer f.Close()
+	return ParseDomainList(f)
+}
+
+// ParseDomainList reads a domain list in the format of LoadDomainList from r
+func ParseDomainList(r io.Reader) (*DomainList, error) {
+	l := &DomainList{domains: make(map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := l.add(text); err != nil {
+			return nil, fmt.Errorf("domain list line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read domain list: %w", err)
+	}
+	return l, nil
+}
+
+func (l *DomainList) add(domain string) error {
+	ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidDomain, domain, err)
+	}
+	l.domains[ascii] = struct{}{}
+	return nil
+}
+
+// Contains reports whether domain or one of its parent domains is in the list.
+// Unicode and ASCII forms of a domain are treated alike.
+func (l *DomainList) Contains(domain string) bool {
+	ascii, err := idnaProfile.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return false
+	}
+	for {
+		if _, ok := l.domains[ascii]; ok {
+			return true
+		}
+		_, parent, ok := strings.Cut(ascii, ".")
+		if !ok {
+			return false
+		}
+		ascii = parent
+	}
+}
+
+// Len returns the number of domains in the list
+func (l *DomainList) Len() int {
+	return len(l.domains)
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDomainList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disposable.txt")
+	content := "# disposable providers\nmailinator.com\n\n  Tempmail.ORG  \nодноразовая.рф\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadDomainList(path)
+	if err != nil {
+		t.Fatalf("LoadDomainList failed: %v", err)
+	}
+	if list.Len() != 3 {
+		t.Errorf("Expected 3 domains, got %d", list.Len())
+	}
+
+	tests := []struct {
+		domain   string
+		expected bool
+	}{
+		{"mailinator.com", true},
+		{"MAILINATOR.COM", true},
+		{"eu.mailinator.com", true},
+		{"tempmail.org", true},
+		{"одноразовая.рф", true},
+		{"xn--80aafgq8afccr4o.xn--p1ai", true},
+		{"notmailinator.com", false},
+		{"example.com", false},
+		{"com", false},
+	}
+	for _, tt := range tests {
+		if got := list.Contains(tt.domain); got != tt.expected {
+			t.Errorf("Contains(%q) = %v, want %v", tt.domain, got, tt.expected)
+		}
+	}
+}
+
+func TestParseDomainListErrors(t *testing.T) {
+	_, err := ParseDomainList(strings.NewReader("ok.com\nbad_domain!.com\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+	if _, err := LoadDomainList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
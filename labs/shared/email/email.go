@@ -0,0 +1,265 @@
+// Package email parses, normalizes and validates email addresses according to
+// RFC 5322 (addr-spec), RFC 5321 (length limits) and RFC 6531 (UTF-8 addresses).
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalid is matched by every syntax error returned by Parse
+var ErrInvalid = errors.New("invalid email address")
+
+// Syntax errors
+var (
+	ErrEmpty            = fmt.Errorf("%w: empty", ErrInvalid)
+	ErrMissingAt        = fmt.Errorf("%w: missing @", ErrInvalid)
+	ErrInvalidLocalPart = fmt.Errorf("%w: invalid local part", ErrInvalid)
+	ErrInvalidDomain    = fmt.Errorf("%w: invalid domain", ErrInvalid)
+	ErrTooLong          = fmt.Errorf("%w: too long", ErrInvalid)
+)
+
+// Length limits from RFC 5321, in octets
+const (
+	MaxLocalLength   = 64
+	MaxAddressLength = 254
+)
+
+// idnaProfile converts domains to their lowercase ASCII form and rejects invalid labels
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(true),
+	idna.VerifyDNSLength(true),
+)
+
+// Address is a parsed and normalized email address
+type Address struct {
+	Local  string // NFC-normalized, quoted only where RFC 5322 requires it
+	Domain string // Lowercase ASCII (punycode for IDNs), or an address literal such as [192.0.2.1]
+}
+
+// Parse parses an addr-spec such as "user@example.com" or "\"john doe\"@пример.рф".
+// Display names, comments and surrounding whitespace are not accepted. Domains must
+// have at least two labels: dotless domains are only meaningful on local networks.
+func Parse(s string) (Address, error) {
+	if s == "" {
+		return Address{}, ErrEmpty
+	}
+	if !utf8.ValidString(s) {
+		return Address{}, fmt.Errorf("%w: not valid UTF-8", ErrInvalid)
+	}
+
+	local, rest, err := parseLocal(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if !strings.HasPrefix(rest, "@") {
+		return Address{}, ErrMissingAt
+	}
+	domain, err := parseDomain(rest[1:])
+	if err != nil {
+		return Address{}, err
+	}
+
+	addr := Address{Local: local, Domain: domain}
+	if len(addr.Local) > MaxLocalLength {
+		return Address{}, fmt.Errorf("%w: local part exceeds %d octets", ErrTooLong, MaxLocalLength)
+	}
+	if len(addr.String()) > MaxAddressLength {
+		return Address{}, fmt.Errorf("%w: address exceeds %d octets", ErrTooLong, MaxAddressLength)
+	}
+	return addr, nil
+}
+
+// Normalize parses s and returns its normalized form
+func Normalize(s string) (string, error) {
+	addr, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// IsValid reports whether s is a syntactically valid address
+func IsValid(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+// String returns the normalized address with an ASCII domain
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// UnicodeDomain returns the domain with punycode labels decoded, e.g. "пример.рф"
+func (a Address) UnicodeDomain() string {
+	if strings.HasPrefix(a.Domain, "[") {
+		return a.Domain
+	}
+	domain, err := idnaProfile.ToUnicode(a.Domain)
+	if err != nil {
+		return a.Domain
+	}
+	return domain
+}
+
+// Unicode returns the address with its domain in Unicode, for display
+func (a Address) Unicode() string {
+	return a.Local + "@" + a.UnicodeDomain()
+}
+
+// Key returns a case-insensitive form of the address for uniqueness checks.
+// RFC 5321 lets servers treat local parts case-sensitively, but practically none do.
+func (a Address) Key() string {
+	return strings.ToLower(a.Local) + "@" + a.Domain
+}
+
+// Subaddress splits a plus-addressed local part such as "user+news" into "user" and "news".
+// The tag is empty when the local part has no "+", or when it starts with one.
+func (a Address) Subaddress() (base, tag string) {
+	local := a.Local
+	if strings.HasPrefix(local, `"`) {
+		return local, ""
+	}
+	i := strings.IndexByte(local, '+')
+	if i <= 0 {
+		return local, ""
+	}
+	return local[:i], local[i+1:]
+}
+
+// parseLocal parses the local part at the start of s and returns it normalized,
+// together with the unparsed rest of s
+func parseLocal(s string) (local, rest string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		return parseQuoted(s)
+	}
+	end := strings.IndexByte(s, '@')
+	if end < 0 {
+		if isDotAtom(s) {
+			return "", "", ErrMissingAt
+		}
+		end = len(s)
+	}
+	local = norm.NFC.String(s[:end])
+	if local == "" || !isDotAtom(local) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidLocalPart, s[:end])
+	}
+	return local, s[end:], nil
+}
+
+// parseQuoted parses a quoted-string local part. Quotes are dropped when the content
+// is a valid dot-atom, otherwise only '"' and '\' stay escaped.
+func parseQuoted(s string) (local, rest string, err error) {
+	var content strings.Builder
+	for i := 1; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"':
+			value := norm.NFC.String(content.String())
+			if isDotAtom(value) {
+				return value, s[i+1:], nil
+			}
+			return quote(value), s[i+1:], nil
+		case r == '\\':
+			next, nextSize := utf8.DecodeRuneInString(s[i+size:])
+			if i+size >= len(s) || !(next == ' ' || next == '\t' || isVisible(next)) {
+				return "", "", fmt.Errorf("%w: invalid quoted pair", ErrInvalidLocalPart)
+			}
+			content.WriteRune(next)
+			i += size + nextSize
+			continue
+		case r == ' ' || r == '\t' || isVisible(r):
+			content.WriteRune(r)
+		default:
+			return "", "", fmt.Errorf("%w: invalid character %q in quoted string", ErrInvalidLocalPart, r)
+		}
+		i += size
+	}
+	return "", "", fmt.Errorf("%w: unterminated quoted string", ErrInvalidLocalPart)
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// isDotAtom reports whether s is one or more atoms separated by single dots
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for _, r := range s {
+		if r != '.' && !isAtext(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAtext reports whether r may appear in an atom (RFC 5322 atext extended by RFC 6531)
+func isAtext(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", r):
+		return true
+	}
+	return r >= utf8.RuneSelf && isVisible(r)
+}
+
+// isVisible reports whether r is a printable character other than space
+func isVisible(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r > ' ' && r < 0x7f
+	}
+	return r != utf8.RuneError && !isControl(r)
+}
+
+func isControl(r rune) bool {
+	return r >= 0x80 && r <= 0x9f || r == 0x2028 || r == 0x2029
+}
+
+// parseDomain converts a domain to lowercase ASCII, or validates an address literal
+func parseDomain(s string) (string, error) {
+	if strings.HasPrefix(s, "[") {
+		return parseLiteral(s)
+	}
+	if s == "" {
+		return "", fmt.Errorf("%w: empty", ErrInvalidDomain)
+	}
+	ascii, err := idnaProfile.ToASCII(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidDomain, s, err)
+	}
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("%w: %q has no top-level domain", ErrInvalidDomain, s)
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", fmt.Errorf("%w: numeric top-level domain in %q", ErrInvalidDomain, s)
+	}
+	return ascii, nil
+}
+
+// parseLiteral validates [IPv4] and [IPv6:...] address literals
+func parseLiteral(s string) (string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return "", fmt.Errorf("%w: unterminated address literal", ErrInvalidDomain)
+	}
+	inner := s[1 : len(s)-1]
+	if v6, ok := strings.CutPrefix(inner, "IPv6:"); ok {
+		if ip := net.ParseIP(v6); ip != nil && ip.To4() == nil {
+			return "[IPv6:" + ip.String() + "]", nil
+		}
+	} else if ip := net.ParseIP(inner); ip != nil && ip.To4() != nil && !strings.Contains(inner, ":") {
+		return "[" + ip.String() + "]", nil
+	}
+	return "", fmt.Errorf("%w: invalid address literal %q", ErrInvalidDomain, s)
+}
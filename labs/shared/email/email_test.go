@@ -0,0 +1,133 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseValid(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"user@example.com", "user@example.com"},
+		{"User@EXAMPLE.COM", "User@example.com"},
+		{"first.last@mail.example.com", "first.last@mail.example.com"},
+		{"user+tag@example.com", "user+tag@example.com"},
+		{"user+tag+more@example.com", "user+tag+more@example.com"},
+		{"+leading@example.com", "+leading@example.com"},
+		{"!#$%&'*+-/=?^_`{|}~@example.com", "!#$%&'*+-/=?^_`{|}~@example.com"},
+		{`"john"@example.com`, "john@example.com"},
+		{`"john doe"@example.com`, `"john doe"@example.com`},
+		{`"john..doe"@example.com`, `"john..doe"@example.com`},
+		{`"a@b"@example.com`, `"a@b"@example.com`},
+		{`"quote\"inside"@example.com`, `"quote\"inside"@example.com`},
+		{`"\j\o\h\n"@example.com`, "john@example.com"},
+		{"user@пример.рф", "user@xn--e1afmkfd.xn--p1ai"},
+		{"user@BÜCHER.de", "user@xn--bcher-kva.de"},
+		{"пользователь@пример.рф", "пользователь@xn--e1afmkfd.xn--p1ai"},
+		{"josé@example.com", "josé@example.com"}, // NFC
+		{"user@[192.0.2.1]", "user@[192.0.2.1]"},
+		{"user@[IPv6:2001:DB8::1]", "user@[IPv6:2001:db8::1]"},
+		{"a@b.co", "a@b.co"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if err != nil {
+				t.Fatalf("Normalize(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"", ErrEmpty},
+		{"userexample.com", ErrMissingAt},
+		{"user@", ErrInvalidDomain},
+		{"@example.com", ErrInvalidLocalPart},
+		{"user@@example.com", ErrInvalidDomain},
+		{"a@b@example.com", ErrInvalidDomain},
+		{"user @example.com", ErrInvalidLocalPart},
+		{" user@example.com", ErrInvalidLocalPart},
+		{".user@example.com", ErrInvalidLocalPart},
+		{"user.@example.com", ErrInvalidLocalPart},
+		{"us..er@example.com", ErrInvalidLocalPart},
+		{"us(er@example.com", ErrInvalidLocalPart},
+		{`"unterminated@example.com`, ErrInvalidLocalPart},
+		{`"ok"x@example.com`, ErrMissingAt},
+		{"user@notvalid", ErrInvalidDomain},
+		{"user@example..com", ErrInvalidDomain},
+		{"user@-example.com", ErrInvalidDomain},
+		{"user@example.com.", ErrInvalidDomain},
+		{"user@exa_mple.com", ErrInvalidDomain},
+		{"user@example.123", ErrInvalidDomain},
+		{"user@[300.0.0.1]", ErrInvalidDomain},
+		{"user@[IPv6:192.0.2.1]", ErrInvalidDomain},
+		{"user@" + strings.Repeat("a", 64) + ".com", ErrInvalidDomain},
+		{strings.Repeat("a", 65) + "@example.com", ErrTooLong},
+		{"user@" + strings.Repeat(strings.Repeat("a", 61)+".", 4) + "com", ErrTooLong},
+		{"user\x00@example.com", ErrInvalidLocalPart},
+		{"\xff@example.com", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.input, tt.err, err)
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%q): expected error to match ErrInvalid, got %v", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestAddressHelpers(t *testing.T) {
+	addr, err := Parse("John.Doe+News@Пример.РФ")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := addr.UnicodeDomain(); got != "пример.рф" {
+		t.Errorf("UnicodeDomain() = %q, want %q", got, "пример.рф")
+	}
+	if got := addr.Unicode(); got != "John.Doe+News@пример.рф" {
+		t.Errorf("Unicode() = %q", got)
+	}
+	if got := addr.Key(); got != "john.doe+news@xn--e1afmkfd.xn--p1ai" {
+		t.Errorf("Key() = %q", got)
+	}
+	base, tag := addr.Subaddress()
+	if base != "John.Doe" || tag != "News" {
+		t.Errorf("Subaddress() = %q, %q", base, tag)
+	}
+
+	other, _ := Parse("JOHN.DOE+news@xn--e1afmkfd.xn--p1ai")
+	if other.Key() != addr.Key() {
+		t.Errorf("Expected equal keys, got %q and %q", other.Key(), addr.Key())
+	}
+
+	for _, input := range []string{"+tag@example.com", `"a+b c"@example.com`, "plain@example.com"} {
+		a, _ := Parse(input)
+		if _, tag := a.Subaddress(); tag != "" {
+			t.Errorf("Subaddress(%q): expected no tag, got %q", input, tag)
+		}
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	if !IsValid("user@example.com") {
+		t.Error("Expected user@example.com to be valid")
+	}
+	if IsValid("john@notvalid") {
+		t.Error("Expected john@notvalid to be invalid")
+	}
+}
@@ -0,0 +1,109 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Policy errors returned by Validator
+var (
+	ErrDisposable   = errors.New("disposable email domain")
+	ErrNoMailServer = errors.New("domain does not accept email")
+)
+
+// Resolver looks up the mail servers of a domain; *net.Resolver satisfies it
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Validator checks parsed addresses against optional domain policies.
+// The zero value only checks syntax.
+type Validator struct {
+	Disposable *DomainList // Reject addresses at these domains; nil skips the check
+	Resolver   Resolver    // Require the domain to accept mail; nil skips the lookup
+}
+
+// Validate parses s and applies the policies of v, returning the normalized address
+func (v *Validator) Validate(ctx context.Context, s string) (Address, error) {
+	addr, err := Parse(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if v.Disposable != nil && v.Disposable.Contains(addr.Domain) {
+		return Address{}, fmt.Errorf("%w: %s", ErrDisposable, addr.Domain)
+	}
+	if v.Resolver != nil && !strings.HasPrefix(addr.Domain, "[") {
+		if err := checkMailServer(ctx, v.Resolver, addr.Domain); err != nil {
+			return Address{}, err
+		}
+	}
+	return addr, nil
+}
+
+// checkMailServer follows RFC 5321 section 5.1: use the MX records if there are any,
+// otherwise the domain itself must resolve. A null MX (RFC 7505) refuses all mail.
+// Lookup failures other than "not found" are returned as is, so callers can retry.
+func checkMailServer(ctx context.Context, r Resolver, domain string) error {
+	mx, err := r.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("look up MX for %s: %w", domain, err)
+	}
+	if len(mx) == 1 && (mx[0].Host == "." || mx[0].Host == "") {
+		return fmt.Errorf("%w: %s publishes a null MX", ErrNoMailServer, domain)
+	}
+	if len(mx) > 0 {
+		return nil
+	}
+
+	hosts, err := r.LookupHost(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("look up %s: %w", domain, err)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoMailServer, domain)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// FakeResolver answers lookups from maps, for tests. Names missing from both maps
+// are reported as not found.
+type FakeResolver struct {
+	MX    map[string][]*net.MX // Domain -> MX records
+	Hosts map[string][]string  // Host -> addresses
+	Err   error                // Returned by every lookup when set
+}
+
+// LookupMX implements Resolver
+func (f *FakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if mx, ok := f.MX[name]; ok {
+		return mx, nil
+	}
+	return nil, notFound(name)
+}
+
+// LookupHost implements Resolver
+func (f *FakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if addrs, ok := f.Hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, notFound(host)
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
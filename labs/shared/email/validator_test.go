@@ -0,0 +1,72 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	disposable, err := NewDomainList("mailinator.com")
+	if err != nil {
+		t.Fatalf("NewDomainList failed: %v", err)
+	}
+	resolver := &FakeResolver{
+		MX: map[string][]*net.MX{
+			"example.com":           {{Host: "mx.example.com.", Pref: 10}},
+			"null.example":          {{Host: ".", Pref: 0}},
+			"xn--e1afmkfd.xn--p1ai": {{Host: "mx.xn--e1afmkfd.xn--p1ai.", Pref: 10}},
+		},
+		Hosts: map[string][]string{
+			"a-only.example": {"192.0.2.10"},
+		},
+	}
+	v := &Validator{Disposable: disposable, Resolver: resolver}
+
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"user@example.com", nil},
+		{"user@пример.рф", nil},
+		{"user@a-only.example", nil},
+		{"user@[192.0.2.1]", nil},
+		{"user@mailinator.com", ErrDisposable},
+		{"user@x.mailinator.com", ErrDisposable},
+		{"user@null.example", ErrNoMailServer},
+		{"user@nowhere.example", ErrNoMailServer},
+		{"user@notvalid", ErrInvalidDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := v.Validate(context.Background(), tt.input)
+			if tt.err == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestValidatorLookupFailure(t *testing.T) {
+	timeout := &net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}
+	v := &Validator{Resolver: &FakeResolver{Err: timeout}}
+	_, err := v.Validate(context.Background(), "user@example.com")
+	if !errors.Is(err, timeout) || errors.Is(err, ErrNoMailServer) {
+		t.Errorf("Expected the lookup error to be passed through, got %v", err)
+	}
+}
+
+func TestZeroValidatorChecksSyntaxOnly(t *testing.T) {
+	var v Validator
+	addr, err := v.Validate(context.Background(), "User@Example.COM")
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if addr.String() != "User@example.com" {
+		t.Errorf("Expected normalized address, got %q", addr)
+	}
+}
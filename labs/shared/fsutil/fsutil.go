@@ -0,0 +1,56 @@
+// Package fsutil holds file helpers shared by the file-backed stores of the labs.
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces path with data via a fsynced temporary file in the same directory,
+// so readers see either the old or the new content and a crash never leaves a partial file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ReplaceFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ReplaceFile is WriteFileAtomic that returns the new file open for reading and writing and
+// positioned after data, so that callers appending to path never have to reopen it
+func ReplaceFile(path string, data []byte, perm os.FileMode) (*os.File, error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once the rename has succeeded
+
+	err = write(tmp, data, perm)
+	if err == nil {
+		err = os.Rename(tmpName, path)
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	// Persist the rename itself; not every platform can open a directory for syncing
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return tmp, nil
+}
+
+// write fills a temporary file and syncs it
+func write(f *os.File, data []byte, perm os.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,52 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFileAtomic: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != content {
+			t.Errorf("Expected %q, got %q (%v)", content, got, err)
+		}
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "data.json")
+	if err := WriteFileAtomic(path, []byte("x"), 0o644); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func TestReplaceFileKeepsFileOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := WriteFileAtomic(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	f, err := ReplaceFile(path, []byte("new\n"), 0o644)
+	if err != nil {
+		t.Fatalf("ReplaceFile: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("appended\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new\nappended\n" {
+		t.Errorf("Expected appends to reach the new file, got %q", got)
+	}
+}
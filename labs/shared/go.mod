@@ -0,0 +1,8 @@
+module shared
+
+go 1.24
+
+require (
+	golang.org/x/net v0.41.0
+	golang.org/x/text v0.26.0
+)